@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"io"
+	"os"
+	"shorten-url/backend/pkg/config"
+	"shorten-url/backend/pkg/services"
+	"shorten-url/backend/pkg/stores"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Dumps every link of a user in the same formats as GET /export/{userId}:
+//
+//	go run ./cmd/export -user <uuid> -format csv -out links.csv
+func main() {
+	userID := flag.String("user", "", "User ID whose links are exported")
+	format := flag.String("format", "csv", "Export format: csv, json or ndjson")
+	out := flag.String("out", "", "Output file, stdout when empty")
+
+	flag.Parse()
+
+	if *userID == "" {
+		log.Fatal("Missing -user flag")
+	}
+	if _, _, err := services.ExportContentType(*format); err != nil {
+		log.Fatal(err)
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		file, err := os.Create(*out)
+		if err != nil {
+			log.Fatalf("Failed to create %s: %v", *out, err)
+		}
+		defer file.Close()
+		w = file
+	}
+	buffered := bufio.NewWriter(w)
+
+	config.LoadEnv()
+	stores.InitPostgres()
+	defer stores.PostgresClient.DB.Close()
+
+	if err := services.ExportURLs(context.Background(), stores.PostgresClient.Queries, *userID, *format, buffered); err != nil {
+		log.Fatalf("Failed to export URLs: %v", err)
+	}
+	if err := buffered.Flush(); err != nil {
+		log.Fatalf("Failed to write export: %v", err)
+	}
+}
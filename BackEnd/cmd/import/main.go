@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"shorten-url/backend/pkg/config"
+	"shorten-url/backend/pkg/services"
+	"shorten-url/backend/pkg/stores"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Imports a Bitly or Rebrandly CSV export for one user, the same way as
+// POST /import, and prints the report as JSON:
+//
+//	go run ./cmd/import -user <uuid> -file bitly.csv
+func main() {
+	userID := flag.String("user", "", "User ID that will own the imported links")
+	path := flag.String("file", "", "CSV export to import")
+
+	flag.Parse()
+
+	if *userID == "" || *path == "" {
+		log.Fatal("Both -user and -file are required")
+	}
+
+	file, err := os.Open(*path)
+	if err != nil {
+		log.Fatalf("Failed to open %s: %v", *path, err)
+	}
+	defer file.Close()
+
+	config.LoadEnv()
+	stores.InitRedis("41943040", "volatile-lru")
+	stores.InitPostgres()
+	defer stores.PostgresClient.DB.Close()
+	defer stores.RedisCluster.Close()
+
+	// Imports keep their codes, so no generator or queue is needed.
+	services.NewUrlService(stores.RedisCluster, stores.PostgresClient, nil, nil)
+
+	report, err := services.UrlServiceInstance.ImportURLs(*userID, file)
+	if report != nil {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(report)
+	}
+	if err != nil {
+		log.Fatalf("Import failed: %v", err)
+	}
+}
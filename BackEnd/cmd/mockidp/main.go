@@ -0,0 +1,257 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"math/big"
+	"net/http"
+	"net/url"
+	"shorten-url/backend/pkg/oidc"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// A stand-in OpenID Connect provider for trying the SSO flow locally. Every
+// authorization request is approved at once as the configured user, or as
+// the email given in login_hint:
+//
+//	go run ./cmd/mockidp -addr :9000 -client shorten-url
+//
+// then set OIDC_ISSUER=http://localhost:9000 and open /auth/oidc/login.
+// Not for production use.
+
+const keyID = "mock-1"
+
+type authorization struct {
+	clientID      string
+	redirectURI   string
+	codeChallenge string
+	nonce         string
+	email         string
+	expiresAt     time.Time
+}
+
+type mockProvider struct {
+	issuer   string
+	clientID string
+	subject  string
+	email    string
+	name     string
+	key      *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]authorization
+}
+
+func main() {
+	addr := flag.String("addr", ":9000", "Address to listen on")
+	issuer := flag.String("issuer", "http://localhost:9000", "Issuer URL, must match OIDC_ISSUER")
+	clientID := flag.String("client", "shorten-url", "Client ID accepted by the provider")
+	subject := flag.String("subject", "mock-user", "Subject of the signed-in user")
+	email := flag.String("email", "mock.user@example.com", "Verified email of the signed-in user")
+	name := flag.String("name", "Mock User", "Display name of the signed-in user")
+
+	flag.Parse()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		log.Fatalf("Failed to generate signing key: %v", err)
+	}
+
+	p := &mockProvider{
+		issuer:   strings.TrimSuffix(*issuer, "/"),
+		clientID: *clientID,
+		subject:  *subject,
+		email:    *email,
+		name:     *name,
+		key:      key,
+		codes:    make(map[string]authorization),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", p.discovery)
+	mux.HandleFunc("GET /authorize", p.authorize)
+	mux.HandleFunc("POST /token", p.token)
+	mux.HandleFunc("GET /jwks", p.jwks)
+
+	log.Infof("Mock OIDC provider %s listening on %s", p.issuer, *addr)
+	log.Fatal(http.ListenAndServe(*addr, mux))
+}
+
+func (p *mockProvider) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"issuer":                                p.issuer,
+		"authorization_endpoint":                p.issuer + "/authorize",
+		"token_endpoint":                        p.issuer + "/token",
+		"jwks_uri":                              p.issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (p *mockProvider) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	redirectURI, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil || !redirectURI.IsAbs() {
+		http.Error(w, "Invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	if query.Get("client_id") != p.clientID {
+		http.Error(w, "Unknown client_id", http.StatusBadRequest)
+		return
+	}
+
+	// From here on errors go back to the client, as a real provider does.
+	callback := redirectURI.Query()
+	callback.Set("state", query.Get("state"))
+	switch {
+	case query.Get("response_type") != "code":
+		callback.Set("error", "unsupported_response_type")
+	case query.Get("code_challenge") == "" || query.Get("code_challenge_method") != "S256":
+		callback.Set("error", "invalid_request")
+		callback.Set("error_description", "PKCE with S256 is required")
+	default:
+		email := p.email
+		if hint := query.Get("login_hint"); hint != "" {
+			email = hint
+		}
+		code := randomString()
+		p.mu.Lock()
+		p.codes[code] = authorization{
+			clientID:      p.clientID,
+			redirectURI:   query.Get("redirect_uri"),
+			codeChallenge: query.Get("code_challenge"),
+			nonce:         query.Get("nonce"),
+			email:         email,
+			expiresAt:     time.Now().Add(time.Minute),
+		}
+		p.mu.Unlock()
+		callback.Set("code", code)
+	}
+
+	redirectURI.RawQuery = callback.Encode()
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+func (p *mockProvider) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		tokenError(w, "invalid_request", "Malformed form body")
+		return
+	}
+	clientID := r.PostForm.Get("client_id")
+	if user, _, ok := r.BasicAuth(); ok {
+		clientID, _ = url.QueryUnescape(user)
+	}
+	if r.PostForm.Get("grant_type") != "authorization_code" {
+		tokenError(w, "unsupported_grant_type", "")
+		return
+	}
+
+	code := r.PostForm.Get("code")
+	p.mu.Lock()
+	auth, ok := p.codes[code]
+	delete(p.codes, code)
+	p.mu.Unlock()
+
+	switch {
+	case !ok || time.Now().After(auth.expiresAt):
+		tokenError(w, "invalid_grant", "Unknown or expired code")
+		return
+	case clientID != auth.clientID || r.PostForm.Get("redirect_uri") != auth.redirectURI:
+		tokenError(w, "invalid_grant", "Code was issued to another client")
+		return
+	case oidc.CodeChallenge(r.PostForm.Get("code_verifier")) != auth.codeChallenge:
+		tokenError(w, "invalid_grant", "PKCE verification failed")
+		return
+	}
+
+	subject := p.subject
+	if auth.email != p.email {
+		subject = "mock-" + auth.email
+	}
+	now := time.Now()
+	idToken, err := p.sign(map[string]any{
+		"iss":            p.issuer,
+		"sub":            subject,
+		"aud":            auth.clientID,
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+		"nonce":          auth.nonce,
+		"email":          auth.email,
+		"email_verified": true,
+		"name":           p.name,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     idToken,
+	})
+}
+
+func (p *mockProvider) jwks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": keyID,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(p.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(p.key.E)).Bytes()),
+		}},
+	})
+}
+
+// sign encodes claims as an RS256 JWT.
+func (p *mockProvider) sign(claims map[string]any) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": keyID})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, p.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+func tokenError(w http.ResponseWriter, code string, description string) {
+	writeJSON(w, http.StatusBadRequest, map[string]string{
+		"error":             code,
+		"error_description": description,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func randomString() string {
+	raw := make([]byte, 24)
+	rand.Read(raw)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
@@ -1,21 +1,35 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"html/template"
+	"io"
+	"mime"
 	"net/http"
 	"os"
+	"path/filepath"
+	"shorten-url/backend/pkg/auth"
+	"shorten-url/backend/pkg/bots"
 	"shorten-url/backend/pkg/config"
+	"shorten-url/backend/pkg/mail"
+	"shorten-url/backend/pkg/oidc"
 	"shorten-url/backend/pkg/services"
 	"shorten-url/backend/pkg/stores"
 	"shorten-url/backend/pkg/utils"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
 	"github.com/go-chi/httprate"
+	"github.com/google/uuid"
 	"github.com/robfig/cron"
 	_ "github.com/robfig/cron/v3"
 	log "github.com/sirupsen/logrus"
@@ -40,6 +54,281 @@ func loadFeatureFlags(configFile string) (FeatureFlags, error) {
 	return flags, err
 }
 
+const unlockTokenTTL = 30 * time.Minute
+
+var unlockPage = template.Must(template.New("unlock").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Protected link</title></head>
+<body>
+	<form method="POST" action="/short/{{.Code}}/unlock">
+		<p>This link is password protected.</p>
+		{{if .Failed}}<p style="color: red">Wrong password, try again.</p>{{end}}
+		<input type="password" name="password" autofocus required>
+		<button type="submit">Unlock</button>
+	</form>
+</body>
+</html>`))
+
+func renderUnlockPage(w http.ResponseWriter, code string, failed bool) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if failed {
+		w.WriteHeader(http.StatusUnauthorized)
+	}
+	unlockPage.Execute(w, map[string]any{"Code": code, "Failed": failed})
+}
+
+func unlockCookieName(code string) string {
+	return "unlock_" + code
+}
+
+// isUnlocked looks for an unlock token for code in the X-Unlock-Token header
+// (API clients) or the unlock cookie (browsers).
+func isUnlocked(r *http.Request, code string) bool {
+	token := r.Header.Get("X-Unlock-Token")
+	if token == "" {
+		if cookie, err := r.Cookie(unlockCookieName(code)); err == nil {
+			token = cookie.Value
+		}
+	}
+	subject, ok := utils.VerifyToken(config.AppConfig.Server.TokenSecret, token)
+	return ok && subject == "unlock:"+code
+}
+
+// resolveShortURL serves a short link. JSON clients either hit
+// /api/short/{id} or send "Accept: application/json"; everyone else gets a
+// real redirect.
+func resolveShortURL(botDetector *bots.Detector, analytics bool, forceJSON bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		shortenedURL := chi.URLParam(r, "id")
+		if shortenedURL == "" {
+			http.Error(w, "Missing ID", http.StatusBadRequest)
+			return
+		}
+
+		originalURL, err := services.UrlServiceInstance.GetURL(shortenedURL)
+		if errors.Is(err, services.ErrURLExpired) {
+			http.Error(w, "URL has expired", http.StatusGone)
+			return
+		}
+		if err != nil || originalURL == nil {
+			http.Error(w, "Not Found Your URL", http.StatusNotFound)
+			return
+		}
+
+		// Clicks only count once a protected link has been unlocked.
+		if originalURL.IsProtected() && !isUnlocked(r, shortenedURL) {
+			if forceJSON || utils.WantsJSON(r) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusUnauthorized)
+				json.NewEncoder(w).Encode(map[string]any{
+					"error":     "password_required",
+					"unlockUrl": "/short/" + shortenedURL + "/unlock",
+				})
+				return
+			}
+			renderUnlockPage(w, shortenedURL, false)
+			return
+		}
+
+		// Unfurlers, scanners and prefetches must not use up a limited link's
+		// clicks. Anyone can claim to be one, though, so they are not given
+		// the target of such a link either.
+		reason := botDetector.Classify(r)
+		bot := reason != ""
+		withheld := bot && originalURL.MaxClicks > 0
+		clientIP := utils.ClientIP(r)
+		if bot {
+			log.Debugf("Bot click on %s: %s", shortenedURL, reason)
+		} else {
+			// Bots are only recorded as bot clicks.
+			bot, err = services.UrlServiceInstance.CountClick(shortenedURL, originalURL, clientIP, analytics)
+			if errors.Is(err, services.ErrClickLimitReached) {
+				http.Error(w, err.Error(), http.StatusGone)
+				return
+			}
+			if err != nil {
+				log.Error(err)
+				http.Error(w, "Failed to resolve URL", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		if analytics {
+			services.UrlServiceInstance.RecordClick(services.ClickEvent{
+				Shortened: shortenedURL,
+				ClickedAt: time.Now(),
+				Referrer:  r.Referer(),
+				UserAgent: r.UserAgent(),
+				Language:  r.Header.Get("Accept-Language"),
+				IPPrefix:  utils.AnonymizeIP(clientIP),
+				Bot:       bot,
+				Visitor:   utils.VisitorFingerprint(config.AppConfig.Server.TokenSecret, clientIP, r.UserAgent()),
+			})
+		}
+
+		if withheld {
+			http.Error(w, "This link can only be opened a limited number of times, open it in a browser", http.StatusForbidden)
+			return
+		}
+
+		if forceJSON || utils.WantsJSON(r) {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]any{
+				"originalUrl": originalURL.Original,
+			})
+			return
+		}
+
+		status := originalURL.RedirectStatus
+		if status == 0 {
+			status = config.AppConfig.Server.RedirectStatus
+		}
+		http.Redirect(w, r, originalURL.Original, status)
+	}
+}
+
+// Roughly MaxBulkItems links with generous titles and URLs.
+const maxBulkBodyBytes = 4 << 20
+
+// Commercial shortener exports run to hundreds of thousands of rows.
+const maxImportBodyBytes = 64 << 20
+
+// bulkBody picks the bulk format from the format query parameter, the
+// Content-Type, or the extension of an uploaded "file" form field.
+func bulkBody(r *http.Request) (string, io.ReadCloser, error) {
+	format := bulkFormat(strings.ToLower(r.URL.Query().Get("format")))
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	if mediaType == "multipart/form-data" {
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			return "", nil, fmt.Errorf("missing file upload: %v", err)
+		}
+		if format == "" {
+			format = bulkFormat(strings.TrimPrefix(strings.ToLower(filepath.Ext(header.Filename)), "."))
+		}
+		return format, file, nil
+	}
+
+	if format == "" {
+		format = bulkFormat(mediaType)
+	}
+	return format, r.Body, nil
+}
+
+func bulkFormat(kind string) string {
+	switch kind {
+	case "application/json", "json":
+		return "json"
+	case "application/x-ndjson", "application/ndjson", "application/jsonl", "ndjson", "jsonl":
+		return "ndjson"
+	case "text/csv", "csv":
+		return "csv"
+	}
+	return kind
+}
+
+// pathUser checks that the {userId} URL parameter names the authenticated
+// user, for routes that predate API keys and still carry it in the path.
+func pathUser(w http.ResponseWriter, r *http.Request) (string, bool) {
+	userID := auth.UserID(r)
+	pathID, err := uuid.Parse(chi.URLParam(r, "userId"))
+	if err != nil {
+		http.Error(w, services.ErrInvalidUserID.Error(), http.StatusBadRequest)
+		return "", false
+	}
+	if pathID.String() != userID {
+		http.Error(w, "Cannot access another user's links", http.StatusForbidden)
+		return "", false
+	}
+	return userID, true
+}
+
+// isAdmin reports whether userID is listed in ADMIN_USER_IDS.
+func isAdmin(userID string) bool {
+	id, err := uuid.Parse(userID)
+	if err != nil {
+		return false
+	}
+	return slices.Contains(config.AppConfig.Server.AdminUserIDs, id.String())
+}
+
+// writeLinkError maps errors from the UrlService link mutations onto HTTP
+// responses.
+func writeLinkError(w http.ResponseWriter, err error, action string) {
+	switch {
+	case errors.Is(err, services.ErrInvalidURL),
+		errors.Is(err, services.ErrInvalidUserID),
+		errors.Is(err, services.ErrInvalidExpiry),
+		errors.Is(err, services.ErrInvalidRedirectStatus),
+		errors.Is(err, services.ErrInvalidMaxClicks),
+		errors.Is(err, services.ErrInvalidPassword),
+		errors.Is(err, services.ErrInvalidTitle),
+		errors.Is(err, services.ErrInvalidTransfer):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, services.ErrURLNotFound):
+		http.Error(w, "Not Found Your URL", http.StatusNotFound)
+	case errors.Is(err, services.ErrUserNotFound),
+		errors.Is(err, services.ErrWorkspaceNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, services.ErrNotOwner),
+		errors.Is(err, services.ErrWorkspaceForbidden):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, services.ErrURLPending):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		log.Errorf("Failed to %s: %v", action, err)
+		http.Error(w, "Failed to "+action, http.StatusInternalServerError)
+	}
+}
+
+// writeWorkspaceError maps errors from workspace and membership management
+// onto HTTP responses.
+func writeWorkspaceError(w http.ResponseWriter, err error, action string) {
+	switch {
+	case errors.Is(err, services.ErrInvalidWorkspaceName),
+		errors.Is(err, services.ErrInvalidRole),
+		errors.Is(err, services.ErrInvalidUserID):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, services.ErrWorkspaceNotFound),
+		errors.Is(err, services.ErrUserNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, services.ErrWorkspaceForbidden):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, services.ErrLastOwner):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		log.Errorf("Failed to %s: %v", action, err)
+		http.Error(w, "Failed to "+action, http.StatusInternalServerError)
+	}
+}
+
+// writeAccountError maps errors from signup, login and the session routes
+// onto HTTP responses.
+func writeAccountError(w http.ResponseWriter, err error, action string) {
+	switch {
+	case errors.Is(err, services.ErrInvalidEmail),
+		errors.Is(err, services.ErrWeakPassword),
+		errors.Is(err, services.ErrInvalidResetToken),
+		errors.Is(err, services.ErrInvalidOIDCState):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, services.ErrInvalidCredentials),
+		errors.Is(err, services.ErrInvalidSession):
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+	case errors.Is(err, oidc.ErrInvalidIDToken):
+		log.Warnf("Rejected ID token: %v", err)
+		http.Error(w, oidc.ErrInvalidIDToken.Error(), http.StatusUnauthorized)
+	case errors.Is(err, services.ErrEmailTaken):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, services.ErrUserNotFound),
+		errors.Is(err, services.ErrOIDCDisabled):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
+		log.Errorf("Failed to %s: %v", action, err)
+		http.Error(w, "Failed to "+action, http.StatusInternalServerError)
+	}
+}
+
 func main() {
 	flags, err := loadFeatureFlags("feature.json")
 	if err != nil {
@@ -83,6 +372,21 @@ func main() {
 			log.Error(err)
 		}
 	})
+	c.AddFunc("@daily", func() {
+		if err := services.UrlServiceInstance.EnsureClickPartitions(time.Now()); err != nil {
+			log.Error(err)
+		}
+	})
+	c.AddFunc("@every 1m", func() {
+		if err := services.UrlServiceInstance.RollUpClicks(); err != nil {
+			log.Error(err)
+		}
+	})
+	c.AddFunc("@every 5m", func() {
+		if err := services.UrlServiceInstance.PersistVisitorSketches(); err != nil {
+			log.Error(err)
+		}
+	})
 	c.Start()
 	defer c.Stop()
 
@@ -90,9 +394,51 @@ func main() {
 	stores.InitRedis("41943040", "volatile-lru")
 	stores.InitPostgres()
 	stores.InitRabbitMQ()
-	stores.RabbitMQClient.DeclareQueue("queue-based-load-leveling-" + *port)
-	services.NewUrlService(stores.RedisCluster, stores.PostgresClient, stores.RabbitMQClient)
+	// A queue declared before dead lettering existed has to be deleted once
+	// it is drained; RabbitMQ refuses to change the arguments of a queue.
+	if _, err := stores.RabbitMQClient.DeclareDeadLetteredQueue("queue-based-load-leveling-" + *port); err != nil {
+		log.Fatalf("Failed to declare link queue: %v", err)
+	}
+	stores.RabbitMQClient.DeclareQueue(services.ClickQueue(*port))
 
+	nodeID, _ := strconv.ParseInt(*port, 10, 64)
+	codeGenerator, err := utils.NewCodeGenerator(
+		config.AppConfig.Code.Generator,
+		config.AppConfig.Code.Alphabet,
+		config.AppConfig.Code.Length,
+		nodeID,
+	)
+	if err != nil {
+		log.Fatalf("Failed to create code generator: %v", err)
+	}
+	services.NewUrlService(stores.RedisCluster, stores.PostgresClient, stores.RabbitMQClient, codeGenerator)
+	mailCfg := config.AppConfig.Mail
+	services.UrlServiceInstance.SetMailSender(
+		mail.NewSender(mailCfg.Driver, mailCfg.Host, mailCfg.Port, mailCfg.Username, mailCfg.Password, mailCfg.From),
+		mailCfg.ResetURL,
+	)
+	if oidcCfg := config.AppConfig.OIDC; oidcCfg.Issuer != "" {
+		provider, err := oidc.NewProvider(context.Background(), oidc.Config{
+			Issuer:       oidcCfg.Issuer,
+			ClientID:     oidcCfg.ClientID,
+			ClientSecret: oidcCfg.ClientSecret,
+			RedirectURL:  oidcCfg.RedirectURL,
+			Scopes:       oidcCfg.Scopes,
+		})
+		if err != nil {
+			log.Fatalf("Failed to set up OIDC provider %s: %v", oidcCfg.Issuer, err)
+		}
+		services.UrlServiceInstance.SetOIDCProvider(provider)
+	}
+	botDetector, err := bots.NewDetector(config.AppConfig.Bots.RulesFile)
+	if err != nil {
+		log.Fatalf("Failed to load bot rules: %v", err)
+	}
+	c.AddFunc("@every 1m", func() {
+		if err := botDetector.Reload(); err != nil {
+			log.Error(err)
+		}
+	})
 
 	defer stores.PostgresClient.DB.Close()
 	defer stores.RedisCluster.Close()
@@ -103,6 +449,16 @@ func main() {
 		go services.UrlServiceInstance.ProcessQueueBatch(*port,fmt.Sprintf("consumer-%d", i), 100, 5*time.Second)
 	}
 
+	if err := services.UrlServiceInstance.EnsureClickPartitions(time.Now()); err != nil {
+		log.Error(err)
+	}
+	services.UrlServiceInstance.StartClickFlusher(5 * time.Second)
+	go services.UrlServiceInstance.PublishClickEvents(*port)
+	numClickConsumers := 2
+	for i := 1; i <= numClickConsumers; i++ {
+		go services.UrlServiceInstance.ProcessClickBatch(*port, fmt.Sprintf("click-consumer-%d", i), 500, 2*time.Second)
+	}
+
 	r := chi.NewRouter()
 
 	if flags.Logging {
@@ -116,40 +472,17 @@ func main() {
 
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{"https://*", "http://*", "ws://*"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "X-Unlock-Token"},
 		ExposedHeaders:   []string{"Link"},
 		AllowCredentials: false,
 		MaxAge:           300,
 	}))
 	r.Use(middleware.StripSlashes)
+	r.Use(auth.Authenticate)
 
-	r.Get("/short/{id}", func(w http.ResponseWriter, r *http.Request) {
-		shortenedURL := chi.URLParam(r, "id")
-		if shortenedURL == "" {
-			http.Error(w, "Missing ID", http.StatusBadRequest)
-			return
-		}
-
-		originalURL, err := services.UrlServiceInstance.GetURL(shortenedURL)
-		if err != nil || originalURL == nil {
-			http.Error(w, "Not Found Your URL", http.StatusNotFound)
-			return
-		}
-
-		if flags.AnalyticsService {
-			updatedURL, err := services.UrlServiceInstance.IncrementClicks(shortenedURL)
-			if err != nil {
-				log.Error(err)
-				originalURL = updatedURL
-			}
-		}
-
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]any{
-			"originalUrl": originalURL.Original,
-		})
-	})
+	r.Get("/short/{id}", resolveShortURL(botDetector, flags.AnalyticsService, false))
+	r.Get("/api/short/{id}", resolveShortURL(botDetector, flags.AnalyticsService, true))
 
 	r.Group(func(r chi.Router) {
 		if flags.RateLimiting {
@@ -160,22 +493,152 @@ func main() {
 			))
 		}
 
-		r.Post("/create", func(w http.ResponseWriter, r *http.Request) {
+		// Passwords can be guessed, so unlocking gets a tight budget per
+		// client and per link on top of the general one.
+		var unlockLimits []func(http.Handler) http.Handler
+		if flags.RateLimiting {
+			unlockLimits = append(unlockLimits,
+				httprate.LimitByRealIP(10, time.Minute),
+				httprate.Limit(30, time.Minute, httprate.WithKeyFuncs(httprate.KeyByEndpoint)),
+			)
+		}
+
+		r.With(unlockLimits...).Post("/short/{id}/unlock", func(w http.ResponseWriter, r *http.Request) {
+			shortenedURL := chi.URLParam(r, "id")
+			asJSON := utils.WantsJSON(r) || strings.HasPrefix(r.Header.Get("Content-Type"), "application/json")
+
+			var password string
+			if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+				var body struct {
+					Password string `json:"password"`
+				}
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+					http.Error(w, "Invalid request payload", http.StatusBadRequest)
+					return
+				}
+				password = body.Password
+			} else {
+				password = r.FormValue("password")
+			}
+
+			err := services.UrlServiceInstance.CheckURLPassword(shortenedURL, password)
+			switch {
+			case errors.Is(err, services.ErrWrongPassword):
+				if asJSON {
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(http.StatusUnauthorized)
+					json.NewEncoder(w).Encode(map[string]any{"error": "invalid_password"})
+					return
+				}
+				renderUnlockPage(w, shortenedURL, true)
+				return
+			case errors.Is(err, services.ErrURLExpired):
+				http.Error(w, "URL has expired", http.StatusGone)
+				return
+			case err != nil:
+				http.Error(w, "Not Found Your URL", http.StatusNotFound)
+				return
+			}
+
+			expiresAt := time.Now().Add(unlockTokenTTL)
+			token := utils.SignToken(config.AppConfig.Server.TokenSecret, "unlock:"+shortenedURL, expiresAt)
+
+			if asJSON {
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(map[string]any{
+					"token":     token,
+					"expiresAt": expiresAt,
+				})
+				return
+			}
+
+			http.SetCookie(w, &http.Cookie{
+				Name:     unlockCookieName(shortenedURL),
+				Value:    token,
+				Path:     "/",
+				Expires:  expiresAt,
+				HttpOnly: true,
+				Secure:   utils.IsHTTPS(r),
+				SameSite: http.SameSiteLaxMode,
+			})
+			http.Redirect(w, r, "/short/"+shortenedURL, http.StatusSeeOther)
+		})
+
+		r.With(auth.RequireUser).Post("/create", func(w http.ResponseWriter, r *http.Request) {
 			url := r.URL.Query().Get("url")
-			userId := r.URL.Query().Get("userId")
+			userId := auth.UserID(r)
 			if url == "" {
 				http.Error(w, "Missing URL parameter", http.StatusBadRequest)
 				return
 			}
-			if userId == "" {
-				http.Error(w, "Missing UserId parameter", http.StatusBadRequest)
+
+			var opts services.CreateURLOptions
+			if redirectStatus := r.URL.Query().Get("redirectStatus"); redirectStatus != "" {
+				status, err := strconv.Atoi(redirectStatus)
+				if err != nil {
+					http.Error(w, "Invalid redirectStatus parameter", http.StatusBadRequest)
+					return
+				}
+				opts.RedirectStatus = status
+			}
+			opts.Alias = r.URL.Query().Get("alias")
+			// Only from the body: a password in the query string ends up in
+			// access logs.
+			opts.Password = r.PostFormValue("password")
+			opts.Title = r.URL.Query().Get("title")
+			opts.WorkspaceID = r.URL.Query().Get("workspace")
+			if maxClicks := r.URL.Query().Get("maxClicks"); maxClicks != "" {
+				limit, err := strconv.ParseInt(maxClicks, 10, 64)
+				if err != nil {
+					http.Error(w, "Invalid maxClicks parameter", http.StatusBadRequest)
+					return
+				}
+				opts.MaxClicks = limit
+			}
+			if r.URL.Query().Get("burn") == "true" {
+				if opts.MaxClicks > 1 {
+					http.Error(w, "burn and maxClicks are mutually exclusive", http.StatusBadRequest)
+					return
+				}
+				opts.MaxClicks = 1
+			}
+
+			expiresAt, never, err := utils.ParseExpiry(r.URL.Query().Get("expiresAt"), r.URL.Query().Get("ttl"), time.Now())
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			opts.ExpiresAt = expiresAt
+			opts.NeverExpires = never
+
+			newUrl, err := services.UrlServiceInstance.CreateURL(*port, url, userId, opts)
+			if errors.Is(err, services.ErrInvalidRedirectStatus) || errors.Is(err, services.ErrInvalidAlias) || errors.Is(err, services.ErrInvalidExpiry) ||
+				errors.Is(err, services.ErrInvalidMaxClicks) || errors.Is(err, services.ErrInvalidPassword) ||
+				errors.Is(err, services.ErrInvalidURL) || errors.Is(err, services.ErrInvalidTitle) ||
+				errors.Is(err, services.ErrInvalidUserID) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if errors.Is(err, services.ErrAliasTaken) {
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			}
+			if errors.Is(err, services.ErrWorkspaceNotFound) {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			if errors.Is(err, services.ErrWorkspaceForbidden) {
+				http.Error(w, err.Error(), http.StatusForbidden)
+				return
+			}
+			if errors.Is(err, services.ErrCodeExhausted) {
+				log.Warnf("Failed to create URL: %v", err)
+				http.Error(w, "No short code available, try again", http.StatusServiceUnavailable)
 				return
 			}
-			newUrl, err := services.UrlServiceInstance.CreateURL(*port, url, userId)
 			if err != nil {
 				log.Errorf("Failed to create URL: %v", err)
 				http.Error(w, "Failed to create URL", http.StatusInternalServerError)
-				log.Fatal(err)
 				return
 			}
 			w.WriteHeader(http.StatusCreated)
@@ -184,52 +647,774 @@ func main() {
 				"shortUrl": newUrl,
 			})
 		})
+
+		r.With(auth.RequireUser).Post("/create/bulk", func(w http.ResponseWriter, r *http.Request) {
+			userId := auth.UserID(r)
+
+			r.Body = http.MaxBytesReader(w, r.Body, maxBulkBodyBytes)
+			format, body, err := bulkBody(r)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			defer body.Close()
+
+			items, err := services.ParseBulkItems(format, body)
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			if errors.Is(err, services.ErrBulkTooLarge) {
+				http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+				return
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			results, err := services.UrlServiceInstance.CreateURLs(*port, userId, items)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			created := 0
+			for _, result := range results {
+				if result.Error == "" {
+					created++
+				}
+			}
+			status := http.StatusCreated
+			if created < len(results) {
+				status = http.StatusMultiStatus
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(map[string]any{
+				"created": created,
+				"failed":  len(results) - created,
+				"results": results,
+			})
+		})
 	})
 
-	r.Get("/history/{userId}", func(w http.ResponseWriter, r *http.Request) {
-		userId := chi.URLParam(r, "userId")
-		if userId == "" {
-			http.Error(w, "Missing UserId parameter", http.StatusBadRequest)
+	r.With(auth.RequireUser).Get("/history/{userId}", func(w http.ResponseWriter, r *http.Request) {
+		userId, ok := pathUser(w, r)
+		if !ok {
 			return
 		}
 
-		urls := services.UrlServiceInstance.GetURLs(userId)
+		params := r.URL.Query()
+		query := services.HistoryQuery{
+			WorkspaceID: params.Get("workspace"),
+			Sort:        params.Get("sort"),
+			Status:      params.Get("status"),
+			Search:      params.Get("q"),
+			Cursor:      params.Get("cursor"),
+		}
+		if limit := params.Get("limit"); limit != "" {
+			n, err := strconv.Atoi(limit)
+			if err != nil {
+				http.Error(w, "Invalid limit parameter", http.StatusBadRequest)
+				return
+			}
+			query.Limit = n
+		}
+		for name, target := range map[string]*time.Time{"from": &query.CreatedFrom, "to": &query.CreatedTo} {
+			if value := params.Get(name); value != "" {
+				t, err := time.Parse(time.RFC3339, value)
+				if err != nil {
+					http.Error(w, "Invalid "+name+" parameter, expected an RFC 3339 timestamp", http.StatusBadRequest)
+					return
+				}
+				*target = t
+			}
+		}
+
+		page, err := services.UrlServiceInstance.GetURLs(userId, query)
+		if errors.Is(err, services.ErrInvalidUserID) || errors.Is(err, services.ErrInvalidCursor) ||
+			errors.Is(err, services.ErrInvalidHistoryQuery) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, services.ErrWorkspaceNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Errorf("Failed to get history: %v", err)
+			http.Error(w, "Failed to get history", http.StatusInternalServerError)
+			return
+		}
 
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(urls)
+		json.NewEncoder(w).Encode(page)
 	})
 
-	r.Delete("/short/{id}", func(w http.ResponseWriter, r *http.Request) {
-		shortenedURL := chi.URLParam(r, "id")
-		if shortenedURL == "" {
-			http.Error(w, "Missing ID", http.StatusBadRequest)
+	r.With(auth.RequireUser).Get("/export/{userId}", func(w http.ResponseWriter, r *http.Request) {
+		userId, ok := pathUser(w, r)
+		if !ok {
 			return
 		}
 
-		err := services.UrlServiceInstance.DeleteURL(shortenedURL)
+		format := r.URL.Query().Get("format")
+		if format == "" {
+			format = "csv"
+		}
+		contentType, extension, err := services.ExportContentType(format)
 		if err != nil {
-			http.Error(w, "Failed to delete URL", http.StatusInternalServerError)
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("URL deleted successfully"))
+		filename := fmt.Sprintf("links-%s-%s.%s", userId, time.Now().UTC().Format("2006-01-02"), extension)
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+
+		// Headers are gone once the first page is written, so a failure
+		// mid-stream can only be logged and the response cut short.
+		if err := services.UrlServiceInstance.ExportURLs(userId, format, w); err != nil {
+			log.Errorf("Failed to export URLs for %s: %v", userId, err)
+		}
 	})
 
-	r.Post("/users", func(w http.ResponseWriter, r *http.Request) {
-		var user services.User
-		err := json.NewDecoder(r.Body).Decode(&user)
-		if err != nil {
-			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+	r.With(auth.RequireUser).Post("/import", func(w http.ResponseWriter, r *http.Request) {
+		userId := auth.UserID(r)
+
+		r.Body = http.MaxBytesReader(w, r.Body, maxImportBodyBytes)
+		var body io.Reader = r.Body
+		if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "multipart/form-data" {
+			file, _, err := r.FormFile("file")
+			if err != nil {
+				http.Error(w, "Missing file upload", http.StatusBadRequest)
+				return
+			}
+			defer file.Close()
+			body = file
+		}
+
+		report, err := services.UrlServiceInstance.ImportURLs(userId, body)
+		var maxBytesErr *http.MaxBytesError
+		switch {
+		case err == nil:
+		case errors.Is(err, services.ErrInvalidUserID) || errors.Is(err, services.ErrInvalidImport):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		case errors.Is(err, services.ErrUserNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		case errors.As(err, &maxBytesErr):
+			http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+			return
+		case report == nil:
+			log.Errorf("Failed to import for %s: %v", userId, err)
+			http.Error(w, "Failed to import", http.StatusInternalServerError)
+			return
+		default:
+			// Rows flushed before the failure stay imported; report them.
+			log.Errorf("Import for %s stopped early: %v", userId, err)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]any{
+				"error":  "import stopped early",
+				"report": report,
+			})
 			return
 		}
-		log.Printf("Received userId: %s", user.UserID)
-		if err := services.UrlServiceInstance.CreateUser(user.UserID); err != nil {
-			log.Error(err)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(report)
+	})
+
+	r.With(auth.RequireUser).Get("/search", func(w http.ResponseWriter, r *http.Request) {
+		params := r.URL.Query()
+		userId := auth.UserID(r)
+
+		query := services.SearchQuery{
+			UserID: userId,
+			Text:   params.Get("q"),
+			Cursor: params.Get("cursor"),
+		}
+		if limit := params.Get("limit"); limit != "" {
+			n, err := strconv.Atoi(limit)
+			if err != nil {
+				http.Error(w, "Invalid limit parameter", http.StatusBadRequest)
+				return
+			}
+			query.Limit = n
+		}
+		if params.Get("scope") == "all" {
+			if !isAdmin(userId) {
+				http.Error(w, "Only admins can search all users", http.StatusForbidden)
+				return
+			}
+			query.UserID = ""
+		}
+
+		page, err := services.UrlServiceInstance.SearchURLs(query)
+		if errors.Is(err, services.ErrInvalidUserID) || errors.Is(err, services.ErrInvalidCursor) ||
+			errors.Is(err, services.ErrSearchTooShort) {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		w.Write([]byte("User ID created successfully"))
+		if err != nil {
+			log.Errorf("Failed to search URLs: %v", err)
+			http.Error(w, "Failed to search URLs", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(page)
+	})
+
+	r.With(auth.RequireUser).Put("/short/{id}/expiration", func(w http.ResponseWriter, r *http.Request) {
+		shortenedURL := chi.URLParam(r, "id")
+		userId := auth.UserID(r)
+
+		expiresAt, never, err := utils.ParseExpiry(r.URL.Query().Get("expiresAt"), r.URL.Query().Get("ttl"), time.Now())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if expiresAt.IsZero() && !never {
+			http.Error(w, "Missing expiresAt or ttl parameter", http.StatusBadRequest)
+			return
+		}
+
+		err = services.UrlServiceInstance.UpdateExpiration(shortenedURL, userId, expiresAt, never)
+		if err != nil {
+			writeLinkError(w, err, "update expiration")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"shortUrl":  shortenedURL,
+			"expiredAt": utils.NullableTime(expiresAt),
+		})
+	})
+
+	r.With(auth.RequireUser).Patch("/short/{id}", func(w http.ResponseWriter, r *http.Request) {
+		shortenedURL := chi.URLParam(r, "id")
+		userId := auth.UserID(r)
+
+		var body struct {
+			URL            *string `json:"url"`
+			ExpiresAt      string  `json:"expiresAt"`
+			TTL            string  `json:"ttl"`
+			RedirectStatus *int    `json:"redirectStatus"`
+			MaxClicks      *int64  `json:"maxClicks"`
+			Password       *string `json:"password"`
+			Title          *string `json:"title"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+
+		expiresAt, never, err := utils.ParseExpiry(body.ExpiresAt, body.TTL, time.Now())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		updated, err := services.UrlServiceInstance.EditURL(shortenedURL, userId, services.URLPatch{
+			Original:       body.URL,
+			ExpiresAt:      expiresAt,
+			NeverExpires:   never,
+			RedirectStatus: body.RedirectStatus,
+			MaxClicks:      body.MaxClicks,
+			Password:       body.Password,
+			Title:          body.Title,
+		})
+		if err != nil {
+			writeLinkError(w, err, "update URL")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"shortUrl":       shortenedURL,
+			"originalUrl":    updated.Original,
+			"expiredAt":      utils.NullableTime(updated.ExpiredAt),
+			"redirectStatus": updated.RedirectStatus,
+			"maxClicks":      updated.MaxClicks,
+			"title":          updated.Title,
+			"protected":      updated.IsProtected(),
+		})
+	})
+
+	r.With(auth.RequireUser).Post("/short/{id}/transfer", func(w http.ResponseWriter, r *http.Request) {
+		shortenedURL := chi.URLParam(r, "id")
+
+		var target services.TransferTarget
+		if err := json.NewDecoder(r.Body).Decode(&target); err != nil {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+
+		updated, err := services.UrlServiceInstance.TransferURL(shortenedURL, auth.UserID(r), target)
+		if err != nil {
+			writeLinkError(w, err, "transfer URL")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"shortUrl":    shortenedURL,
+			"userId":      updated.UserID,
+			"workspaceId": updated.WorkspaceID,
+		})
+	})
+
+	r.With(auth.RequireUser).Get("/stats/{id}", func(w http.ResponseWriter, r *http.Request) {
+		shortenedURL := chi.URLParam(r, "id")
+
+		params := r.URL.Query()
+		query := services.StatsQuery{
+			Interval: params.Get("interval"),
+			TimeZone: params.Get("tz"),
+		}
+		for name, target := range map[string]*time.Time{"from": &query.From, "to": &query.To} {
+			if value := params.Get(name); value != "" {
+				t, err := time.Parse(time.RFC3339, value)
+				if err != nil {
+					http.Error(w, "Invalid "+name+" parameter, expected an RFC 3339 timestamp", http.StatusBadRequest)
+					return
+				}
+				*target = t
+			}
+		}
+
+		stats, err := services.UrlServiceInstance.GetStats(shortenedURL, auth.UserID(r), query)
+		if errors.Is(err, services.ErrInvalidStatsQuery) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			writeLinkError(w, err, "get stats")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(stats)
+	})
+
+	r.With(auth.RequireUser).Delete("/short/{id}", func(w http.ResponseWriter, r *http.Request) {
+		shortenedURL := chi.URLParam(r, "id")
+		if shortenedURL == "" {
+			http.Error(w, "Missing ID", http.StatusBadRequest)
+			return
+		}
+		userId := auth.UserID(r)
+
+		err := services.UrlServiceInstance.DeleteURL(shortenedURL, userId)
+		if err != nil {
+			writeLinkError(w, err, "delete URL")
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("URL deleted successfully"))
+	})
+
+	r.Post("/users", func(w http.ResponseWriter, r *http.Request) {
+		var user services.User
+		err := json.NewDecoder(r.Body).Decode(&user)
+		if err != nil {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+		log.Printf("Received userId: %s", user.UserID)
+		if err := services.UrlServiceInstance.CreateUser(user.UserID); err != nil {
+			if errors.Is(err, services.ErrUserExists) {
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			}
+			log.Error(err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// The first key is handed out with the account; it is the only way
+		// to authenticate as this user afterwards.
+		key, secret, err := services.UrlServiceInstance.CreateAPIKey(user.UserID, "default")
+		if err != nil {
+			log.Errorf("Failed to create API key: %v", err)
+			http.Error(w, "Failed to create API key", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]any{
+			"userId":   user.UserID,
+			"apiKey":   secret,
+			"apiKeyId": key.ID,
+		})
+	})
+
+	// Issues the first key of a user from before API keys existed. Only
+	// admins may do this, once they have checked who owns the userId.
+	r.With(auth.RequireUser).Post("/users/{userId}/claim", func(w http.ResponseWriter, r *http.Request) {
+		if !isAdmin(auth.UserID(r)) {
+			http.Error(w, "Only admins can claim users", http.StatusForbidden)
+			return
+		}
+
+		userID := chi.URLParam(r, "userId")
+		key, secret, err := services.UrlServiceInstance.ClaimLegacyUser(userID)
+		switch {
+		case errors.Is(err, services.ErrInvalidUserID):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		case errors.Is(err, services.ErrUserNotClaimable):
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		case err != nil:
+			log.Errorf("Failed to claim user: %v", err)
+			http.Error(w, "Failed to claim user", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]any{
+			"userId":   userID,
+			"apiKey":   secret,
+			"apiKeyId": key.ID,
+		})
+	})
+
+	// Moves every personal link of a user, e.g. when they leave the team.
+	// Admins may empty any account, everyone else only their own.
+	r.With(auth.RequireUser).Post("/users/{userId}/transfer", func(w http.ResponseWriter, r *http.Request) {
+		actorID := auth.UserID(r)
+		fromUserID := chi.URLParam(r, "userId")
+		if id, err := uuid.Parse(fromUserID); err != nil {
+			http.Error(w, services.ErrInvalidUserID.Error(), http.StatusBadRequest)
+			return
+		} else if id.String() != actorID && !isAdmin(actorID) {
+			http.Error(w, "Cannot transfer another user's links", http.StatusForbidden)
+			return
+		}
+
+		var target services.TransferTarget
+		if err := json.NewDecoder(r.Body).Decode(&target); err != nil {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+
+		transferred, err := services.UrlServiceInstance.TransferUserURLs(fromUserID, actorID, target)
+		if err != nil {
+			writeLinkError(w, err, "transfer URLs")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"transferred": transferred,
+		})
+	})
+
+	r.With(auth.RequireUser).Route("/api-keys", func(r chi.Router) {
+		r.Post("/", func(w http.ResponseWriter, r *http.Request) {
+			var body struct {
+				Name string `json:"name"`
+			}
+			if r.ContentLength != 0 {
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+					http.Error(w, "Invalid request payload", http.StatusBadRequest)
+					return
+				}
+			}
+
+			key, secret, err := services.UrlServiceInstance.CreateAPIKey(auth.UserID(r), body.Name)
+			if errors.Is(err, services.ErrInvalidAPIKeyName) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err != nil {
+				log.Errorf("Failed to create API key: %v", err)
+				http.Error(w, "Failed to create API key", http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(map[string]any{
+				"key":    secret,
+				"apiKey": key,
+			})
+		})
+
+		r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+			keys, err := services.UrlServiceInstance.ListAPIKeys(auth.UserID(r))
+			if err != nil {
+				log.Errorf("Failed to list API keys: %v", err)
+				http.Error(w, "Failed to list API keys", http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(keys)
+		})
+
+		r.Delete("/{keyId}", func(w http.ResponseWriter, r *http.Request) {
+			err := services.UrlServiceInstance.RevokeAPIKey(auth.UserID(r), chi.URLParam(r, "keyId"))
+			if errors.Is(err, services.ErrAPIKeyNotFound) {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				log.Errorf("Failed to revoke API key: %v", err)
+				http.Error(w, "Failed to revoke API key", http.StatusInternalServerError)
+				return
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+		})
+	})
+
+	r.With(auth.RequireUser).Route("/workspaces", func(r chi.Router) {
+		r.Post("/", func(w http.ResponseWriter, r *http.Request) {
+			var body struct {
+				Name string `json:"name"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				http.Error(w, "Invalid request payload", http.StatusBadRequest)
+				return
+			}
+
+			workspace, err := services.UrlServiceInstance.CreateWorkspace(auth.UserID(r), body.Name)
+			if err != nil {
+				writeWorkspaceError(w, err, "create workspace")
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(workspace)
+		})
+
+		r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+			workspaces, err := services.UrlServiceInstance.ListWorkspaces(auth.UserID(r))
+			if err != nil {
+				writeWorkspaceError(w, err, "list workspaces")
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(workspaces)
+		})
+
+		r.Get("/{workspaceId}/members", func(w http.ResponseWriter, r *http.Request) {
+			members, err := services.UrlServiceInstance.ListWorkspaceMembers(auth.UserID(r), chi.URLParam(r, "workspaceId"))
+			if err != nil {
+				writeWorkspaceError(w, err, "list workspace members")
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(members)
+		})
+
+		r.Put("/{workspaceId}/members/{memberId}", func(w http.ResponseWriter, r *http.Request) {
+			var body struct {
+				Role string `json:"role"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				http.Error(w, "Invalid request payload", http.StatusBadRequest)
+				return
+			}
+
+			err := services.UrlServiceInstance.SetWorkspaceMember(auth.UserID(r), chi.URLParam(r, "workspaceId"), chi.URLParam(r, "memberId"), body.Role)
+			if err != nil {
+				writeWorkspaceError(w, err, "update workspace member")
+				return
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+		})
+
+		r.Delete("/{workspaceId}/members/{memberId}", func(w http.ResponseWriter, r *http.Request) {
+			err := services.UrlServiceInstance.RemoveWorkspaceMember(auth.UserID(r), chi.URLParam(r, "workspaceId"), chi.URLParam(r, "memberId"))
+			if err != nil {
+				writeWorkspaceError(w, err, "remove workspace member")
+				return
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+		})
+	})
+
+	r.Route("/auth", func(r chi.Router) {
+		// Login and reset are the obvious targets for guessing, so they get a
+		// much tighter per-IP budget than the rest of the API.
+		if flags.RateLimiting {
+			r.Use(httprate.LimitByIP(20, time.Minute))
+		}
+
+		r.Post("/signup", func(w http.ResponseWriter, r *http.Request) {
+			var body struct {
+				Email    string `json:"email"`
+				Password string `json:"password"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				http.Error(w, "Invalid request payload", http.StatusBadRequest)
+				return
+			}
+
+			user, tokens, err := services.UrlServiceInstance.SignUp(body.Email, body.Password)
+			if err != nil {
+				writeAccountError(w, err, "sign up")
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(map[string]any{
+				"user":   user,
+				"tokens": tokens,
+			})
+		})
+
+		r.Post("/login", func(w http.ResponseWriter, r *http.Request) {
+			var body struct {
+				Email    string `json:"email"`
+				Password string `json:"password"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				http.Error(w, "Invalid request payload", http.StatusBadRequest)
+				return
+			}
+
+			tokens, err := services.UrlServiceInstance.Login(body.Email, body.Password)
+			if err != nil {
+				writeAccountError(w, err, "log in")
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(tokens)
+		})
+
+		r.Post("/refresh", func(w http.ResponseWriter, r *http.Request) {
+			var body struct {
+				RefreshToken string `json:"refreshToken"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				http.Error(w, "Invalid request payload", http.StatusBadRequest)
+				return
+			}
+
+			tokens, err := services.UrlServiceInstance.RefreshSession(body.RefreshToken)
+			if err != nil {
+				writeAccountError(w, err, "refresh session")
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(tokens)
+		})
+
+		r.With(auth.RequireUser).Post("/logout", func(w http.ResponseWriter, r *http.Request) {
+			sessionID := auth.SessionID(r)
+			if sessionID == "" {
+				http.Error(w, "Logout needs a session access token, not an API key", http.StatusBadRequest)
+				return
+			}
+
+			if err := services.UrlServiceInstance.Logout(auth.UserID(r), sessionID); err != nil {
+				writeAccountError(w, err, "log out")
+				return
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+		})
+
+		r.Post("/password/forgot", func(w http.ResponseWriter, r *http.Request) {
+			var body struct {
+				Email string `json:"email"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				http.Error(w, "Invalid request payload", http.StatusBadRequest)
+				return
+			}
+
+			if err := services.UrlServiceInstance.RequestPasswordReset(body.Email); err != nil {
+				writeAccountError(w, err, "request password reset")
+				return
+			}
+
+			// Same answer whether or not the email has an account.
+			w.WriteHeader(http.StatusAccepted)
+		})
+
+		r.Post("/password/reset", func(w http.ResponseWriter, r *http.Request) {
+			var body struct {
+				Token    string `json:"token"`
+				Password string `json:"password"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				http.Error(w, "Invalid request payload", http.StatusBadRequest)
+				return
+			}
+
+			if err := services.UrlServiceInstance.ResetPassword(body.Token, body.Password); err != nil {
+				writeAccountError(w, err, "reset password")
+				return
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+		})
+
+		r.Get("/oidc/login", func(w http.ResponseWriter, r *http.Request) {
+			authURL, err := services.UrlServiceInstance.BeginOIDCLogin()
+			if err != nil {
+				writeAccountError(w, err, "start single sign-on")
+				return
+			}
+
+			http.Redirect(w, r, authURL, http.StatusFound)
+		})
+
+		r.Get("/oidc/callback", func(w http.ResponseWriter, r *http.Request) {
+			query := r.URL.Query()
+			if providerErr := query.Get("error"); providerErr != "" {
+				http.Error(w, "Sign-in failed: "+providerErr+" "+query.Get("error_description"), http.StatusBadRequest)
+				return
+			}
+			if query.Get("code") == "" || query.Get("state") == "" {
+				http.Error(w, "Missing code or state", http.StatusBadRequest)
+				return
+			}
+
+			user, tokens, err := services.UrlServiceInstance.CompleteOIDCLogin(query.Get("code"), query.Get("state"))
+			if err != nil {
+				writeAccountError(w, err, "complete single sign-on")
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]any{
+				"user":   user,
+				"tokens": tokens,
+			})
+		})
+	})
+
+	r.With(auth.RequireUser).Get("/users/me", func(w http.ResponseWriter, r *http.Request) {
+		user, err := services.UrlServiceInstance.GetUser(auth.UserID(r))
+		if err != nil {
+			writeAccountError(w, err, "get user")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(user)
 	})
 
 	r.NotFound(func(w http.ResponseWriter, r *http.Request) {
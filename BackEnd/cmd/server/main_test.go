@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"shorten-url/backend/pkg/bots"
+	"shorten-url/backend/pkg/config"
+	"shorten-url/backend/pkg/services"
+	"shorten-url/backend/pkg/stores"
+	"shorten-url/backend/pkg/utils"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-chi/chi/v5"
+	"github.com/redis/go-redis/v9"
+)
+
+const browserUserAgent = "Mozilla/5.0 (X11; Linux x86_64; rv:128.0) Gecko/20100101 Firefox/128.0"
+
+// newRedirectRouter serves the given links from a miniredis cache, so the
+// redirect handler runs without Postgres.
+func newRedirectRouter(t *testing.T, links map[string]services.CachedURL) (http.Handler, *miniredis.Miniredis) {
+	t.Helper()
+	config.AppConfig.Server.RedirectStatus = http.StatusFound
+
+	mr := miniredis.RunT(t)
+	redisClient := redis.NewClusterClient(&redis.ClusterOptions{Addrs: []string{mr.Addr()}})
+	t.Cleanup(func() { redisClient.Close() })
+	for code, link := range links {
+		data, err := json.Marshal(link)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mr.Set(code, string(data))
+	}
+	services.NewUrlService(redisClient, &stores.Postgres{}, nil, nil)
+
+	detector, err := bots.NewDetector("")
+	if err != nil {
+		t.Fatalf("NewDetector: %v", err)
+	}
+	r := chi.NewRouter()
+	r.Get("/short/{id}", resolveShortURL(detector, false, false))
+	return r, mr
+}
+
+func TestBotsDoNotGetLimitedLinks(t *testing.T) {
+	const target = "https://example.com/secret"
+	router, mr := newRedirectRouter(t, map[string]services.CachedURL{
+		"limited":   {Original: target, CreatedAt: time.Now(), MaxClicks: 2},
+		"unlimited": {Original: target, CreatedAt: time.Now()},
+	})
+
+	tests := []struct {
+		name       string
+		code       string
+		header     http.Header
+		wantStatus int
+	}{
+		{"curl on a limited link", "limited", http.Header{"User-Agent": {"curl/8.5.0"}}, http.StatusForbidden},
+		{"python on a limited link", "limited", http.Header{"User-Agent": {"python-requests/2.32.3"}}, http.StatusForbidden},
+		{"no user agent on a limited link", "limited", http.Header{"User-Agent": {""}}, http.StatusForbidden},
+		{"prefetch on a limited link", "limited", http.Header{"User-Agent": {browserUserAgent}, "Purpose": {"prefetch"}}, http.StatusForbidden},
+		{"unfurler on an unlimited link", "unlimited", http.Header{"User-Agent": {"Slackbot-LinkExpanding 1.0"}}, http.StatusFound},
+		{"person on a limited link", "limited", http.Header{"User-Agent": {browserUserAgent}}, http.StatusFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/short/"+tt.code, nil)
+			req.Header = tt.header
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			location := rec.Header().Get("Location")
+			if tt.wantStatus == http.StatusFound && location != target {
+				t.Errorf("Location = %q, want %q", location, target)
+			}
+			if tt.wantStatus != http.StatusFound && (location != "" || strings.Contains(rec.Body.String(), target)) {
+				t.Errorf("refused response reveals the target: Location %q, body %q", location, rec.Body)
+			}
+			// Only people use up the clicks of a limited link.
+			if clicks, _ := mr.Get("clicks:limited"); tt.wantStatus == http.StatusForbidden && clicks != "" {
+				t.Errorf("a bot used up a click of the limited link, counter at %s", clicks)
+			}
+		})
+	}
+}
+
+func TestIsUnlocked(t *testing.T) {
+	config.AppConfig.Server.TokenSecret = []byte("test secret")
+	sign := func(subject string, ttl time.Duration) string {
+		return utils.SignToken(config.AppConfig.Server.TokenSecret, subject, time.Now().Add(ttl))
+	}
+
+	tests := []struct {
+		name   string
+		header string
+		cookie *http.Cookie
+		want   bool
+	}{
+		{"token header", sign("unlock:abc", time.Minute), nil, true},
+		{"unlock cookie", "", &http.Cookie{Name: unlockCookieName("abc"), Value: sign("unlock:abc", time.Minute)}, true},
+		{"token of another link", sign("unlock:xyz", time.Minute), nil, false},
+		{"cookie of another link", "", &http.Cookie{Name: unlockCookieName("xyz"), Value: sign("unlock:xyz", time.Minute)}, false},
+		{"token with another purpose", sign("abc", time.Minute), nil, false},
+		{"expired token", sign("unlock:abc", -time.Second), nil, false},
+		{"token signed with another secret", utils.SignToken([]byte("other secret"), "unlock:abc", time.Now().Add(time.Minute)), nil, false},
+		{"no token", "", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/short/abc", nil)
+			if tt.header != "" {
+				req.Header.Set("X-Unlock-Token", tt.header)
+			}
+			if tt.cookie != nil {
+				req.AddCookie(tt.cookie)
+			}
+			if got := isUnlocked(req, "abc"); got != tt.want {
+				t.Errorf("isUnlocked = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBulkBodyFormat(t *testing.T) {
+	upload := func(filename string) (string, string) {
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		file, _ := form.CreateFormFile("file", filename)
+		file.Write([]byte("url\nhttps://a.example\n"))
+		form.Close()
+		return body.String(), form.FormDataContentType()
+	}
+	csvUpload, csvUploadType := upload("links.CSV")
+	jsonlUpload, jsonlUploadType := upload("links.jsonl")
+
+	tests := []struct {
+		name        string
+		query       string
+		contentType string
+		body        string
+		want        string
+	}{
+		{"json content type", "", "application/json; charset=utf-8", "[]", "json"},
+		{"ndjson content type", "", "application/x-ndjson", "", "ndjson"},
+		{"csv content type", "", "text/csv", "", "csv"},
+		{"format parameter wins", "?format=csv", "application/json", "", "csv"},
+		{"jsonl parameter", "?format=jsonl", "", "", "ndjson"},
+		{"csv upload", "", csvUploadType, csvUpload, "csv"},
+		{"jsonl upload", "", jsonlUploadType, jsonlUpload, "ndjson"},
+		{"unknown content type", "", "application/xml", "", "application/xml"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/create/bulk"+tt.query, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			format, body, err := bulkBody(req)
+			if err != nil {
+				t.Fatalf("bulkBody: %v", err)
+			}
+			body.Close()
+			if format != tt.want {
+				t.Errorf("format = %q, want %q", format, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package bots
+
+import (
+	_ "embed"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+//go:embed rules.txt
+var defaultRules string
+
+// Detector recognizes automated clients by their User-Agent and by the
+// headers browsers send when they only prefetch a page.
+type Detector struct {
+	path string
+
+	mu      sync.RWMutex
+	pattern *regexp.Regexp
+	modTime time.Time
+}
+
+// NewDetector loads the signatures in path, or the built-in ones when path
+// is empty.
+func NewDetector(path string) (*Detector, error) {
+	d := &Detector{path: path}
+	if path == "" {
+		pattern, err := compileRules(defaultRules)
+		if err != nil {
+			return nil, fmt.Errorf("built-in bot rules: %v", err)
+		}
+		d.pattern = pattern
+		return d, nil
+	}
+	if err := d.Reload(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// Reload rereads the rules file if it changed since it was last read. A
+// file that fails to parse keeps the previous rules in place.
+func (d *Detector) Reload() error {
+	if d.path == "" {
+		return nil
+	}
+	info, err := os.Stat(d.path)
+	if err != nil {
+		return fmt.Errorf("failed to read bot rules: %v", err)
+	}
+
+	d.mu.RLock()
+	unchanged := info.ModTime().Equal(d.modTime)
+	d.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	data, err := os.ReadFile(d.path)
+	if err != nil {
+		return fmt.Errorf("failed to read bot rules: %v", err)
+	}
+	pattern, err := compileRules(string(data))
+	if err != nil {
+		return fmt.Errorf("%s: %v", d.path, err)
+	}
+
+	d.mu.Lock()
+	d.pattern = pattern
+	d.modTime = info.ModTime()
+	d.mu.Unlock()
+	return nil
+}
+
+// Classify returns why the request looks automated, or "" for a person.
+func (d *Detector) Classify(r *http.Request) string {
+	userAgent := r.UserAgent()
+	if strings.TrimSpace(userAgent) == "" {
+		return "no user agent"
+	}
+	if IsPrefetch(r.Header) {
+		return "prefetch"
+	}
+
+	d.mu.RLock()
+	pattern := d.pattern
+	d.mu.RUnlock()
+	if match := pattern.FindString(userAgent); match != "" {
+		return "user agent " + match
+	}
+	return ""
+}
+
+// IsPrefetch reports whether the browser is loading the link speculatively
+// rather than because someone followed it.
+func IsPrefetch(header http.Header) bool {
+	for _, name := range []string{"Sec-Purpose", "Purpose", "X-Purpose", "X-Moz"} {
+		value := strings.ToLower(header.Get(name))
+		if strings.Contains(value, "prefetch") || strings.Contains(value, "preview") {
+			return true
+		}
+	}
+	return false
+}
+
+func compileRules(rules string) (*regexp.Regexp, error) {
+	var patterns []string
+	for i, line := range strings.Split(rules, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if _, err := regexp.Compile(line); err != nil {
+			return nil, fmt.Errorf("line %d: %v", i+1, err)
+		}
+		patterns = append(patterns, "(?:"+line+")")
+	}
+	if len(patterns) == 0 {
+		// Matches nothing, so every client counts as a person.
+		return regexp.MustCompile(`[^\s\S]`), nil
+	}
+	return regexp.Compile("(?i)" + strings.Join(patterns, "|"))
+}
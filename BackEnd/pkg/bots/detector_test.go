@@ -0,0 +1,180 @@
+package bots
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const chromeUserAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/129.0.0.0 Safari/537.36"
+
+func newRequest(userAgent string, header map[string]string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/abc", nil)
+	r.Header.Set("User-Agent", userAgent)
+	for name, value := range header {
+		r.Header.Set(name, value)
+	}
+	return r
+}
+
+func TestClassify(t *testing.T) {
+	detector, err := NewDetector("")
+	if err != nil {
+		t.Fatalf("NewDetector: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		userAgent string
+		header    map[string]string
+		want      string
+	}{
+		{"browser", chromeUserAgent, nil, ""},
+		{"robotics app is not a bot", "RobotArm/2.1 (iPhone; iOS 18.0)", nil, ""},
+		{"no user agent", "", nil, "no user agent"},
+		{"blank user agent", "   ", nil, "no user agent"},
+		{"search engine", "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)", nil, "user agent Googlebot"},
+		{"unfurler", "Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)", nil, "user agent Slackbot"},
+		{"case-insensitive", "FACEBOOKEXTERNALHIT/1.1", nil, "user agent FACEBOOKEXTERNALHIT"},
+		{"anchored tool", "curl/8.5.0", nil, "user agent curl/"},
+		{"tool name inside a browser agent", chromeUserAgent + " curl/8.5.0", nil, ""},
+		{"chrome prefetch", chromeUserAgent, map[string]string{"Sec-Purpose": "prefetch;prerender"}, "prefetch"},
+		{"safari preview", chromeUserAgent, map[string]string{"X-Purpose": "preview"}, "prefetch"},
+		{"firefox prefetch", chromeUserAgent, map[string]string{"X-Moz": "prefetch"}, "prefetch"},
+		{"prefetching bot", "Googlebot/2.1", map[string]string{"Purpose": "prefetch"}, "prefetch"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := detector.Classify(newRequest(tt.userAgent, tt.header)); got != tt.want {
+				t.Errorf("Classify(%q) = %q, want %q", tt.userAgent, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsPrefetch(t *testing.T) {
+	tests := []struct {
+		name   string
+		header http.Header
+		want   bool
+	}{
+		{"no purpose", http.Header{}, false},
+		{"sec-purpose prefetch", http.Header{"Sec-Purpose": {"prefetch"}}, true},
+		{"sec-purpose prerender", http.Header{"Sec-Purpose": {"prefetch;prerender"}}, true},
+		{"upper case", http.Header{"Purpose": {"Prefetch"}}, true},
+		{"preview", http.Header{"X-Purpose": {"preview"}}, true},
+		{"other purpose", http.Header{"Sec-Purpose": {"navigate"}}, false},
+		{"unrelated header", http.Header{"Accept": {"prefetch"}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsPrefetch(tt.header); got != tt.want {
+				t.Errorf("IsPrefetch(%v) = %v, want %v", tt.header, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   string
+		match   []string
+		noMatch []string
+		wantErr string
+	}{
+		{
+			name:    "comments and blank lines",
+			rules:   "# comment\n\n  examplebot  \n#otherbot\n",
+			match:   []string{"ExampleBot/1.0"},
+			noMatch: []string{"otherbot", "# comment"},
+		},
+		{
+			name:    "alternatives stay grouped",
+			rules:   "^alpha|beta$\ngamma",
+			match:   []string{"alpha/1", "x beta", "a gamma b"},
+			noMatch: []string{"x alpha", "beta x"},
+		},
+		{
+			name:    "no rules",
+			rules:   "# nothing here\n",
+			noMatch: []string{"", "Googlebot", chromeUserAgent},
+		},
+		{
+			name:    "invalid rule",
+			rules:   "fine\n\nbroken(\n",
+			wantErr: "line 3:",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pattern, err := compileRules(tt.rules)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("compileRules error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("compileRules: %v", err)
+			}
+			for _, s := range tt.match {
+				if !pattern.MatchString(s) {
+					t.Errorf("%q does not match", s)
+				}
+			}
+			for _, s := range tt.noMatch {
+				if pattern.MatchString(s) {
+					t.Errorf("%q matches", s)
+				}
+			}
+		})
+	}
+}
+
+func TestReloadKeepsRulesOnBadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.txt")
+	write := func(rules string, modTime time.Time) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(rules), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	start := time.Now().Add(-time.Hour)
+	write("examplebot\n", start)
+
+	detector, err := NewDetector(path)
+	if err != nil {
+		t.Fatalf("NewDetector: %v", err)
+	}
+	if got := detector.Classify(newRequest("ExampleBot/1.0", nil)); got == "" {
+		t.Error("rule from the file is not applied")
+	}
+
+	write("otherbot\n", start.Add(time.Minute))
+	if err := detector.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if got := detector.Classify(newRequest("ExampleBot/1.0", nil)); got != "" {
+		t.Errorf("removed rule still applies: %q", got)
+	}
+
+	write("broken(\n", start.Add(2*time.Minute))
+	if err := detector.Reload(); err == nil {
+		t.Error("Reload accepted an invalid rule")
+	}
+	if got := detector.Classify(newRequest("OtherBot/1.0", nil)); got == "" {
+		t.Error("previous rules were dropped after a failed reload")
+	}
+
+	if _, err := NewDetector(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Error("NewDetector accepted a missing rules file")
+	}
+}
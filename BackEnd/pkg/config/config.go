@@ -1,8 +1,11 @@
 package config
 
 import (
+	"crypto/rand"
 	"os"
+	"strconv"
 	"strings"
+	"shorten-url/backend/pkg/utils"
 	"github.com/joho/godotenv"
 	log "github.com/sirupsen/logrus"
 )
@@ -12,10 +15,19 @@ type Config struct {
 	Database DatabaseConfig
 	Redis    RedisConfig
 	Kafka    KafkaConfig
+	Code     CodeConfig
+	Mail     MailConfig
+	OIDC     OIDCConfig
+	Bots     BotConfig
 }
 
 type ServerConfig struct {
-	Ports []string
+	Ports          []string
+	RedirectStatus int
+	// Signs tokens handed to clients; must be shared by every instance.
+	TokenSecret []byte
+	// Users allowed to search across every account.
+	AdminUserIDs []string
 }
 
 type DatabaseConfig struct {
@@ -36,6 +48,40 @@ type RedisConfig struct {
 	ClusterNodes []string
 }
 
+type CodeConfig struct {
+	Generator string
+	Alphabet  string
+	Length    int
+}
+
+type MailConfig struct {
+	Driver   string
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+	// Page that takes the reset token, e.g. https://example.com/reset?token=
+	ResetURL string
+}
+
+// OIDCConfig describes the single sign-on provider; SSO is off while Issuer
+// is empty.
+type OIDCConfig struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// Must point at /auth/oidc/callback and be registered with the provider.
+	RedirectURL string
+	Scopes      []string
+}
+
+type BotConfig struct {
+	// Replaces the built-in user-agent signatures and is reread when it
+	// changes; empty uses the built-in ones.
+	RulesFile string
+}
+
 type KafkaConfig struct {
 	BrokerURL string
 	Topic     string
@@ -56,14 +102,40 @@ func LoadEnv() *Config {
 		Database: loadDatabaseConfig(),
 		Redis:    loadRedisConfig(),
 		Kafka:    loadKafkaConfig(),
+		Code:     loadCodeConfig(),
+		Mail:     loadMailConfig(),
+		OIDC:     loadOIDCConfig(),
+		Bots:     BotConfig{RulesFile: os.Getenv("BOT_RULES_FILE")},
 	}
 
 	return &AppConfig
 }
 
 func loadServerConfig() ServerConfig {
+	redirectStatus, err := strconv.Atoi(os.Getenv("REDIRECT_STATUS"))
+	if err != nil || !utils.IsRedirectStatus(redirectStatus) {
+		redirectStatus = 302
+	}
+
+	tokenSecret := []byte(os.Getenv("TOKEN_SECRET"))
+	if len(tokenSecret) == 0 {
+		log.Warn("TOKEN_SECRET is not set, using a random per-process secret")
+		tokenSecret = make([]byte, 32)
+		rand.Read(tokenSecret)
+	}
+
+	var adminUserIDs []string
+	for _, id := range strings.Split(os.Getenv("ADMIN_USER_IDS"), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			adminUserIDs = append(adminUserIDs, strings.ToLower(id))
+		}
+	}
+
 	return ServerConfig{
-		Ports: strings.Split(os.Getenv("SERVER_PORT"), ","),
+		Ports:          strings.Split(os.Getenv("SERVER_PORT"), ","),
+		RedirectStatus: redirectStatus,
+		TokenSecret:    tokenSecret,
+		AdminUserIDs:   adminUserIDs,
 	}
 }
 
@@ -93,6 +165,48 @@ func loadRedisConfig() RedisConfig {
 	}
 }
 
+func loadCodeConfig() CodeConfig {
+	length, err := strconv.Atoi(os.Getenv("CODE_LENGTH"))
+	if err != nil {
+		length = utils.DefaultCodeLength
+	}
+
+	return CodeConfig{
+		Generator: os.Getenv("CODE_GENERATOR"),
+		Alphabet:  os.Getenv("CODE_ALPHABET"),
+		Length:    length,
+	}
+}
+
+func loadMailConfig() MailConfig {
+	return MailConfig{
+		Driver:   os.Getenv("MAIL_DRIVER"),
+		Host:     os.Getenv("SMTP_HOST"),
+		Port:     os.Getenv("SMTP_PORT"),
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     os.Getenv("MAIL_FROM"),
+		ResetURL: os.Getenv("PASSWORD_RESET_URL"),
+	}
+}
+
+func loadOIDCConfig() OIDCConfig {
+	var scopes []string
+	for _, scope := range strings.Split(os.Getenv("OIDC_SCOPES"), ",") {
+		if scope = strings.TrimSpace(scope); scope != "" {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	return OIDCConfig{
+		Issuer:       os.Getenv("OIDC_ISSUER"),
+		ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+		ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+		RedirectURL:  os.Getenv("OIDC_REDIRECT_URL"),
+		Scopes:       scopes,
+	}
+}
+
 func loadKafkaConfig() KafkaConfig {
 	return KafkaConfig{
 		BrokerURL: os.Getenv("KAFKA_BROKER_URL"),
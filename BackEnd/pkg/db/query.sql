@@ -1,5 +1,5 @@
 -- name: GetOriginated :one
-SELECT shortened, original, clicks, created_at, expired_at, user_id
+SELECT shortened, original, clicks, created_at, expired_at, user_id, redirect_status, max_clicks, password_hash, title, workspace_id
 FROM urls 
 WHERE shortened = $1;
 
@@ -8,11 +8,6 @@ INSERT INTO urls (shortened, original, clicks, created_at, expired_at, user_id)
 VALUES ($1, $2, 0, DEFAULT, DEFAULT, $3)
 RETURNING *;
 
--- name: IncrementClicks :exec
-UPDATE urls 
-SET clicks = clicks + 1 
-WHERE shortened = $1;
-
 -- name: GetClicks :one
 SELECT clicks 
 FROM urls 
@@ -27,12 +22,72 @@ WHERE shortened = $1;
 -- name: InsertUser :exec
 INSERT INTO users (user_id) VALUES ($1);
 
+-- name: UserExists :one
+SELECT EXISTS(SELECT 1 FROM users WHERE user_id = $1) AS exists;
+
+-- name: ClaimLegacyUser :one
+UPDATE users
+SET legacy_claimed_at = CURRENT_TIMESTAMP
+WHERE user_id = $1 AND legacy_claimed_at IS NULL AND email IS NULL AND password_hash = ''
+  AND NOT EXISTS(SELECT 1 FROM api_keys WHERE user_id = $1)
+  AND NOT EXISTS(SELECT 1 FROM user_identities WHERE user_id = $1)
+  AND NOT EXISTS(SELECT 1 FROM sessions WHERE user_id = $1)
+RETURNING user_id;
+
 
 -- name: GetURLsByUser :many
-SELECT shortened, original, clicks, created_at, expired_at
-FROM urls 
-WHERE user_id = $1
-ORDER BY created_at DESC;
+SELECT shortened, original, clicks, created_at, expired_at, user_id, redirect_status, max_clicks, password_hash, title, workspace_id
+FROM urls
+WHERE user_id = @user_id
+  AND (sqlc.narg('cursor_code')::text IS NULL OR (created_at, shortened) < (sqlc.narg('cursor_created_at')::timestamptz, sqlc.narg('cursor_code')::text))
+ORDER BY created_at DESC, shortened DESC
+LIMIT @page_size;
+
+
+-- name: CountUserURLs :one
+SELECT COUNT(*)
+FROM urls
+WHERE ((user_id = sqlc.narg('user_id')::uuid AND workspace_id IS NULL) OR workspace_id = sqlc.narg('workspace_id')::uuid)
+  AND (sqlc.narg('active')::bool IS NULL OR (expired_at IS NULL OR expired_at > CURRENT_TIMESTAMP) = sqlc.narg('active')::bool)
+  AND (sqlc.narg('created_from')::timestamptz IS NULL OR created_at >= sqlc.narg('created_from')::timestamptz)
+  AND (sqlc.narg('created_to')::timestamptz IS NULL OR created_at < sqlc.narg('created_to')::timestamptz)
+  AND (sqlc.narg('search')::text IS NULL OR original ILIKE '%' || sqlc.narg('search')::text || '%');
+
+-- name: ListUserURLsByCreated :many
+SELECT shortened, original, clicks, created_at, expired_at, user_id, redirect_status, max_clicks, password_hash, title, workspace_id
+FROM urls
+WHERE ((user_id = sqlc.narg('user_id')::uuid AND workspace_id IS NULL) OR workspace_id = sqlc.narg('workspace_id')::uuid)
+  AND (sqlc.narg('active')::bool IS NULL OR (expired_at IS NULL OR expired_at > CURRENT_TIMESTAMP) = sqlc.narg('active')::bool)
+  AND (sqlc.narg('created_from')::timestamptz IS NULL OR created_at >= sqlc.narg('created_from')::timestamptz)
+  AND (sqlc.narg('created_to')::timestamptz IS NULL OR created_at < sqlc.narg('created_to')::timestamptz)
+  AND (sqlc.narg('search')::text IS NULL OR original ILIKE '%' || sqlc.narg('search')::text || '%')
+  AND (sqlc.narg('cursor_code')::text IS NULL OR (created_at, shortened) < (sqlc.narg('cursor_created_at')::timestamptz, sqlc.narg('cursor_code')::text))
+ORDER BY created_at DESC, shortened DESC
+LIMIT @page_size;
+
+-- name: ListUserURLsByClicks :many
+SELECT shortened, original, clicks, created_at, expired_at, user_id, redirect_status, max_clicks, password_hash, title, workspace_id
+FROM urls
+WHERE ((user_id = sqlc.narg('user_id')::uuid AND workspace_id IS NULL) OR workspace_id = sqlc.narg('workspace_id')::uuid)
+  AND (sqlc.narg('active')::bool IS NULL OR (expired_at IS NULL OR expired_at > CURRENT_TIMESTAMP) = sqlc.narg('active')::bool)
+  AND (sqlc.narg('created_from')::timestamptz IS NULL OR created_at >= sqlc.narg('created_from')::timestamptz)
+  AND (sqlc.narg('created_to')::timestamptz IS NULL OR created_at < sqlc.narg('created_to')::timestamptz)
+  AND (sqlc.narg('search')::text IS NULL OR original ILIKE '%' || sqlc.narg('search')::text || '%')
+  AND (sqlc.narg('cursor_code')::text IS NULL OR (COALESCE(clicks, 0), shortened) < (sqlc.narg('cursor_clicks')::bigint, sqlc.narg('cursor_code')::text))
+ORDER BY COALESCE(clicks, 0) DESC, shortened DESC
+LIMIT @page_size;
+
+-- name: ListUserURLsByExpiry :many
+SELECT shortened, original, clicks, created_at, expired_at, user_id, redirect_status, max_clicks, password_hash, title, workspace_id
+FROM urls
+WHERE ((user_id = sqlc.narg('user_id')::uuid AND workspace_id IS NULL) OR workspace_id = sqlc.narg('workspace_id')::uuid)
+  AND (sqlc.narg('active')::bool IS NULL OR (expired_at IS NULL OR expired_at > CURRENT_TIMESTAMP) = sqlc.narg('active')::bool)
+  AND (sqlc.narg('created_from')::timestamptz IS NULL OR created_at >= sqlc.narg('created_from')::timestamptz)
+  AND (sqlc.narg('created_to')::timestamptz IS NULL OR created_at < sqlc.narg('created_to')::timestamptz)
+  AND (sqlc.narg('search')::text IS NULL OR original ILIKE '%' || sqlc.narg('search')::text || '%')
+  AND (sqlc.narg('cursor_code')::text IS NULL OR (COALESCE(expired_at, 'infinity'), shortened) > (sqlc.narg('cursor_expired_at')::timestamptz, sqlc.narg('cursor_code')::text))
+ORDER BY COALESCE(expired_at, 'infinity') ASC, shortened ASC
+LIMIT @page_size;
 
 
 -- name: DeleteExpiredURLs :exec
@@ -59,21 +114,293 @@ UPDATE urls
 SET original = $2
 WHERE shortened = $1;
 
+-- name: UpdateURLSettings :exec
+UPDATE urls
+SET redirect_status = $2, max_clicks = $3, password_hash = $4, title = $5
+WHERE shortened = $1;
+
 -- name: DeleteURL :exec
 DELETE FROM urls 
 WHERE shortened = $1;
 
+-- name: ShortenedExists :one
+SELECT EXISTS(SELECT 1 FROM urls WHERE shortened = $1) AS exists;
+
+-- name: DeleteUserURL :execrows
+DELETE FROM urls
+WHERE shortened = $1 AND user_id = $2;
+
 -- name: SearchByOriginalURL :many
-SELECT shortened, original, clicks, created_at, expired_at
-FROM urls 
-WHERE original LIKE '%' || $1 || '%';
+SELECT shortened, original, clicks, created_at, expired_at, user_id, redirect_status, max_clicks, password_hash, title, workspace_id
+FROM urls
+WHERE ((user_id = @user_id::uuid AND workspace_id IS NULL)
+    OR workspace_id IN (SELECT workspace_id FROM workspace_members WHERE user_id = @user_id::uuid))
+  AND (original ILIKE '%' || @pattern::text || '%'
+    OR shortened ILIKE '%' || @pattern::text || '%'
+    OR title ILIKE '%' || @pattern::text || '%')
+  AND (sqlc.narg('cursor_code')::text IS NULL OR (created_at, shortened) < (sqlc.narg('cursor_created_at')::timestamptz, sqlc.narg('cursor_code')::text))
+ORDER BY created_at DESC, shortened DESC
+LIMIT @page_size;
 
--- name: BatchInsertURLs :exec
-INSERT INTO urls (shortened, original, clicks, created_at, expired_at, user_id)
+-- name: CountSearchByOriginalURL :one
+SELECT COUNT(*)
+FROM urls
+WHERE ((user_id = @user_id::uuid AND workspace_id IS NULL)
+    OR workspace_id IN (SELECT workspace_id FROM workspace_members WHERE user_id = @user_id::uuid))
+  AND (original ILIKE '%' || @pattern::text || '%'
+    OR shortened ILIKE '%' || @pattern::text || '%'
+    OR title ILIKE '%' || @pattern::text || '%');
+
+-- name: SearchAllURLs :many
+SELECT shortened, original, clicks, created_at, expired_at, user_id, redirect_status, max_clicks, password_hash, title, workspace_id
+FROM urls
+WHERE (original ILIKE '%' || @pattern::text || '%'
+    OR shortened ILIKE '%' || @pattern::text || '%'
+    OR title ILIKE '%' || @pattern::text || '%')
+  AND (sqlc.narg('cursor_code')::text IS NULL OR (created_at, shortened) < (sqlc.narg('cursor_created_at')::timestamptz, sqlc.narg('cursor_code')::text))
+ORDER BY created_at DESC, shortened DESC
+LIMIT @page_size;
+
+-- name: CountSearchAllURLs :one
+SELECT COUNT(*)
+FROM urls
+WHERE (original ILIKE '%' || @pattern::text || '%'
+    OR shortened ILIKE '%' || @pattern::text || '%'
+    OR title ILIKE '%' || @pattern::text || '%');
+
+-- name: BatchInsertURLs :execrows
+INSERT INTO urls (shortened, original, clicks, created_at, expired_at, user_id, redirect_status, max_clicks, password_hash, title, workspace_id)
 SELECT unnest($1::text[]), 
        unnest($2::text[]), 
        unnest($3::bigint[]), 
        unnest($4::timestamptz[]), 
        unnest($5::timestamptz[]), 
-       unnest($6::uuid[])
+       unnest($6::uuid[]),
+       unnest($7::int[]),
+       unnest($8::bigint[]),
+       unnest($9::text[]),
+       unnest($10::text[]),
+       unnest($11::uuid[])
 ON CONFLICT (shortened, user_id) DO NOTHING;
+
+-- name: CreateAPIKey :one
+INSERT INTO api_keys (user_id, name, prefix, key_hash)
+VALUES ($1, $2, $3, $4)
+RETURNING id, user_id, name, prefix, key_hash, created_at, last_used_at, revoked_at;
+
+-- name: GetAPIKeyByHash :one
+SELECT id, user_id, name, prefix, key_hash, created_at, last_used_at, revoked_at
+FROM api_keys
+WHERE key_hash = $1 AND revoked_at IS NULL;
+
+-- name: ListAPIKeys :many
+SELECT id, user_id, name, prefix, key_hash, created_at, last_used_at, revoked_at
+FROM api_keys
+WHERE user_id = $1
+ORDER BY created_at DESC;
+
+-- name: RevokeAPIKey :execrows
+UPDATE api_keys
+SET revoked_at = CURRENT_TIMESTAMP
+WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL;
+
+-- name: TouchAPIKey :exec
+UPDATE api_keys
+SET last_used_at = CURRENT_TIMESTAMP
+WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < CURRENT_TIMESTAMP - INTERVAL '1 minute');
+
+-- name: GetUser :one
+SELECT user_id, email, password_hash, created_at
+FROM users
+WHERE user_id = $1;
+
+-- name: GetUserByEmail :one
+SELECT u.user_id, u.email, u.password_hash, u.created_at
+FROM user_emails e
+JOIN users u ON u.user_id = e.user_id
+WHERE e.email = $1;
+
+-- name: InsertAccount :exec
+INSERT INTO users (user_id, email, password_hash) VALUES ($1, $2, $3);
+
+-- name: InsertUserEmail :exec
+INSERT INTO user_emails (email, user_id) VALUES ($1, $2);
+
+-- name: UpdateUserPassword :exec
+UPDATE users
+SET password_hash = $2
+WHERE user_id = $1;
+
+-- name: CreateSession :one
+INSERT INTO sessions (user_id, refresh_hash, expires_at)
+VALUES ($1, $2, $3)
+RETURNING id;
+
+-- name: RotateSession :one
+UPDATE sessions
+SET refresh_hash = @new_refresh_hash
+WHERE refresh_hash = @refresh_hash AND revoked_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+RETURNING id, user_id;
+
+-- name: RevokeSession :execrows
+UPDATE sessions
+SET revoked_at = CURRENT_TIMESTAMP
+WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL;
+
+-- name: RevokeUserSessions :many
+UPDATE sessions
+SET revoked_at = CURRENT_TIMESTAMP
+WHERE user_id = $1 AND revoked_at IS NULL
+RETURNING id;
+
+-- name: GetUserIdentity :one
+SELECT user_id FROM user_identities
+WHERE issuer = $1 AND subject = $2;
+
+-- name: InsertUserIdentity :exec
+INSERT INTO user_identities (issuer, subject, user_id) VALUES ($1, $2, $3);
+
+-- name: CreateWorkspace :one
+INSERT INTO workspaces (name, created_by)
+VALUES ($1, $2)
+RETURNING id, name, created_by, created_at;
+
+-- name: UpsertWorkspaceMember :exec
+INSERT INTO workspace_members (workspace_id, user_id, role)
+VALUES ($1, $2, $3)
+ON CONFLICT (workspace_id, user_id) DO UPDATE SET role = EXCLUDED.role;
+
+-- name: GetWorkspaceRole :one
+SELECT role FROM workspace_members
+WHERE workspace_id = $1 AND user_id = $2;
+
+-- name: ListUserWorkspaces :many
+SELECT w.id, w.name, w.created_by, w.created_at, m.role
+FROM workspace_members m
+JOIN workspaces w ON w.id = m.workspace_id
+WHERE m.user_id = $1
+ORDER BY w.created_at;
+
+-- name: ListWorkspaceMembers :many
+SELECT m.user_id, m.role, m.created_at, u.email
+FROM workspace_members m
+JOIN users u ON u.user_id = m.user_id
+WHERE m.workspace_id = $1
+ORDER BY m.created_at;
+
+-- name: RemoveWorkspaceMember :execrows
+DELETE FROM workspace_members
+WHERE workspace_id = $1 AND user_id = $2;
+
+-- name: LockWorkspace :one
+SELECT id FROM workspaces
+WHERE id = $1
+FOR UPDATE;
+
+-- name: CountWorkspaceOwners :one
+SELECT COUNT(*) FROM workspace_members
+WHERE workspace_id = $1 AND role = 'owner';
+
+-- name: TransferURL :execrows
+UPDATE urls
+SET user_id = @to_user_id, workspace_id = sqlc.narg('workspace_id')
+WHERE shortened = @shortened AND user_id = @from_user_id;
+
+-- name: TransferUserURLs :many
+UPDATE urls
+SET user_id = @to_user_id, workspace_id = sqlc.narg('workspace_id')
+WHERE user_id = @from_user_id AND workspace_id IS NULL
+RETURNING shortened;
+
+-- name: BatchInsertClickEvents :exec
+INSERT INTO click_events (clicked_at, shortened, referrer, user_agent, language, ip_prefix, is_bot, referrer_domain, browser, os, device)
+SELECT unnest($1::timestamptz[]),
+       unnest($2::text[]),
+       unnest($3::text[]),
+       unnest($4::text[]),
+       unnest($5::text[]),
+       unnest($6::text[]),
+       unnest($7::boolean[]),
+       unnest($8::text[]),
+       unnest($9::text[]),
+       unnest($10::text[]),
+       unnest($11::text[]);
+
+-- name: LockClickRollupState :one
+SELECT rolled_up_to, CURRENT_TIMESTAMP::timestamptz AS now FROM click_rollup_state
+WHERE id = 1
+FOR UPDATE;
+
+-- name: UpdateClickRollupState :exec
+UPDATE click_rollup_state
+SET rolled_up_to = $1
+WHERE id = 1;
+
+-- name: RollUpHourlyClicks :exec
+INSERT INTO click_rollups_hourly (shortened, bucket, clicks, bot_clicks)
+SELECT shortened,
+       date_trunc('hour', clicked_at AT TIME ZONE 'UTC') AT TIME ZONE 'UTC' AS bucket,
+       COUNT(*) FILTER (WHERE NOT is_bot),
+       COUNT(*) FILTER (WHERE is_bot)
+FROM click_events
+WHERE ingested_at >= @ingested_from AND ingested_at < @ingested_to
+GROUP BY shortened, bucket
+ON CONFLICT (shortened, bucket) DO UPDATE SET clicks = click_rollups_hourly.clicks + EXCLUDED.clicks,
+                                              bot_clicks = click_rollups_hourly.bot_clicks + EXCLUDED.bot_clicks;
+
+-- name: RollUpClickBreakdowns :exec
+INSERT INTO click_breakdowns_daily (shortened, day, dimension, value, clicks)
+SELECT e.shortened, (e.clicked_at AT TIME ZONE 'UTC')::date AS day, d.dimension, d.value, COUNT(*)
+FROM click_events e
+CROSS JOIN LATERAL (VALUES ('referrer', e.referrer_domain),
+                           ('browser', e.browser),
+                           ('os', e.os),
+                           ('device', e.device)) AS d (dimension, value)
+WHERE e.ingested_at >= @ingested_from AND e.ingested_at < @ingested_to AND NOT e.is_bot
+GROUP BY e.shortened, day, d.dimension, d.value
+ON CONFLICT (shortened, day, dimension, value) DO UPDATE SET clicks = click_breakdowns_daily.clicks + EXCLUDED.clicks;
+
+-- name: GetClickSeries :many
+SELECT date_trunc(@unit::text, bucket AT TIME ZONE @time_zone::text)::timestamp AS bucket_start, SUM(clicks)::bigint AS clicks, SUM(bot_clicks)::bigint AS bot_clicks
+FROM click_rollups_hourly
+WHERE shortened = @shortened AND bucket >= @range_from AND bucket < @range_to
+GROUP BY bucket_start
+ORDER BY bucket_start;
+
+-- name: GetClickBreakdowns :many
+SELECT dimension, value, SUM(clicks)::bigint AS clicks
+FROM click_breakdowns_daily
+WHERE shortened = @shortened AND day >= @day_from AND day <= @day_to
+GROUP BY dimension, value
+ORDER BY dimension, clicks DESC, value;
+
+-- name: DeleteClickHistory :exec
+WITH events AS (
+    DELETE FROM click_events WHERE shortened = ANY(@codes::text[])
+), rollups AS (
+    DELETE FROM click_rollups_hourly WHERE shortened = ANY(@codes::text[])
+)
+DELETE FROM click_breakdowns_daily WHERE shortened = ANY(@codes::text[]);
+
+-- name: DeleteVisitorSketches :exec
+DELETE FROM visitor_sketches WHERE shortened = ANY(@codes::text[]);
+
+-- name: GetVisitorSketch :one
+SELECT sketch FROM visitor_sketches
+WHERE shortened = $1 AND period = $2;
+
+-- name: ListVisitorSketches :many
+SELECT shortened, period, sketch FROM visitor_sketches
+WHERE shortened = ANY(@codes::text[]) AND period = ANY(@periods::text[]);
+
+-- name: UpsertVisitorSketch :exec
+INSERT INTO visitor_sketches (shortened, period, sketch)
+VALUES ($1, $2, $3)
+ON CONFLICT (shortened, period) DO UPDATE SET sketch = EXCLUDED.sketch, updated_at = CURRENT_TIMESTAMP;
+
+-- name: AddClicks :many
+UPDATE urls
+SET clicks = urls.clicks + pending.clicks
+FROM (SELECT unnest(@codes::text[]) AS shortened, unnest(@deltas::bigint[]) AS clicks) AS pending
+WHERE urls.shortened = pending.shortened
+RETURNING urls.shortened;
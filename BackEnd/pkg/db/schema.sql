@@ -2,12 +2,42 @@
 CREATE SCHEMA IF NOT EXISTS public;
 
 CREATE EXTENSION IF NOT EXISTS "uuid-ossp";
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
 
 -- Create the users table
 CREATE TABLE IF NOT EXISTS users (
-                                     user_id UUID PRIMARY KEY DEFAULT uuid_generate_v4()
+                                     user_id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+                                     email VARCHAR(254), -- NULL for anonymous users
+                                     password_hash TEXT NOT NULL DEFAULT '', -- bcrypt, empty when there is no password
+                                     created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                                     legacy_claimed_at TIMESTAMPTZ -- set when an operator issues a pre-API-key user its first key
 ) PARTITION BY HASH (user_id);
 
+-- Columns added since the first release; re-running this file upgrades an older database
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS email VARCHAR(254),
+    ADD COLUMN IF NOT EXISTS password_hash TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    ADD COLUMN IF NOT EXISTS legacy_claimed_at TIMESTAMPTZ;
+
+-- Shared workspaces; links with a workspace_id are governed by member roles instead of user_id
+CREATE TABLE IF NOT EXISTS workspaces (
+                                          id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+                                          name VARCHAR(100) NOT NULL,
+                                          created_by UUID NOT NULL REFERENCES users(user_id),
+                                          created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS workspace_members (
+                                                 workspace_id UUID NOT NULL REFERENCES workspaces(id),
+                                                 user_id UUID NOT NULL REFERENCES users(user_id),
+                                                 role VARCHAR(10) NOT NULL CHECK (role IN ('owner', 'editor', 'viewer')),
+                                                 created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                                                 PRIMARY KEY (workspace_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_workspace_members_user ON workspace_members (user_id);
+
 -- Create the partitioned urls table
 CREATE TABLE IF NOT EXISTS urls (
                                     shortened VARCHAR(100),
@@ -16,39 +46,171 @@ CREATE TABLE IF NOT EXISTS urls (
                                     created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
                                     expired_at TIMESTAMPTZ DEFAULT (CURRENT_TIMESTAMP + INTERVAL '100 days'),
                                     user_id UUID,
+                                    redirect_status INTEGER NOT NULL DEFAULT 0, -- 0 uses the server-wide default
+                                    max_clicks BIGINT NOT NULL DEFAULT 0, -- 0 means unlimited
+                                    password_hash TEXT NOT NULL DEFAULT '', -- bcrypt, empty when unprotected
+                                    title VARCHAR(250) NOT NULL DEFAULT '',
+                                    workspace_id UUID, -- NULL for personal links
                                     CONSTRAINT pk_urls PRIMARY KEY (shortened, user_id),  -- Composite primary key
-                                    CONSTRAINT fk_url_user_id FOREIGN KEY (user_id) REFERENCES users(user_id)
+                                    CONSTRAINT fk_url_user_id FOREIGN KEY (user_id) REFERENCES users(user_id),
+                                    CONSTRAINT fk_url_workspace_id FOREIGN KEY (workspace_id) REFERENCES workspaces(id)
 ) PARTITION BY HASH (shortened);
 
+ALTER TABLE urls
+    ADD COLUMN IF NOT EXISTS redirect_status INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS max_clicks BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS password_hash TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS title VARCHAR(250) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS workspace_id UUID CONSTRAINT fk_url_workspace_id REFERENCES workspaces(id);
+
 
 
-CREATE TABLE urls_p0 PARTITION OF urls FOR VALUES WITH (MODULUS 5, REMAINDER 0);
-CREATE TABLE urls_p1 PARTITION OF urls FOR VALUES WITH (MODULUS 5, REMAINDER 1);
-CREATE TABLE urls_p2 PARTITION OF urls FOR VALUES WITH (MODULUS 5, REMAINDER 2);
-CREATE TABLE urls_p3 PARTITION OF urls FOR VALUES WITH (MODULUS 5, REMAINDER 3);
-CREATE TABLE urls_p4 PARTITION OF urls FOR VALUES WITH (MODULUS 5, REMAINDER 4);
+CREATE TABLE IF NOT EXISTS urls_p0 PARTITION OF urls FOR VALUES WITH (MODULUS 5, REMAINDER 0);
+CREATE TABLE IF NOT EXISTS urls_p1 PARTITION OF urls FOR VALUES WITH (MODULUS 5, REMAINDER 1);
+CREATE TABLE IF NOT EXISTS urls_p2 PARTITION OF urls FOR VALUES WITH (MODULUS 5, REMAINDER 2);
+CREATE TABLE IF NOT EXISTS urls_p3 PARTITION OF urls FOR VALUES WITH (MODULUS 5, REMAINDER 3);
+CREATE TABLE IF NOT EXISTS urls_p4 PARTITION OF urls FOR VALUES WITH (MODULUS 5, REMAINDER 4);
 
 
 -- Create the index for the urls table
-CREATE INDEX idx_urls_0 ON urls_p0 (shortened);
-CREATE INDEX idx_urls_1 ON urls_p1 (shortened);
-CREATE INDEX idx_urls_2 ON urls_p2 (shortened);
-CREATE INDEX idx_urls_3 ON urls_p3 (shortened);
-CREATE INDEX idx_urls_4 ON urls_p4 (shortened);
+CREATE INDEX IF NOT EXISTS idx_urls_0 ON urls_p0 (shortened);
+CREATE INDEX IF NOT EXISTS idx_urls_1 ON urls_p1 (shortened);
+CREATE INDEX IF NOT EXISTS idx_urls_2 ON urls_p2 (shortened);
+CREATE INDEX IF NOT EXISTS idx_urls_3 ON urls_p3 (shortened);
+CREATE INDEX IF NOT EXISTS idx_urls_4 ON urls_p4 (shortened);
+
+-- Keyset pagination for /history, one index per sort order
+CREATE INDEX IF NOT EXISTS idx_urls_user_created ON urls (user_id, created_at DESC, shortened DESC);
+CREATE INDEX IF NOT EXISTS idx_urls_user_clicks ON urls (user_id, COALESCE(clicks, 0) DESC, shortened DESC);
+CREATE INDEX IF NOT EXISTS idx_urls_user_expiry ON urls (user_id, COALESCE(expired_at, 'infinity'), shortened);
+CREATE INDEX IF NOT EXISTS idx_urls_workspace_created ON urls (workspace_id, created_at DESC, shortened DESC) WHERE workspace_id IS NOT NULL;
+
+-- Trigram indexes so substring search does not scan every partition
+CREATE INDEX IF NOT EXISTS idx_urls_original_trgm ON urls USING GIN (original gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_urls_shortened_trgm ON urls USING GIN (shortened gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_urls_title_trgm ON urls USING GIN (title gin_trgm_ops);
+
+
+CREATE TABLE IF NOT EXISTS users_0 PARTITION OF users FOR VALUES WITH (MODULUS 5, REMAINDER 0);
+CREATE TABLE IF NOT EXISTS users_1 PARTITION OF users FOR VALUES WITH (MODULUS 5, REMAINDER 1);
+CREATE TABLE IF NOT EXISTS users_2 PARTITION OF users FOR VALUES WITH (MODULUS 5, REMAINDER 2);
+CREATE TABLE IF NOT EXISTS users_3 PARTITION OF users FOR VALUES WITH (MODULUS 5, REMAINDER 3);
+CREATE TABLE IF NOT EXISTS users_4 PARTITION OF users FOR VALUES WITH (MODULUS 5, REMAINDER 4);
+
+CREATE INDEX IF NOT EXISTS idx_users_0 ON users_0 (user_id);
+CREATE INDEX IF NOT EXISTS idx_users_1 ON users_1 (user_id);
+CREATE INDEX IF NOT EXISTS idx_users_2 ON users_2 (user_id);
+CREATE INDEX IF NOT EXISTS idx_users_3 ON users_3 (user_id);
+CREATE INDEX IF NOT EXISTS idx_users_4 ON users_4 (user_id);
+
+-- API keys are stored as SHA-256 hashes; prefix is kept to tell keys apart
+CREATE TABLE IF NOT EXISTS api_keys (
+                                        id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+                                        user_id UUID NOT NULL REFERENCES users(user_id),
+                                        name VARCHAR(100) NOT NULL DEFAULT '',
+                                        prefix VARCHAR(16) NOT NULL,
+                                        key_hash TEXT NOT NULL UNIQUE,
+                                        created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                                        last_used_at TIMESTAMPTZ,
+                                        revoked_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_keys_user ON api_keys (user_id, created_at DESC);
+
+-- users is partitioned by user_id, so a unique index there cannot cover email
+CREATE TABLE IF NOT EXISTS user_emails (
+                                           email VARCHAR(254) PRIMARY KEY, -- lower-cased
+                                           user_id UUID NOT NULL REFERENCES users(user_id)
+);
+
+-- Login sessions; the refresh token is stored as a SHA-256 hash and rotated on every refresh
+CREATE TABLE IF NOT EXISTS sessions (
+                                        id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+                                        user_id UUID NOT NULL REFERENCES users(user_id),
+                                        refresh_hash TEXT NOT NULL UNIQUE,
+                                        created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                                        expires_at TIMESTAMPTZ NOT NULL,
+                                        revoked_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_sessions_user ON sessions (user_id);
+
+-- Accounts provisioned through an OpenID Connect provider, keyed by the (iss, sub) pair of the ID token
+CREATE TABLE IF NOT EXISTS user_identities (
+                                               issuer TEXT NOT NULL,
+                                               subject TEXT NOT NULL,
+                                               user_id UUID NOT NULL REFERENCES users(user_id),
+                                               created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                                               PRIMARY KEY (issuer, subject)
+);
+
+-- One row per redirect, partitioned by month; monthly partitions are created ahead of time by the server
+CREATE TABLE IF NOT EXISTS click_events (
+                                            clicked_at TIMESTAMPTZ NOT NULL,
+                                            shortened VARCHAR(100) NOT NULL,
+                                            referrer VARCHAR(2048) NOT NULL DEFAULT '',
+                                            user_agent VARCHAR(512) NOT NULL DEFAULT '',
+                                            language VARCHAR(35) NOT NULL DEFAULT '',
+                                            ip_prefix VARCHAR(45) NOT NULL DEFAULT '', -- IPv4 /24 or IPv6 /48, never the full address
+                                            ingested_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP, -- events arrive late, the rollup job follows this
+                                            is_bot BOOLEAN NOT NULL DEFAULT FALSE,
+                                            -- parsed at ingest so the rollup job can group in SQL
+                                            referrer_domain VARCHAR(255) NOT NULL DEFAULT '',
+                                            browser VARCHAR(32) NOT NULL DEFAULT '',
+                                            os VARCHAR(32) NOT NULL DEFAULT '',
+                                            device VARCHAR(16) NOT NULL DEFAULT ''
+) PARTITION BY RANGE (clicked_at);
+
+ALTER TABLE click_events
+    ADD COLUMN IF NOT EXISTS ingested_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    ADD COLUMN IF NOT EXISTS is_bot BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN IF NOT EXISTS referrer_domain VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS browser VARCHAR(32) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS os VARCHAR(32) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS device VARCHAR(16) NOT NULL DEFAULT '';
+
+-- Catches events for months that have no partition yet
+CREATE TABLE IF NOT EXISTS click_events_default PARTITION OF click_events DEFAULT;
 
+CREATE INDEX IF NOT EXISTS idx_click_events_code ON click_events (shortened, clicked_at);
+CREATE INDEX IF NOT EXISTS idx_click_events_ingested ON click_events (ingested_at);
 
-CREATE TABLE users_0 PARTITION OF users FOR VALUES WITH (MODULUS 5, REMAINDER 0);
-CREATE TABLE users_1 PARTITION OF users FOR VALUES WITH (MODULUS 5, REMAINDER 1);
-CREATE TABLE users_2 PARTITION OF users FOR VALUES WITH (MODULUS 5, REMAINDER 2);
-CREATE TABLE users_3 PARTITION OF users FOR VALUES WITH (MODULUS 5, REMAINDER 3);
-CREATE TABLE users_4 PARTITION OF users FOR VALUES WITH (MODULUS 5, REMAINDER 4);
+-- Rollups kept up to date from click_events by the rollup job; /stats reads only these.
+-- Hourly UTC buckets can be regrouped into the days and weeks of a time zone.
+CREATE TABLE IF NOT EXISTS click_rollups_hourly (
+                                                    shortened VARCHAR(100) NOT NULL,
+                                                    bucket TIMESTAMPTZ NOT NULL,
+                                                    clicks BIGINT NOT NULL, -- people only
+                                                    bot_clicks BIGINT NOT NULL DEFAULT 0,
+                                                    PRIMARY KEY (shortened, bucket)
+);
 
-CREATE INDEX idx_users_0 ON users_0 (user_id);
-CREATE INDEX idx_users_1 ON users_1 (user_id);
-CREATE INDEX idx_users_2 ON users_2 (user_id);
-CREATE INDEX idx_users_3 ON users_3 (user_id);
-CREATE INDEX idx_users_4 ON users_4 (user_id);
+ALTER TABLE click_rollups_hourly ADD COLUMN IF NOT EXISTS bot_clicks BIGINT NOT NULL DEFAULT 0;
 
+-- dimension is referrer (domain), browser, os or device; bot clicks are left out
+CREATE TABLE IF NOT EXISTS click_breakdowns_daily (
+                                                      shortened VARCHAR(100) NOT NULL,
+                                                      day DATE NOT NULL, -- UTC
+                                                      dimension VARCHAR(16) NOT NULL,
+                                                      value VARCHAR(255) NOT NULL,
+                                                      clicks BIGINT NOT NULL,
+                                                      PRIMARY KEY (shortened, day, dimension, value)
+);
 
+-- Events ingested before rolled_up_to are already counted in the rollups
+CREATE TABLE IF NOT EXISTS click_rollup_state (
+                                                  id INTEGER PRIMARY KEY CHECK (id = 1),
+                                                  rolled_up_to TIMESTAMPTZ NOT NULL
+);
 
+INSERT INTO click_rollup_state (id, rolled_up_to) VALUES (1, CURRENT_TIMESTAMP) ON CONFLICT DO NOTHING;
 
+-- HyperLogLog sketches of unique visitors, copied from Redis so they survive eviction.
+-- period is a UTC day (YYYY-MM-DD) or "total" for the whole life of the link.
+CREATE TABLE IF NOT EXISTS visitor_sketches (
+                                                shortened VARCHAR(100) NOT NULL,
+                                                period VARCHAR(10) NOT NULL,
+                                                sketch BYTEA NOT NULL,
+                                                updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                                                PRIMARY KEY (shortened, period)
+);
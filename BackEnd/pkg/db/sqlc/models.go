@@ -8,80 +8,237 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
-type Url struct {
+type ApiKey struct {
+	ID         pgtype.UUID
+	UserID     pgtype.UUID
+	Name       string
+	Prefix     string
+	KeyHash    string
+	CreatedAt  pgtype.Timestamptz
+	LastUsedAt pgtype.Timestamptz
+	RevokedAt  pgtype.Timestamptz
+}
+
+type ClickBreakdownsDaily struct {
 	Shortened string
-	Original  string
-	Clicks    pgtype.Int8
-	CreatedAt pgtype.Timestamptz
-	ExpiredAt pgtype.Timestamptz
-	UserID    pgtype.UUID
+	Day       pgtype.Date
+	Dimension string
+	Value     string
+	Clicks    int64
 }
 
-type UrlsP0 struct {
+type ClickEvent struct {
+	ClickedAt      pgtype.Timestamptz
+	Shortened      string
+	Referrer       string
+	UserAgent      string
+	Language       string
+	IpPrefix       string
+	IngestedAt     pgtype.Timestamptz
+	IsBot          bool
+	ReferrerDomain string
+	Browser        string
+	Os             string
+	Device         string
+}
+
+type ClickEventsDefault struct {
+	ClickedAt      pgtype.Timestamptz
+	Shortened      string
+	Referrer       string
+	UserAgent      string
+	Language       string
+	IpPrefix       string
+	IngestedAt     pgtype.Timestamptz
+	IsBot          bool
+	ReferrerDomain string
+	Browser        string
+	Os             string
+	Device         string
+}
+
+type ClickRollupState struct {
+	ID         int32
+	RolledUpTo pgtype.Timestamptz
+}
+
+type ClickRollupsHourly struct {
 	Shortened string
-	Original  string
-	Clicks    pgtype.Int8
-	CreatedAt pgtype.Timestamptz
-	ExpiredAt pgtype.Timestamptz
-	UserID    pgtype.UUID
+	Bucket    pgtype.Timestamptz
+	Clicks    int64
+	BotClicks int64
+}
+
+type Session struct {
+	ID          pgtype.UUID
+	UserID      pgtype.UUID
+	RefreshHash string
+	CreatedAt   pgtype.Timestamptz
+	ExpiresAt   pgtype.Timestamptz
+	RevokedAt   pgtype.Timestamptz
+}
+
+type Url struct {
+	Shortened      string
+	Original       string
+	Clicks         pgtype.Int8
+	CreatedAt      pgtype.Timestamptz
+	ExpiredAt      pgtype.Timestamptz
+	UserID         pgtype.UUID
+	RedirectStatus int32
+	MaxClicks      int64
+	PasswordHash   string
+	Title          string
+	WorkspaceID    pgtype.UUID
+}
+
+type UrlsP0 struct {
+	Shortened      string
+	Original       string
+	Clicks         pgtype.Int8
+	CreatedAt      pgtype.Timestamptz
+	ExpiredAt      pgtype.Timestamptz
+	UserID         pgtype.UUID
+	RedirectStatus int32
+	MaxClicks      int64
+	PasswordHash   string
+	Title          string
+	WorkspaceID    pgtype.UUID
 }
 
 type UrlsP1 struct {
-	Shortened string
-	Original  string
-	Clicks    pgtype.Int8
-	CreatedAt pgtype.Timestamptz
-	ExpiredAt pgtype.Timestamptz
-	UserID    pgtype.UUID
+	Shortened      string
+	Original       string
+	Clicks         pgtype.Int8
+	CreatedAt      pgtype.Timestamptz
+	ExpiredAt      pgtype.Timestamptz
+	UserID         pgtype.UUID
+	RedirectStatus int32
+	MaxClicks      int64
+	PasswordHash   string
+	Title          string
+	WorkspaceID    pgtype.UUID
 }
 
 type UrlsP2 struct {
-	Shortened string
-	Original  string
-	Clicks    pgtype.Int8
-	CreatedAt pgtype.Timestamptz
-	ExpiredAt pgtype.Timestamptz
-	UserID    pgtype.UUID
+	Shortened      string
+	Original       string
+	Clicks         pgtype.Int8
+	CreatedAt      pgtype.Timestamptz
+	ExpiredAt      pgtype.Timestamptz
+	UserID         pgtype.UUID
+	RedirectStatus int32
+	MaxClicks      int64
+	PasswordHash   string
+	Title          string
+	WorkspaceID    pgtype.UUID
 }
 
 type UrlsP3 struct {
-	Shortened string
-	Original  string
-	Clicks    pgtype.Int8
-	CreatedAt pgtype.Timestamptz
-	ExpiredAt pgtype.Timestamptz
-	UserID    pgtype.UUID
+	Shortened      string
+	Original       string
+	Clicks         pgtype.Int8
+	CreatedAt      pgtype.Timestamptz
+	ExpiredAt      pgtype.Timestamptz
+	UserID         pgtype.UUID
+	RedirectStatus int32
+	MaxClicks      int64
+	PasswordHash   string
+	Title          string
+	WorkspaceID    pgtype.UUID
 }
 
 type UrlsP4 struct {
-	Shortened string
-	Original  string
-	Clicks    pgtype.Int8
-	CreatedAt pgtype.Timestamptz
-	ExpiredAt pgtype.Timestamptz
-	UserID    pgtype.UUID
+	Shortened      string
+	Original       string
+	Clicks         pgtype.Int8
+	CreatedAt      pgtype.Timestamptz
+	ExpiredAt      pgtype.Timestamptz
+	UserID         pgtype.UUID
+	RedirectStatus int32
+	MaxClicks      int64
+	PasswordHash   string
+	Title          string
+	WorkspaceID    pgtype.UUID
 }
 
 type User struct {
+	UserID          pgtype.UUID
+	Email           pgtype.Text
+	PasswordHash    string
+	CreatedAt       pgtype.Timestamptz
+	LegacyClaimedAt pgtype.Timestamptz
+}
+
+type UserEmail struct {
+	Email  string
 	UserID pgtype.UUID
 }
 
+type UserIdentity struct {
+	Issuer    string
+	Subject   string
+	UserID    pgtype.UUID
+	CreatedAt pgtype.Timestamptz
+}
+
 type Users0 struct {
-	UserID pgtype.UUID
+	UserID          pgtype.UUID
+	Email           pgtype.Text
+	PasswordHash    string
+	CreatedAt       pgtype.Timestamptz
+	LegacyClaimedAt pgtype.Timestamptz
 }
 
 type Users1 struct {
-	UserID pgtype.UUID
+	UserID          pgtype.UUID
+	Email           pgtype.Text
+	PasswordHash    string
+	CreatedAt       pgtype.Timestamptz
+	LegacyClaimedAt pgtype.Timestamptz
 }
 
 type Users2 struct {
-	UserID pgtype.UUID
+	UserID          pgtype.UUID
+	Email           pgtype.Text
+	PasswordHash    string
+	CreatedAt       pgtype.Timestamptz
+	LegacyClaimedAt pgtype.Timestamptz
 }
 
 type Users3 struct {
-	UserID pgtype.UUID
+	UserID          pgtype.UUID
+	Email           pgtype.Text
+	PasswordHash    string
+	CreatedAt       pgtype.Timestamptz
+	LegacyClaimedAt pgtype.Timestamptz
 }
 
 type Users4 struct {
-	UserID pgtype.UUID
+	UserID          pgtype.UUID
+	Email           pgtype.Text
+	PasswordHash    string
+	CreatedAt       pgtype.Timestamptz
+	LegacyClaimedAt pgtype.Timestamptz
+}
+
+type VisitorSketch struct {
+	Shortened string
+	Period    string
+	Sketch    []byte
+	UpdatedAt pgtype.Timestamptz
+}
+
+type Workspace struct {
+	ID        pgtype.UUID
+	Name      string
+	CreatedBy pgtype.UUID
+	CreatedAt pgtype.Timestamptz
+}
+
+type WorkspaceMember struct {
+	WorkspaceID pgtype.UUID
+	UserID      pgtype.UUID
+	Role        string
+	CreatedAt   pgtype.Timestamptz
 }
@@ -11,35 +11,321 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
-const batchInsertURLs = `-- name: BatchInsertURLs :exec
-INSERT INTO urls (shortened, original, clicks, created_at, expired_at, user_id)
+const addClicks = `-- name: AddClicks :many
+UPDATE urls
+SET clicks = urls.clicks + pending.clicks
+FROM (SELECT unnest($1::text[]) AS shortened, unnest($2::bigint[]) AS clicks) AS pending
+WHERE urls.shortened = pending.shortened
+RETURNING urls.shortened
+`
+
+type AddClicksParams struct {
+	Codes  []string
+	Deltas []int64
+}
+
+func (q *Queries) AddClicks(ctx context.Context, arg AddClicksParams) ([]string, error) {
+	rows, err := q.db.Query(ctx, addClicks, arg.Codes, arg.Deltas)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var shortened string
+		if err := rows.Scan(&shortened); err != nil {
+			return nil, err
+		}
+		items = append(items, shortened)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const batchInsertClickEvents = `-- name: BatchInsertClickEvents :exec
+INSERT INTO click_events (clicked_at, shortened, referrer, user_agent, language, ip_prefix, is_bot, referrer_domain, browser, os, device)
+SELECT unnest($1::timestamptz[]),
+       unnest($2::text[]),
+       unnest($3::text[]),
+       unnest($4::text[]),
+       unnest($5::text[]),
+       unnest($6::text[]),
+       unnest($7::boolean[]),
+       unnest($8::text[]),
+       unnest($9::text[]),
+       unnest($10::text[]),
+       unnest($11::text[])
+`
+
+type BatchInsertClickEventsParams struct {
+	Column1  []pgtype.Timestamptz
+	Column2  []string
+	Column3  []string
+	Column4  []string
+	Column5  []string
+	Column6  []string
+	Column7  []bool
+	Column8  []string
+	Column9  []string
+	Column10 []string
+	Column11 []string
+}
+
+func (q *Queries) BatchInsertClickEvents(ctx context.Context, arg BatchInsertClickEventsParams) error {
+	_, err := q.db.Exec(ctx, batchInsertClickEvents,
+		arg.Column1,
+		arg.Column2,
+		arg.Column3,
+		arg.Column4,
+		arg.Column5,
+		arg.Column6,
+		arg.Column7,
+		arg.Column8,
+		arg.Column9,
+		arg.Column10,
+		arg.Column11,
+	)
+	return err
+}
+
+const batchInsertURLs = `-- name: BatchInsertURLs :execrows
+INSERT INTO urls (shortened, original, clicks, created_at, expired_at, user_id, redirect_status, max_clicks, password_hash, title, workspace_id)
 SELECT unnest($1::text[]), 
        unnest($2::text[]), 
        unnest($3::bigint[]), 
        unnest($4::timestamptz[]), 
        unnest($5::timestamptz[]), 
-       unnest($6::uuid[])
+       unnest($6::uuid[]),
+       unnest($7::int[]),
+       unnest($8::bigint[]),
+       unnest($9::text[]),
+       unnest($10::text[]),
+       unnest($11::uuid[])
 ON CONFLICT (shortened, user_id) DO NOTHING
 `
 
 type BatchInsertURLsParams struct {
-	Column1 []string
-	Column2 []string
-	Column3 []int64
-	Column4 []pgtype.Timestamptz
-	Column5 []pgtype.Timestamptz
-	Column6 []pgtype.UUID
+	Column1  []string
+	Column2  []string
+	Column3  []int64
+	Column4  []pgtype.Timestamptz
+	Column5  []pgtype.Timestamptz
+	Column6  []pgtype.UUID
+	Column7  []int32
+	Column8  []int64
+	Column9  []string
+	Column10 []string
+	Column11 []pgtype.UUID
 }
 
-func (q *Queries) BatchInsertURLs(ctx context.Context, arg BatchInsertURLsParams) error {
-	_, err := q.db.Exec(ctx, batchInsertURLs,
+func (q *Queries) BatchInsertURLs(ctx context.Context, arg BatchInsertURLsParams) (int64, error) {
+	result, err := q.db.Exec(ctx, batchInsertURLs,
 		arg.Column1,
 		arg.Column2,
 		arg.Column3,
 		arg.Column4,
 		arg.Column5,
 		arg.Column6,
+		arg.Column7,
+		arg.Column8,
+		arg.Column9,
+		arg.Column10,
+		arg.Column11,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const claimLegacyUser = `-- name: ClaimLegacyUser :one
+UPDATE users
+SET legacy_claimed_at = CURRENT_TIMESTAMP
+WHERE user_id = $1 AND legacy_claimed_at IS NULL AND email IS NULL AND password_hash = ''
+  AND NOT EXISTS(SELECT 1 FROM api_keys WHERE user_id = $1)
+  AND NOT EXISTS(SELECT 1 FROM user_identities WHERE user_id = $1)
+  AND NOT EXISTS(SELECT 1 FROM sessions WHERE user_id = $1)
+RETURNING user_id
+`
+
+func (q *Queries) ClaimLegacyUser(ctx context.Context, userID pgtype.UUID) (pgtype.UUID, error) {
+	row := q.db.QueryRow(ctx, claimLegacyUser, userID)
+	var user_id pgtype.UUID
+	err := row.Scan(&user_id)
+	return user_id, err
+}
+
+const countSearchAllURLs = `-- name: CountSearchAllURLs :one
+SELECT COUNT(*)
+FROM urls
+WHERE (original ILIKE '%' || $1::text || '%'
+    OR shortened ILIKE '%' || $1::text || '%'
+    OR title ILIKE '%' || $1::text || '%')
+`
+
+func (q *Queries) CountSearchAllURLs(ctx context.Context, pattern string) (int64, error) {
+	row := q.db.QueryRow(ctx, countSearchAllURLs, pattern)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const countSearchByOriginalURL = `-- name: CountSearchByOriginalURL :one
+SELECT COUNT(*)
+FROM urls
+WHERE ((user_id = $1::uuid AND workspace_id IS NULL)
+    OR workspace_id IN (SELECT workspace_id FROM workspace_members WHERE user_id = $1::uuid))
+  AND (original ILIKE '%' || $2::text || '%'
+    OR shortened ILIKE '%' || $2::text || '%'
+    OR title ILIKE '%' || $2::text || '%')
+`
+
+type CountSearchByOriginalURLParams struct {
+	UserID  pgtype.UUID
+	Pattern string
+}
+
+func (q *Queries) CountSearchByOriginalURL(ctx context.Context, arg CountSearchByOriginalURLParams) (int64, error) {
+	row := q.db.QueryRow(ctx, countSearchByOriginalURL, arg.UserID, arg.Pattern)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const countUserURLs = `-- name: CountUserURLs :one
+SELECT COUNT(*)
+FROM urls
+WHERE ((user_id = $1::uuid AND workspace_id IS NULL) OR workspace_id = $2::uuid)
+  AND ($3::bool IS NULL OR (expired_at IS NULL OR expired_at > CURRENT_TIMESTAMP) = $3::bool)
+  AND ($4::timestamptz IS NULL OR created_at >= $4::timestamptz)
+  AND ($5::timestamptz IS NULL OR created_at < $5::timestamptz)
+  AND ($6::text IS NULL OR original ILIKE '%' || $6::text || '%')
+`
+
+type CountUserURLsParams struct {
+	UserID      pgtype.UUID
+	WorkspaceID pgtype.UUID
+	Active      pgtype.Bool
+	CreatedFrom pgtype.Timestamptz
+	CreatedTo   pgtype.Timestamptz
+	Search      pgtype.Text
+}
+
+func (q *Queries) CountUserURLs(ctx context.Context, arg CountUserURLsParams) (int64, error) {
+	row := q.db.QueryRow(ctx, countUserURLs,
+		arg.UserID,
+		arg.WorkspaceID,
+		arg.Active,
+		arg.CreatedFrom,
+		arg.CreatedTo,
+		arg.Search,
+	)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const countWorkspaceOwners = `-- name: CountWorkspaceOwners :one
+SELECT COUNT(*) FROM workspace_members
+WHERE workspace_id = $1 AND role = 'owner'
+`
+
+func (q *Queries) CountWorkspaceOwners(ctx context.Context, workspaceID pgtype.UUID) (int64, error) {
+	row := q.db.QueryRow(ctx, countWorkspaceOwners, workspaceID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const createAPIKey = `-- name: CreateAPIKey :one
+INSERT INTO api_keys (user_id, name, prefix, key_hash)
+VALUES ($1, $2, $3, $4)
+RETURNING id, user_id, name, prefix, key_hash, created_at, last_used_at, revoked_at
+`
+
+type CreateAPIKeyParams struct {
+	UserID  pgtype.UUID
+	Name    string
+	Prefix  string
+	KeyHash string
+}
+
+func (q *Queries) CreateAPIKey(ctx context.Context, arg CreateAPIKeyParams) (ApiKey, error) {
+	row := q.db.QueryRow(ctx, createAPIKey,
+		arg.UserID,
+		arg.Name,
+		arg.Prefix,
+		arg.KeyHash,
+	)
+	var i ApiKey
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Name,
+		&i.Prefix,
+		&i.KeyHash,
+		&i.CreatedAt,
+		&i.LastUsedAt,
+		&i.RevokedAt,
+	)
+	return i, err
+}
+
+const createSession = `-- name: CreateSession :one
+INSERT INTO sessions (user_id, refresh_hash, expires_at)
+VALUES ($1, $2, $3)
+RETURNING id
+`
+
+type CreateSessionParams struct {
+	UserID      pgtype.UUID
+	RefreshHash string
+	ExpiresAt   pgtype.Timestamptz
+}
+
+func (q *Queries) CreateSession(ctx context.Context, arg CreateSessionParams) (pgtype.UUID, error) {
+	row := q.db.QueryRow(ctx, createSession, arg.UserID, arg.RefreshHash, arg.ExpiresAt)
+	var id pgtype.UUID
+	err := row.Scan(&id)
+	return id, err
+}
+
+const createWorkspace = `-- name: CreateWorkspace :one
+INSERT INTO workspaces (name, created_by)
+VALUES ($1, $2)
+RETURNING id, name, created_by, created_at
+`
+
+type CreateWorkspaceParams struct {
+	Name      string
+	CreatedBy pgtype.UUID
+}
+
+func (q *Queries) CreateWorkspace(ctx context.Context, arg CreateWorkspaceParams) (Workspace, error) {
+	row := q.db.QueryRow(ctx, createWorkspace, arg.Name, arg.CreatedBy)
+	var i Workspace
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.CreatedBy,
+		&i.CreatedAt,
 	)
+	return i, err
+}
+
+const deleteClickHistory = `-- name: DeleteClickHistory :exec
+WITH events AS (
+    DELETE FROM click_events WHERE shortened = ANY($1::text[])
+), rollups AS (
+    DELETE FROM click_rollups_hourly WHERE shortened = ANY($1::text[])
+)
+DELETE FROM click_breakdowns_daily WHERE shortened = ANY($1::text[])
+`
+
+func (q *Queries) DeleteClickHistory(ctx context.Context, codes []string) error {
+	_, err := q.db.Exec(ctx, deleteClickHistory, codes)
 	return err
 }
 
@@ -63,6 +349,99 @@ func (q *Queries) DeleteURL(ctx context.Context, shortened string) error {
 	return err
 }
 
+const deleteUserURL = `-- name: DeleteUserURL :execrows
+DELETE FROM urls
+WHERE shortened = $1 AND user_id = $2
+`
+
+type DeleteUserURLParams struct {
+	Shortened string
+	UserID    pgtype.UUID
+}
+
+func (q *Queries) DeleteUserURL(ctx context.Context, arg DeleteUserURLParams) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteUserURL, arg.Shortened, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const deleteVisitorSketches = `-- name: DeleteVisitorSketches :exec
+DELETE FROM visitor_sketches WHERE shortened = ANY($1::text[])
+`
+
+func (q *Queries) DeleteVisitorSketches(ctx context.Context, codes []string) error {
+	_, err := q.db.Exec(ctx, deleteVisitorSketches, codes)
+	return err
+}
+
+const getAPIKeyByHash = `-- name: GetAPIKeyByHash :one
+SELECT id, user_id, name, prefix, key_hash, created_at, last_used_at, revoked_at
+FROM api_keys
+WHERE key_hash = $1 AND revoked_at IS NULL
+`
+
+func (q *Queries) GetAPIKeyByHash(ctx context.Context, keyHash string) (ApiKey, error) {
+	row := q.db.QueryRow(ctx, getAPIKeyByHash, keyHash)
+	var i ApiKey
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Name,
+		&i.Prefix,
+		&i.KeyHash,
+		&i.CreatedAt,
+		&i.LastUsedAt,
+		&i.RevokedAt,
+	)
+	return i, err
+}
+
+const getClickBreakdowns = `-- name: GetClickBreakdowns :many
+SELECT dimension, value, SUM(clicks)::bigint AS clicks
+FROM click_breakdowns_daily
+WHERE shortened = $1 AND day >= $2 AND day <= $3
+GROUP BY dimension, value
+ORDER BY dimension, clicks DESC, value
+`
+
+type GetClickBreakdownsParams struct {
+	Shortened string
+	DayFrom   pgtype.Date
+	DayTo     pgtype.Date
+}
+
+type GetClickBreakdownsRow struct {
+	Dimension string
+	Value     string
+	Clicks    int64
+}
+
+func (q *Queries) GetClickBreakdowns(ctx context.Context, arg GetClickBreakdownsParams) ([]GetClickBreakdownsRow, error) {
+	rows, err := q.db.Query(ctx, getClickBreakdowns, arg.Shortened, arg.DayFrom, arg.DayTo)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetClickBreakdownsRow
+	for rows.Next() {
+		var i GetClickBreakdownsRow
+		if err := rows.Scan(
+			&i.Dimension,
+			&i.Value,
+			&i.Clicks,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getClicks = `-- name: GetClicks :one
 SELECT clicks 
 FROM urls 
@@ -76,6 +455,58 @@ func (q *Queries) GetClicks(ctx context.Context, shortened string) (pgtype.Int8,
 	return clicks, err
 }
 
+const getClickSeries = `-- name: GetClickSeries :many
+SELECT date_trunc($1::text, bucket AT TIME ZONE $2::text)::timestamp AS bucket_start, SUM(clicks)::bigint AS clicks, SUM(bot_clicks)::bigint AS bot_clicks
+FROM click_rollups_hourly
+WHERE shortened = $3 AND bucket >= $4 AND bucket < $5
+GROUP BY bucket_start
+ORDER BY bucket_start
+`
+
+type GetClickSeriesParams struct {
+	Unit      string
+	TimeZone  string
+	Shortened string
+	RangeFrom pgtype.Timestamptz
+	RangeTo   pgtype.Timestamptz
+}
+
+type GetClickSeriesRow struct {
+	BucketStart pgtype.Timestamp
+	Clicks      int64
+	BotClicks   int64
+}
+
+func (q *Queries) GetClickSeries(ctx context.Context, arg GetClickSeriesParams) ([]GetClickSeriesRow, error) {
+	rows, err := q.db.Query(ctx, getClickSeries,
+		arg.Unit,
+		arg.TimeZone,
+		arg.Shortened,
+		arg.RangeFrom,
+		arg.RangeTo,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetClickSeriesRow
+	for rows.Next() {
+		var i GetClickSeriesRow
+		if err := rows.Scan(
+			&i.BucketStart,
+			&i.Clicks,
+			&i.BotClicks,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getExpiredURLs = `-- name: GetExpiredURLs :many
 SELECT shortened, original, clicks, created_at, expired_at
 FROM urls 
@@ -117,7 +548,7 @@ func (q *Queries) GetExpiredURLs(ctx context.Context) ([]GetExpiredURLsRow, erro
 }
 
 const getOriginated = `-- name: GetOriginated :one
-SELECT shortened, original, clicks, created_at, expired_at, user_id
+SELECT shortened, original, clicks, created_at, expired_at, user_id, redirect_status, max_clicks, password_hash, title, workspace_id
 FROM urls 
 WHERE shortened = $1
 `
@@ -132,40 +563,57 @@ func (q *Queries) GetOriginated(ctx context.Context, shortened string) (Url, err
 		&i.CreatedAt,
 		&i.ExpiredAt,
 		&i.UserID,
+		&i.RedirectStatus,
+		&i.MaxClicks,
+		&i.PasswordHash,
+		&i.Title,
+		&i.WorkspaceID,
 	)
 	return i, err
 }
 
 const getURLsByUser = `-- name: GetURLsByUser :many
-SELECT shortened, original, clicks, created_at, expired_at
-FROM urls 
+SELECT shortened, original, clicks, created_at, expired_at, user_id, redirect_status, max_clicks, password_hash, title, workspace_id
+FROM urls
 WHERE user_id = $1
-ORDER BY created_at DESC
+  AND ($2::text IS NULL OR (created_at, shortened) < ($3::timestamptz, $2::text))
+ORDER BY created_at DESC, shortened DESC
+LIMIT $4
 `
 
-type GetURLsByUserRow struct {
-	Shortened string
-	Original  string
-	Clicks    pgtype.Int8
-	CreatedAt pgtype.Timestamptz
-	ExpiredAt pgtype.Timestamptz
+type GetURLsByUserParams struct {
+	UserID          pgtype.UUID
+	CursorCode      pgtype.Text
+	CursorCreatedAt pgtype.Timestamptz
+	PageSize        int32
 }
 
-func (q *Queries) GetURLsByUser(ctx context.Context, userID pgtype.UUID) ([]GetURLsByUserRow, error) {
-	rows, err := q.db.Query(ctx, getURLsByUser, userID)
+func (q *Queries) GetURLsByUser(ctx context.Context, arg GetURLsByUserParams) ([]Url, error) {
+	rows, err := q.db.Query(ctx, getURLsByUser,
+		arg.UserID,
+		arg.CursorCode,
+		arg.CursorCreatedAt,
+		arg.PageSize,
+	)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []GetURLsByUserRow
+	var items []Url
 	for rows.Next() {
-		var i GetURLsByUserRow
+		var i Url
 		if err := rows.Scan(
 			&i.Shortened,
 			&i.Original,
 			&i.Clicks,
 			&i.CreatedAt,
 			&i.ExpiredAt,
+			&i.UserID,
+			&i.RedirectStatus,
+			&i.MaxClicks,
+			&i.PasswordHash,
+			&i.Title,
+			&i.WorkspaceID,
 		); err != nil {
 			return nil, err
 		}
@@ -177,21 +625,120 @@ func (q *Queries) GetURLsByUser(ctx context.Context, userID pgtype.UUID) ([]GetU
 	return items, nil
 }
 
-const incrementClicks = `-- name: IncrementClicks :exec
-UPDATE urls 
-SET clicks = clicks + 1 
-WHERE shortened = $1
+const getUser = `-- name: GetUser :one
+SELECT user_id, email, password_hash, created_at
+FROM users
+WHERE user_id = $1
+`
+
+func (q *Queries) GetUser(ctx context.Context, userID pgtype.UUID) (User, error) {
+	row := q.db.QueryRow(ctx, getUser, userID)
+	var i User
+	err := row.Scan(
+		&i.UserID,
+		&i.Email,
+		&i.PasswordHash,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const getUserByEmail = `-- name: GetUserByEmail :one
+SELECT u.user_id, u.email, u.password_hash, u.created_at
+FROM user_emails e
+JOIN users u ON u.user_id = e.user_id
+WHERE e.email = $1
+`
+
+type GetUserByEmailRow struct {
+	UserID       pgtype.UUID
+	Email        pgtype.Text
+	PasswordHash string
+	CreatedAt    pgtype.Timestamptz
+}
+
+func (q *Queries) GetUserByEmail(ctx context.Context, email string) (GetUserByEmailRow, error) {
+	row := q.db.QueryRow(ctx, getUserByEmail, email)
+	var i GetUserByEmailRow
+	err := row.Scan(
+		&i.UserID,
+		&i.Email,
+		&i.PasswordHash,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const getUserIdentity = `-- name: GetUserIdentity :one
+SELECT user_id FROM user_identities
+WHERE issuer = $1 AND subject = $2
+`
+
+type GetUserIdentityParams struct {
+	Issuer  string
+	Subject string
+}
+
+func (q *Queries) GetUserIdentity(ctx context.Context, arg GetUserIdentityParams) (pgtype.UUID, error) {
+	row := q.db.QueryRow(ctx, getUserIdentity, arg.Issuer, arg.Subject)
+	var user_id pgtype.UUID
+	err := row.Scan(&user_id)
+	return user_id, err
+}
+
+const getVisitorSketch = `-- name: GetVisitorSketch :one
+SELECT sketch FROM visitor_sketches
+WHERE shortened = $1 AND period = $2
+`
+
+type GetVisitorSketchParams struct {
+	Shortened string
+	Period    string
+}
+
+func (q *Queries) GetVisitorSketch(ctx context.Context, arg GetVisitorSketchParams) ([]byte, error) {
+	row := q.db.QueryRow(ctx, getVisitorSketch, arg.Shortened, arg.Period)
+	var sketch []byte
+	err := row.Scan(&sketch)
+	return sketch, err
+}
+
+const getWorkspaceRole = `-- name: GetWorkspaceRole :one
+SELECT role FROM workspace_members
+WHERE workspace_id = $1 AND user_id = $2
+`
+
+type GetWorkspaceRoleParams struct {
+	WorkspaceID pgtype.UUID
+	UserID      pgtype.UUID
+}
+
+func (q *Queries) GetWorkspaceRole(ctx context.Context, arg GetWorkspaceRoleParams) (string, error) {
+	row := q.db.QueryRow(ctx, getWorkspaceRole, arg.WorkspaceID, arg.UserID)
+	var role string
+	err := row.Scan(&role)
+	return role, err
+}
+
+const insertAccount = `-- name: InsertAccount :exec
+INSERT INTO users (user_id, email, password_hash) VALUES ($1, $2, $3)
 `
 
-func (q *Queries) IncrementClicks(ctx context.Context, shortened string) error {
-	_, err := q.db.Exec(ctx, incrementClicks, shortened)
+type InsertAccountParams struct {
+	UserID       pgtype.UUID
+	Email        pgtype.Text
+	PasswordHash string
+}
+
+func (q *Queries) InsertAccount(ctx context.Context, arg InsertAccountParams) error {
+	_, err := q.db.Exec(ctx, insertAccount, arg.UserID, arg.Email, arg.PasswordHash)
 	return err
 }
 
 const insertURL = `-- name: InsertURL :one
 INSERT INTO urls (shortened, original, clicks, created_at, expired_at, user_id)
 VALUES ($1, $2, 0, DEFAULT, DEFAULT, $3)
-RETURNING shortened, original, clicks, created_at, expired_at, user_id
+RETURNING shortened, original, clicks, created_at, expired_at, user_id, redirect_status, max_clicks, password_hash, title, workspace_id
 `
 
 type InsertURLParams struct {
@@ -210,6 +757,11 @@ func (q *Queries) InsertURL(ctx context.Context, arg InsertURLParams) (Url, erro
 		&i.CreatedAt,
 		&i.ExpiredAt,
 		&i.UserID,
+		&i.RedirectStatus,
+		&i.MaxClicks,
+		&i.PasswordHash,
+		&i.Title,
+		&i.WorkspaceID,
 	)
 	return i, err
 }
@@ -223,6 +775,35 @@ func (q *Queries) InsertUser(ctx context.Context, userID pgtype.UUID) error {
 	return err
 }
 
+const insertUserEmail = `-- name: InsertUserEmail :exec
+INSERT INTO user_emails (email, user_id) VALUES ($1, $2)
+`
+
+type InsertUserEmailParams struct {
+	Email  string
+	UserID pgtype.UUID
+}
+
+func (q *Queries) InsertUserEmail(ctx context.Context, arg InsertUserEmailParams) error {
+	_, err := q.db.Exec(ctx, insertUserEmail, arg.Email, arg.UserID)
+	return err
+}
+
+const insertUserIdentity = `-- name: InsertUserIdentity :exec
+INSERT INTO user_identities (issuer, subject, user_id) VALUES ($1, $2, $3)
+`
+
+type InsertUserIdentityParams struct {
+	Issuer  string
+	Subject string
+	UserID  pgtype.UUID
+}
+
+func (q *Queries) InsertUserIdentity(ctx context.Context, arg InsertUserIdentityParams) error {
+	_, err := q.db.Exec(ctx, insertUserIdentity, arg.Issuer, arg.Subject, arg.UserID)
+	return err
+}
+
 const isURLExpired = `-- name: IsURLExpired :one
 SELECT CASE WHEN expired_at < CURRENT_TIMESTAMP THEN TRUE ELSE FALSE END AS is_expired
 FROM urls
@@ -236,35 +817,31 @@ func (q *Queries) IsURLExpired(ctx context.Context, shortened string) (bool, err
 	return is_expired, err
 }
 
-const searchByOriginalURL = `-- name: SearchByOriginalURL :many
-SELECT shortened, original, clicks, created_at, expired_at
-FROM urls 
-WHERE original LIKE '%' || $1 || '%'
+const listAPIKeys = `-- name: ListAPIKeys :many
+SELECT id, user_id, name, prefix, key_hash, created_at, last_used_at, revoked_at
+FROM api_keys
+WHERE user_id = $1
+ORDER BY created_at DESC
 `
 
-type SearchByOriginalURLRow struct {
-	Shortened string
-	Original  string
-	Clicks    pgtype.Int8
-	CreatedAt pgtype.Timestamptz
-	ExpiredAt pgtype.Timestamptz
-}
-
-func (q *Queries) SearchByOriginalURL(ctx context.Context, dollar_1 pgtype.Text) ([]SearchByOriginalURLRow, error) {
-	rows, err := q.db.Query(ctx, searchByOriginalURL, dollar_1)
+func (q *Queries) ListAPIKeys(ctx context.Context, userID pgtype.UUID) ([]ApiKey, error) {
+	rows, err := q.db.Query(ctx, listAPIKeys, userID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []SearchByOriginalURLRow
+	var items []ApiKey
 	for rows.Next() {
-		var i SearchByOriginalURLRow
+		var i ApiKey
 		if err := rows.Scan(
-			&i.Shortened,
-			&i.Original,
-			&i.Clicks,
+			&i.ID,
+			&i.UserID,
+			&i.Name,
+			&i.Prefix,
+			&i.KeyHash,
 			&i.CreatedAt,
-			&i.ExpiredAt,
+			&i.LastUsedAt,
+			&i.RevokedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -276,7 +853,719 @@ func (q *Queries) SearchByOriginalURL(ctx context.Context, dollar_1 pgtype.Text)
 	return items, nil
 }
 
-const updateExpirationDate = `-- name: UpdateExpirationDate :exec
+const listUserURLsByClicks = `-- name: ListUserURLsByClicks :many
+SELECT shortened, original, clicks, created_at, expired_at, user_id, redirect_status, max_clicks, password_hash, title, workspace_id
+FROM urls
+WHERE ((user_id = $1::uuid AND workspace_id IS NULL) OR workspace_id = $2::uuid)
+  AND ($3::bool IS NULL OR (expired_at IS NULL OR expired_at > CURRENT_TIMESTAMP) = $3::bool)
+  AND ($4::timestamptz IS NULL OR created_at >= $4::timestamptz)
+  AND ($5::timestamptz IS NULL OR created_at < $5::timestamptz)
+  AND ($6::text IS NULL OR original ILIKE '%' || $6::text || '%')
+  AND ($7::text IS NULL OR (COALESCE(clicks, 0), shortened) < ($8::bigint, $7::text))
+ORDER BY COALESCE(clicks, 0) DESC, shortened DESC
+LIMIT $9
+`
+
+type ListUserURLsByClicksParams struct {
+	UserID       pgtype.UUID
+	WorkspaceID  pgtype.UUID
+	Active       pgtype.Bool
+	CreatedFrom  pgtype.Timestamptz
+	CreatedTo    pgtype.Timestamptz
+	Search       pgtype.Text
+	CursorCode   pgtype.Text
+	CursorClicks pgtype.Int8
+	PageSize     int32
+}
+
+func (q *Queries) ListUserURLsByClicks(ctx context.Context, arg ListUserURLsByClicksParams) ([]Url, error) {
+	rows, err := q.db.Query(ctx, listUserURLsByClicks,
+		arg.UserID,
+		arg.WorkspaceID,
+		arg.Active,
+		arg.CreatedFrom,
+		arg.CreatedTo,
+		arg.Search,
+		arg.CursorCode,
+		arg.CursorClicks,
+		arg.PageSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Url
+	for rows.Next() {
+		var i Url
+		if err := rows.Scan(
+			&i.Shortened,
+			&i.Original,
+			&i.Clicks,
+			&i.CreatedAt,
+			&i.ExpiredAt,
+			&i.UserID,
+			&i.RedirectStatus,
+			&i.MaxClicks,
+			&i.PasswordHash,
+			&i.Title,
+			&i.WorkspaceID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUserURLsByCreated = `-- name: ListUserURLsByCreated :many
+SELECT shortened, original, clicks, created_at, expired_at, user_id, redirect_status, max_clicks, password_hash, title, workspace_id
+FROM urls
+WHERE ((user_id = $1::uuid AND workspace_id IS NULL) OR workspace_id = $2::uuid)
+  AND ($3::bool IS NULL OR (expired_at IS NULL OR expired_at > CURRENT_TIMESTAMP) = $3::bool)
+  AND ($4::timestamptz IS NULL OR created_at >= $4::timestamptz)
+  AND ($5::timestamptz IS NULL OR created_at < $5::timestamptz)
+  AND ($6::text IS NULL OR original ILIKE '%' || $6::text || '%')
+  AND ($7::text IS NULL OR (created_at, shortened) < ($8::timestamptz, $7::text))
+ORDER BY created_at DESC, shortened DESC
+LIMIT $9
+`
+
+type ListUserURLsByCreatedParams struct {
+	UserID          pgtype.UUID
+	WorkspaceID     pgtype.UUID
+	Active          pgtype.Bool
+	CreatedFrom     pgtype.Timestamptz
+	CreatedTo       pgtype.Timestamptz
+	Search          pgtype.Text
+	CursorCode      pgtype.Text
+	CursorCreatedAt pgtype.Timestamptz
+	PageSize        int32
+}
+
+func (q *Queries) ListUserURLsByCreated(ctx context.Context, arg ListUserURLsByCreatedParams) ([]Url, error) {
+	rows, err := q.db.Query(ctx, listUserURLsByCreated,
+		arg.UserID,
+		arg.WorkspaceID,
+		arg.Active,
+		arg.CreatedFrom,
+		arg.CreatedTo,
+		arg.Search,
+		arg.CursorCode,
+		arg.CursorCreatedAt,
+		arg.PageSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Url
+	for rows.Next() {
+		var i Url
+		if err := rows.Scan(
+			&i.Shortened,
+			&i.Original,
+			&i.Clicks,
+			&i.CreatedAt,
+			&i.ExpiredAt,
+			&i.UserID,
+			&i.RedirectStatus,
+			&i.MaxClicks,
+			&i.PasswordHash,
+			&i.Title,
+			&i.WorkspaceID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUserURLsByExpiry = `-- name: ListUserURLsByExpiry :many
+SELECT shortened, original, clicks, created_at, expired_at, user_id, redirect_status, max_clicks, password_hash, title, workspace_id
+FROM urls
+WHERE ((user_id = $1::uuid AND workspace_id IS NULL) OR workspace_id = $2::uuid)
+  AND ($3::bool IS NULL OR (expired_at IS NULL OR expired_at > CURRENT_TIMESTAMP) = $3::bool)
+  AND ($4::timestamptz IS NULL OR created_at >= $4::timestamptz)
+  AND ($5::timestamptz IS NULL OR created_at < $5::timestamptz)
+  AND ($6::text IS NULL OR original ILIKE '%' || $6::text || '%')
+  AND ($7::text IS NULL OR (COALESCE(expired_at, 'infinity'), shortened) > ($8::timestamptz, $7::text))
+ORDER BY COALESCE(expired_at, 'infinity') ASC, shortened ASC
+LIMIT $9
+`
+
+type ListUserURLsByExpiryParams struct {
+	UserID          pgtype.UUID
+	WorkspaceID     pgtype.UUID
+	Active          pgtype.Bool
+	CreatedFrom     pgtype.Timestamptz
+	CreatedTo       pgtype.Timestamptz
+	Search          pgtype.Text
+	CursorCode      pgtype.Text
+	CursorExpiredAt pgtype.Timestamptz
+	PageSize        int32
+}
+
+func (q *Queries) ListUserURLsByExpiry(ctx context.Context, arg ListUserURLsByExpiryParams) ([]Url, error) {
+	rows, err := q.db.Query(ctx, listUserURLsByExpiry,
+		arg.UserID,
+		arg.WorkspaceID,
+		arg.Active,
+		arg.CreatedFrom,
+		arg.CreatedTo,
+		arg.Search,
+		arg.CursorCode,
+		arg.CursorExpiredAt,
+		arg.PageSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Url
+	for rows.Next() {
+		var i Url
+		if err := rows.Scan(
+			&i.Shortened,
+			&i.Original,
+			&i.Clicks,
+			&i.CreatedAt,
+			&i.ExpiredAt,
+			&i.UserID,
+			&i.RedirectStatus,
+			&i.MaxClicks,
+			&i.PasswordHash,
+			&i.Title,
+			&i.WorkspaceID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUserWorkspaces = `-- name: ListUserWorkspaces :many
+SELECT w.id, w.name, w.created_by, w.created_at, m.role
+FROM workspace_members m
+JOIN workspaces w ON w.id = m.workspace_id
+WHERE m.user_id = $1
+ORDER BY w.created_at
+`
+
+type ListUserWorkspacesRow struct {
+	ID        pgtype.UUID
+	Name      string
+	CreatedBy pgtype.UUID
+	CreatedAt pgtype.Timestamptz
+	Role      string
+}
+
+func (q *Queries) ListUserWorkspaces(ctx context.Context, userID pgtype.UUID) ([]ListUserWorkspacesRow, error) {
+	rows, err := q.db.Query(ctx, listUserWorkspaces, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListUserWorkspacesRow
+	for rows.Next() {
+		var i ListUserWorkspacesRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.CreatedBy,
+			&i.CreatedAt,
+			&i.Role,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listVisitorSketches = `-- name: ListVisitorSketches :many
+SELECT shortened, period, sketch FROM visitor_sketches
+WHERE shortened = ANY($1::text[]) AND period = ANY($2::text[])
+`
+
+type ListVisitorSketchesParams struct {
+	Codes   []string
+	Periods []string
+}
+
+type ListVisitorSketchesRow struct {
+	Shortened string
+	Period    string
+	Sketch    []byte
+}
+
+func (q *Queries) ListVisitorSketches(ctx context.Context, arg ListVisitorSketchesParams) ([]ListVisitorSketchesRow, error) {
+	rows, err := q.db.Query(ctx, listVisitorSketches, arg.Codes, arg.Periods)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListVisitorSketchesRow
+	for rows.Next() {
+		var i ListVisitorSketchesRow
+		if err := rows.Scan(
+			&i.Shortened,
+			&i.Period,
+			&i.Sketch,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listWorkspaceMembers = `-- name: ListWorkspaceMembers :many
+SELECT m.user_id, m.role, m.created_at, u.email
+FROM workspace_members m
+JOIN users u ON u.user_id = m.user_id
+WHERE m.workspace_id = $1
+ORDER BY m.created_at
+`
+
+type ListWorkspaceMembersRow struct {
+	UserID    pgtype.UUID
+	Role      string
+	CreatedAt pgtype.Timestamptz
+	Email     pgtype.Text
+}
+
+func (q *Queries) ListWorkspaceMembers(ctx context.Context, workspaceID pgtype.UUID) ([]ListWorkspaceMembersRow, error) {
+	rows, err := q.db.Query(ctx, listWorkspaceMembers, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListWorkspaceMembersRow
+	for rows.Next() {
+		var i ListWorkspaceMembersRow
+		if err := rows.Scan(
+			&i.UserID,
+			&i.Role,
+			&i.CreatedAt,
+			&i.Email,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const lockClickRollupState = `-- name: LockClickRollupState :one
+SELECT rolled_up_to, CURRENT_TIMESTAMP::timestamptz AS now FROM click_rollup_state
+WHERE id = 1
+FOR UPDATE
+`
+
+type LockClickRollupStateRow struct {
+	RolledUpTo pgtype.Timestamptz
+	Now        pgtype.Timestamptz
+}
+
+func (q *Queries) LockClickRollupState(ctx context.Context) (LockClickRollupStateRow, error) {
+	row := q.db.QueryRow(ctx, lockClickRollupState)
+	var i LockClickRollupStateRow
+	err := row.Scan(&i.RolledUpTo, &i.Now)
+	return i, err
+}
+
+const lockWorkspace = `-- name: LockWorkspace :one
+SELECT id FROM workspaces
+WHERE id = $1
+FOR UPDATE
+`
+
+func (q *Queries) LockWorkspace(ctx context.Context, id pgtype.UUID) (pgtype.UUID, error) {
+	row := q.db.QueryRow(ctx, lockWorkspace, id)
+	err := row.Scan(&id)
+	return id, err
+}
+
+const removeWorkspaceMember = `-- name: RemoveWorkspaceMember :execrows
+DELETE FROM workspace_members
+WHERE workspace_id = $1 AND user_id = $2
+`
+
+type RemoveWorkspaceMemberParams struct {
+	WorkspaceID pgtype.UUID
+	UserID      pgtype.UUID
+}
+
+func (q *Queries) RemoveWorkspaceMember(ctx context.Context, arg RemoveWorkspaceMemberParams) (int64, error) {
+	result, err := q.db.Exec(ctx, removeWorkspaceMember, arg.WorkspaceID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const revokeAPIKey = `-- name: RevokeAPIKey :execrows
+UPDATE api_keys
+SET revoked_at = CURRENT_TIMESTAMP
+WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+`
+
+type RevokeAPIKeyParams struct {
+	ID     pgtype.UUID
+	UserID pgtype.UUID
+}
+
+func (q *Queries) RevokeAPIKey(ctx context.Context, arg RevokeAPIKeyParams) (int64, error) {
+	result, err := q.db.Exec(ctx, revokeAPIKey, arg.ID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const revokeSession = `-- name: RevokeSession :execrows
+UPDATE sessions
+SET revoked_at = CURRENT_TIMESTAMP
+WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+`
+
+type RevokeSessionParams struct {
+	ID     pgtype.UUID
+	UserID pgtype.UUID
+}
+
+func (q *Queries) RevokeSession(ctx context.Context, arg RevokeSessionParams) (int64, error) {
+	result, err := q.db.Exec(ctx, revokeSession, arg.ID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const revokeUserSessions = `-- name: RevokeUserSessions :many
+UPDATE sessions
+SET revoked_at = CURRENT_TIMESTAMP
+WHERE user_id = $1 AND revoked_at IS NULL
+RETURNING id
+`
+
+func (q *Queries) RevokeUserSessions(ctx context.Context, userID pgtype.UUID) ([]pgtype.UUID, error) {
+	rows, err := q.db.Query(ctx, revokeUserSessions, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []pgtype.UUID
+	for rows.Next() {
+		var id pgtype.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const rollUpClickBreakdowns = `-- name: RollUpClickBreakdowns :exec
+INSERT INTO click_breakdowns_daily (shortened, day, dimension, value, clicks)
+SELECT e.shortened, (e.clicked_at AT TIME ZONE 'UTC')::date AS day, d.dimension, d.value, COUNT(*)
+FROM click_events e
+CROSS JOIN LATERAL (VALUES ('referrer', e.referrer_domain),
+                           ('browser', e.browser),
+                           ('os', e.os),
+                           ('device', e.device)) AS d (dimension, value)
+WHERE e.ingested_at >= $1 AND e.ingested_at < $2 AND NOT e.is_bot
+GROUP BY e.shortened, day, d.dimension, d.value
+ON CONFLICT (shortened, day, dimension, value) DO UPDATE SET clicks = click_breakdowns_daily.clicks + EXCLUDED.clicks
+`
+
+type RollUpClickBreakdownsParams struct {
+	IngestedFrom pgtype.Timestamptz
+	IngestedTo   pgtype.Timestamptz
+}
+
+func (q *Queries) RollUpClickBreakdowns(ctx context.Context, arg RollUpClickBreakdownsParams) error {
+	_, err := q.db.Exec(ctx, rollUpClickBreakdowns, arg.IngestedFrom, arg.IngestedTo)
+	return err
+}
+
+const rollUpHourlyClicks = `-- name: RollUpHourlyClicks :exec
+INSERT INTO click_rollups_hourly (shortened, bucket, clicks, bot_clicks)
+SELECT shortened,
+       date_trunc('hour', clicked_at AT TIME ZONE 'UTC') AT TIME ZONE 'UTC' AS bucket,
+       COUNT(*) FILTER (WHERE NOT is_bot),
+       COUNT(*) FILTER (WHERE is_bot)
+FROM click_events
+WHERE ingested_at >= $1 AND ingested_at < $2
+GROUP BY shortened, bucket
+ON CONFLICT (shortened, bucket) DO UPDATE SET clicks = click_rollups_hourly.clicks + EXCLUDED.clicks,
+                                              bot_clicks = click_rollups_hourly.bot_clicks + EXCLUDED.bot_clicks
+`
+
+type RollUpHourlyClicksParams struct {
+	IngestedFrom pgtype.Timestamptz
+	IngestedTo   pgtype.Timestamptz
+}
+
+func (q *Queries) RollUpHourlyClicks(ctx context.Context, arg RollUpHourlyClicksParams) error {
+	_, err := q.db.Exec(ctx, rollUpHourlyClicks, arg.IngestedFrom, arg.IngestedTo)
+	return err
+}
+
+const rotateSession = `-- name: RotateSession :one
+UPDATE sessions
+SET refresh_hash = $1
+WHERE refresh_hash = $2 AND revoked_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+RETURNING id, user_id
+`
+
+type RotateSessionParams struct {
+	NewRefreshHash string
+	RefreshHash    string
+}
+
+type RotateSessionRow struct {
+	ID     pgtype.UUID
+	UserID pgtype.UUID
+}
+
+func (q *Queries) RotateSession(ctx context.Context, arg RotateSessionParams) (RotateSessionRow, error) {
+	row := q.db.QueryRow(ctx, rotateSession, arg.NewRefreshHash, arg.RefreshHash)
+	var i RotateSessionRow
+	err := row.Scan(&i.ID, &i.UserID)
+	return i, err
+}
+
+const searchAllURLs = `-- name: SearchAllURLs :many
+SELECT shortened, original, clicks, created_at, expired_at, user_id, redirect_status, max_clicks, password_hash, title, workspace_id
+FROM urls
+WHERE (original ILIKE '%' || $1::text || '%'
+    OR shortened ILIKE '%' || $1::text || '%'
+    OR title ILIKE '%' || $1::text || '%')
+  AND ($2::text IS NULL OR (created_at, shortened) < ($3::timestamptz, $2::text))
+ORDER BY created_at DESC, shortened DESC
+LIMIT $4
+`
+
+type SearchAllURLsParams struct {
+	Pattern         string
+	CursorCode      pgtype.Text
+	CursorCreatedAt pgtype.Timestamptz
+	PageSize        int32
+}
+
+func (q *Queries) SearchAllURLs(ctx context.Context, arg SearchAllURLsParams) ([]Url, error) {
+	rows, err := q.db.Query(ctx, searchAllURLs,
+		arg.Pattern,
+		arg.CursorCode,
+		arg.CursorCreatedAt,
+		arg.PageSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Url
+	for rows.Next() {
+		var i Url
+		if err := rows.Scan(
+			&i.Shortened,
+			&i.Original,
+			&i.Clicks,
+			&i.CreatedAt,
+			&i.ExpiredAt,
+			&i.UserID,
+			&i.RedirectStatus,
+			&i.MaxClicks,
+			&i.PasswordHash,
+			&i.Title,
+			&i.WorkspaceID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const searchByOriginalURL = `-- name: SearchByOriginalURL :many
+SELECT shortened, original, clicks, created_at, expired_at, user_id, redirect_status, max_clicks, password_hash, title, workspace_id
+FROM urls
+WHERE ((user_id = $1::uuid AND workspace_id IS NULL)
+    OR workspace_id IN (SELECT workspace_id FROM workspace_members WHERE user_id = $1::uuid))
+  AND (original ILIKE '%' || $2::text || '%'
+    OR shortened ILIKE '%' || $2::text || '%'
+    OR title ILIKE '%' || $2::text || '%')
+  AND ($3::text IS NULL OR (created_at, shortened) < ($4::timestamptz, $3::text))
+ORDER BY created_at DESC, shortened DESC
+LIMIT $5
+`
+
+type SearchByOriginalURLParams struct {
+	UserID          pgtype.UUID
+	Pattern         string
+	CursorCode      pgtype.Text
+	CursorCreatedAt pgtype.Timestamptz
+	PageSize        int32
+}
+
+func (q *Queries) SearchByOriginalURL(ctx context.Context, arg SearchByOriginalURLParams) ([]Url, error) {
+	rows, err := q.db.Query(ctx, searchByOriginalURL,
+		arg.UserID,
+		arg.Pattern,
+		arg.CursorCode,
+		arg.CursorCreatedAt,
+		arg.PageSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Url
+	for rows.Next() {
+		var i Url
+		if err := rows.Scan(
+			&i.Shortened,
+			&i.Original,
+			&i.Clicks,
+			&i.CreatedAt,
+			&i.ExpiredAt,
+			&i.UserID,
+			&i.RedirectStatus,
+			&i.MaxClicks,
+			&i.PasswordHash,
+			&i.Title,
+			&i.WorkspaceID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const shortenedExists = `-- name: ShortenedExists :one
+SELECT EXISTS(SELECT 1 FROM urls WHERE shortened = $1) AS exists
+`
+
+func (q *Queries) ShortenedExists(ctx context.Context, shortened string) (bool, error) {
+	row := q.db.QueryRow(ctx, shortenedExists, shortened)
+	var exists bool
+	err := row.Scan(&exists)
+	return exists, err
+}
+
+const touchAPIKey = `-- name: TouchAPIKey :exec
+UPDATE api_keys
+SET last_used_at = CURRENT_TIMESTAMP
+WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < CURRENT_TIMESTAMP - INTERVAL '1 minute')
+`
+
+func (q *Queries) TouchAPIKey(ctx context.Context, id pgtype.UUID) error {
+	_, err := q.db.Exec(ctx, touchAPIKey, id)
+	return err
+}
+
+const transferURL = `-- name: TransferURL :execrows
+UPDATE urls
+SET user_id = $1, workspace_id = $2
+WHERE shortened = $3 AND user_id = $4
+`
+
+type TransferURLParams struct {
+	ToUserID    pgtype.UUID
+	WorkspaceID pgtype.UUID
+	Shortened   string
+	FromUserID  pgtype.UUID
+}
+
+func (q *Queries) TransferURL(ctx context.Context, arg TransferURLParams) (int64, error) {
+	result, err := q.db.Exec(ctx, transferURL,
+		arg.ToUserID,
+		arg.WorkspaceID,
+		arg.Shortened,
+		arg.FromUserID,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const transferUserURLs = `-- name: TransferUserURLs :many
+UPDATE urls
+SET user_id = $1, workspace_id = $2
+WHERE user_id = $3 AND workspace_id IS NULL
+RETURNING shortened
+`
+
+type TransferUserURLsParams struct {
+	ToUserID    pgtype.UUID
+	WorkspaceID pgtype.UUID
+	FromUserID  pgtype.UUID
+}
+
+func (q *Queries) TransferUserURLs(ctx context.Context, arg TransferUserURLsParams) ([]string, error) {
+	rows, err := q.db.Query(ctx, transferUserURLs, arg.ToUserID, arg.WorkspaceID, arg.FromUserID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var shortened string
+		if err := rows.Scan(&shortened); err != nil {
+			return nil, err
+		}
+		items = append(items, shortened)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const updateClickRollupState = `-- name: UpdateClickRollupState :exec
+UPDATE click_rollup_state
+SET rolled_up_to = $1
+WHERE id = 1
+`
+
+func (q *Queries) UpdateClickRollupState(ctx context.Context, rolledUpTo pgtype.Timestamptz) error {
+	_, err := q.db.Exec(ctx, updateClickRollupState, rolledUpTo)
+	return err
+}
+
+const updateExpirationDate = `-- name: UpdateExpirationDate :exec
 UPDATE urls
 SET expired_at = $2
 WHERE shortened = $1
@@ -323,3 +1612,89 @@ func (q *Queries) UpdateURL(ctx context.Context, arg UpdateURLParams) error {
 	_, err := q.db.Exec(ctx, updateURL, arg.Shortened, arg.Clicks)
 	return err
 }
+
+const updateURLSettings = `-- name: UpdateURLSettings :exec
+UPDATE urls
+SET redirect_status = $2, max_clicks = $3, password_hash = $4, title = $5
+WHERE shortened = $1
+`
+
+type UpdateURLSettingsParams struct {
+	Shortened      string
+	RedirectStatus int32
+	MaxClicks      int64
+	PasswordHash   string
+	Title          string
+}
+
+func (q *Queries) UpdateURLSettings(ctx context.Context, arg UpdateURLSettingsParams) error {
+	_, err := q.db.Exec(ctx, updateURLSettings,
+		arg.Shortened,
+		arg.RedirectStatus,
+		arg.MaxClicks,
+		arg.PasswordHash,
+		arg.Title,
+	)
+	return err
+}
+
+const updateUserPassword = `-- name: UpdateUserPassword :exec
+UPDATE users
+SET password_hash = $2
+WHERE user_id = $1
+`
+
+type UpdateUserPasswordParams struct {
+	UserID       pgtype.UUID
+	PasswordHash string
+}
+
+func (q *Queries) UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) error {
+	_, err := q.db.Exec(ctx, updateUserPassword, arg.UserID, arg.PasswordHash)
+	return err
+}
+
+const upsertVisitorSketch = `-- name: UpsertVisitorSketch :exec
+INSERT INTO visitor_sketches (shortened, period, sketch)
+VALUES ($1, $2, $3)
+ON CONFLICT (shortened, period) DO UPDATE SET sketch = EXCLUDED.sketch, updated_at = CURRENT_TIMESTAMP
+`
+
+type UpsertVisitorSketchParams struct {
+	Shortened string
+	Period    string
+	Sketch    []byte
+}
+
+func (q *Queries) UpsertVisitorSketch(ctx context.Context, arg UpsertVisitorSketchParams) error {
+	_, err := q.db.Exec(ctx, upsertVisitorSketch, arg.Shortened, arg.Period, arg.Sketch)
+	return err
+}
+
+const upsertWorkspaceMember = `-- name: UpsertWorkspaceMember :exec
+INSERT INTO workspace_members (workspace_id, user_id, role)
+VALUES ($1, $2, $3)
+ON CONFLICT (workspace_id, user_id) DO UPDATE SET role = EXCLUDED.role
+`
+
+type UpsertWorkspaceMemberParams struct {
+	WorkspaceID pgtype.UUID
+	UserID      pgtype.UUID
+	Role        string
+}
+
+func (q *Queries) UpsertWorkspaceMember(ctx context.Context, arg UpsertWorkspaceMemberParams) error {
+	_, err := q.db.Exec(ctx, upsertWorkspaceMember, arg.WorkspaceID, arg.UserID, arg.Role)
+	return err
+}
+
+const userExists = `-- name: UserExists :one
+SELECT EXISTS(SELECT 1 FROM users WHERE user_id = $1) AS exists
+`
+
+func (q *Queries) UserExists(ctx context.Context, userID pgtype.UUID) (bool, error) {
+	row := q.db.QueryRow(ctx, userExists, userID)
+	var exists bool
+	err := row.Scan(&exists)
+	return exists, err
+}
@@ -0,0 +1,263 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// Allowed difference between our clock and the provider's.
+	clockSkew = time.Minute
+	// An unknown kid triggers a JWKS refetch at most this often.
+	jwksRefreshInterval = time.Minute
+)
+
+var ErrInvalidIDToken = errors.New("invalid ID token")
+
+// Claims are the ID token claims used to identify and provision a user.
+type Claims struct {
+	Issuer          string   `json:"iss"`
+	Subject         string   `json:"sub"`
+	Audience        audience `json:"aud"`
+	AuthorizedParty string   `json:"azp"`
+	Expiry          int64    `json:"exp"`
+	IssuedAt        int64    `json:"iat"`
+	Nonce           string   `json:"nonce"`
+	Email           string   `json:"email"`
+	EmailVerified   bool     `json:"email_verified"`
+	Name            string   `json:"name"`
+}
+
+// audience is a string or an array of strings in JWTs.
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return err
+	}
+	*a = many
+	return nil
+}
+
+type tokenHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// Verify checks the signature of a raw ID token against the provider's JWKS
+// and validates its issuer, audience, expiry and nonce.
+func (p *Provider) Verify(ctx context.Context, rawIDToken string, nonce string) (*Claims, error) {
+	parts := strings.Split(rawIDToken, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed token", ErrInvalidIDToken)
+	}
+
+	var header tokenHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: bad header", ErrInvalidIDToken)
+	}
+	// Only asymmetric algorithms are accepted; "none" and HMAC would let
+	// anyone holding the client secret, or nobody at all, mint tokens.
+	if header.Alg != "RS256" && header.Alg != "ES256" {
+		return nil, fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidIDToken, header.Alg)
+	}
+
+	key, err := p.publicKey(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: bad signature encoding", ErrInvalidIDToken)
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if !verifySignature(header.Alg, key, digest[:], signature) {
+		return nil, fmt.Errorf("%w: signature mismatch", ErrInvalidIDToken)
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: bad claims", ErrInvalidIDToken)
+	}
+
+	now := time.Now()
+	switch {
+	case claims.Issuer != p.config.Issuer:
+		return nil, fmt.Errorf("%w: unexpected issuer %q", ErrInvalidIDToken, claims.Issuer)
+	case !slices.Contains(claims.Audience, p.config.ClientID):
+		return nil, fmt.Errorf("%w: not issued for this client", ErrInvalidIDToken)
+	case len(claims.Audience) > 1 && claims.AuthorizedParty != p.config.ClientID:
+		return nil, fmt.Errorf("%w: azp does not match client", ErrInvalidIDToken)
+	case claims.Expiry == 0 || now.Add(-clockSkew).Unix() >= claims.Expiry:
+		return nil, fmt.Errorf("%w: token expired", ErrInvalidIDToken)
+	case claims.IssuedAt > now.Add(clockSkew).Unix():
+		return nil, fmt.Errorf("%w: issued in the future", ErrInvalidIDToken)
+	case claims.Subject == "":
+		return nil, fmt.Errorf("%w: missing subject", ErrInvalidIDToken)
+	case claims.Nonce != nonce:
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+	return &claims, nil
+}
+
+// publicKey returns the signing key with the given kid. Providers rotate
+// keys, so an unknown kid refetches the JWKS.
+func (p *Provider) publicKey(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	p.mu.RLock()
+	key, ok := p.lookupKey(kid)
+	stale := time.Since(p.keysFetched) > jwksRefreshInterval
+	p.mu.RUnlock()
+	if ok {
+		return key, nil
+	}
+	if !stale {
+		return nil, fmt.Errorf("%w: unknown signing key %q", ErrInvalidIDToken, kid)
+	}
+
+	keys, err := p.fetchKeys(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch JWKS: %v", err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.keys = keys
+	p.keysFetched = time.Now()
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("%w: unknown signing key %q", ErrInvalidIDToken, kid)
+}
+
+// lookupKey must be called with p.mu held. A token without a kid is only
+// accepted when the provider publishes a single key.
+func (p *Provider) lookupKey(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, true
+		}
+	}
+	key, ok := p.keys[kid]
+	return key, ok
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (p *Provider) fetchKeys(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := p.getJSON(ctx, p.jwksURL, &set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		// Keys of other types or curves are skipped rather than failing the
+		// whole set.
+		if key, err := jwk.publicKey(); err == nil {
+			keys[jwk.Kid] = key
+		}
+	}
+	return keys, nil
+}
+
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("RSA exponent too large")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+		if !key.Curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("point is not on the curve")
+		}
+		return key, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+func verifySignature(alg string, key crypto.PublicKey, digest []byte, signature []byte) bool {
+	switch alg {
+	case "RS256":
+		rsaKey, ok := key.(*rsa.PublicKey)
+		return ok && rsa.VerifyPKCS1v15(rsaKey, crypto.SHA256, digest, signature) == nil
+	case "ES256":
+		ecKey, ok := key.(*ecdsa.PublicKey)
+		// JWS encodes ES256 signatures as r || s, 32 bytes each.
+		if !ok || len(signature) != 64 {
+			return false
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		return ecdsa.Verify(ecKey, digest, r, s)
+	}
+	return false
+}
+
+func decodeSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || len(data) == 0 {
+		return nil, fmt.Errorf("bad key parameter")
+	}
+	return new(big.Int).SetBytes(data), nil
+}
@@ -0,0 +1,229 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testClientID = "shorten-url"
+	testNonce    = "nonce-1"
+	testKeyID    = "rsa-1"
+	testECKeyID  = "ec-1"
+)
+
+// testIssuer serves a discovery document and a JWKS with one RSA and one
+// P-256 key, and signs tokens with them.
+type testIssuer struct {
+	server *httptest.Server
+	rsaKey *rsa.PrivateKey
+	ecKey  *ecdsa.PrivateKey
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer := &testIssuer{rsaKey: rsaKey, ecKey: ecKey}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 issuer.server.URL,
+			"authorization_endpoint": issuer.server.URL + "/authorize",
+			"token_endpoint":         issuer.server.URL + "/token",
+			"jwks_uri":               issuer.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"keys": []map[string]string{
+				{
+					"kty": "RSA",
+					"kid": testKeyID,
+					"use": "sig",
+					"n":   encode(rsaKey.N.Bytes()),
+					"e":   encode(big.NewInt(int64(rsaKey.E)).Bytes()),
+				},
+				{
+					"kty": "EC",
+					"kid": testECKeyID,
+					"crv": "P-256",
+					"x":   encode(ecKey.X.FillBytes(make([]byte, 32))),
+					"y":   encode(ecKey.Y.FillBytes(make([]byte, 32))),
+				},
+			},
+		})
+	})
+	issuer.server = httptest.NewServer(mux)
+	t.Cleanup(issuer.server.Close)
+	return issuer
+}
+
+func (i *testIssuer) provider(t *testing.T) *Provider {
+	t.Helper()
+	provider, err := NewProvider(context.Background(), Config{
+		Issuer:       i.server.URL,
+		ClientID:     testClientID,
+		ClientSecret: "client secret",
+		RedirectURL:  "https://short.example/auth/oidc/callback",
+	})
+	if err != nil {
+		t.Fatalf("NewProvider: %v", err)
+	}
+	return provider
+}
+
+// claims returns a valid set of claims for the test client.
+func (i *testIssuer) claims() map[string]any {
+	now := time.Now()
+	return map[string]any{
+		"iss":   i.server.URL,
+		"sub":   "user-1",
+		"aud":   testClientID,
+		"iat":   now.Unix(),
+		"exp":   now.Add(5 * time.Minute).Unix(),
+		"nonce": testNonce,
+		"email": "user@example.com",
+	}
+}
+
+// sign encodes claims as a JWT with the given header, signed as its alg
+// says: RS256 and ES256 with the issuer's keys, HS256 with hmacKey and
+// "none" not at all.
+func (i *testIssuer) sign(t *testing.T, header map[string]string, claims map[string]any, hmacKey []byte) string {
+	t.Helper()
+	h, _ := json.Marshal(header)
+	c, _ := json.Marshal(claims)
+	signingInput := encode(h) + "." + encode(c)
+	digest := sha256.Sum256([]byte(signingInput))
+
+	var signature []byte
+	switch header["alg"] {
+	case "RS256":
+		var err error
+		if signature, err = rsa.SignPKCS1v15(rand.Reader, i.rsaKey, crypto.SHA256, digest[:]); err != nil {
+			t.Fatal(err)
+		}
+	case "ES256":
+		r, s, err := ecdsa.Sign(rand.Reader, i.ecKey, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	case "HS256":
+		mac := hmac.New(sha256.New, hmacKey)
+		mac.Write([]byte(signingInput))
+		signature = mac.Sum(nil)
+	}
+	return signingInput + "." + encode(signature)
+}
+
+func TestVerifyAcceptsValidTokens(t *testing.T) {
+	issuer := newTestIssuer(t)
+	provider := issuer.provider(t)
+
+	for _, header := range []map[string]string{
+		{"alg": "RS256", "kid": testKeyID},
+		{"alg": "ES256", "kid": testECKeyID},
+	} {
+		t.Run(header["alg"], func(t *testing.T) {
+			token := issuer.sign(t, header, issuer.claims(), nil)
+			claims, err := provider.Verify(context.Background(), token, testNonce)
+			if err != nil {
+				t.Fatalf("Verify: %v", err)
+			}
+			if claims.Subject != "user-1" || claims.Issuer != issuer.server.URL {
+				t.Errorf("claims = %+v", claims)
+			}
+		})
+	}
+}
+
+func TestVerifyRejectsBadTokens(t *testing.T) {
+	issuer := newTestIssuer(t)
+	provider := issuer.provider(t)
+	rs256 := map[string]string{"alg": "RS256", "kid": testKeyID}
+
+	with := func(key string, value any) map[string]any {
+		claims := issuer.claims()
+		claims[key] = value
+		return claims
+	}
+	// The claims of one token with the signature of another.
+	signed := strings.Split(issuer.sign(t, rs256, issuer.claims(), nil), ".")
+	forged := strings.Split(issuer.sign(t, rs256, with("sub", "admin"), nil), ".")
+	tampered := signed[0] + "." + forged[1] + "." + signed[2]
+
+	tests := []struct {
+		name  string
+		token string
+		nonce string
+	}{
+		{"wrong issuer", issuer.sign(t, rs256, with("iss", "https://evil.example"), nil), testNonce},
+		{"wrong audience", issuer.sign(t, rs256, with("aud", "another-client"), nil), testNonce},
+		{"several audiences without azp", issuer.sign(t, rs256, with("aud", []string{testClientID, "another-client"}), nil), testNonce},
+		{"wrong nonce", issuer.sign(t, rs256, issuer.claims(), nil), "nonce-2"},
+		{"missing nonce", issuer.sign(t, rs256, with("nonce", ""), nil), testNonce},
+		{"expired", issuer.sign(t, rs256, with("exp", time.Now().Add(-2*clockSkew).Unix()), nil), testNonce},
+		{"no expiry", issuer.sign(t, rs256, with("exp", 0), nil), testNonce},
+		{"issued in the future", issuer.sign(t, rs256, with("iat", time.Now().Add(2*clockSkew).Unix()), nil), testNonce},
+		{"missing subject", issuer.sign(t, rs256, with("sub", ""), nil), testNonce},
+		{"alg none", issuer.sign(t, map[string]string{"alg": "none", "kid": testKeyID}, issuer.claims(), nil), testNonce},
+		{"HS256 with the client secret", issuer.sign(t, map[string]string{"alg": "HS256", "kid": testKeyID}, issuer.claims(), []byte("client secret")), testNonce},
+		{"HS256 with the public key", issuer.sign(t, map[string]string{"alg": "HS256", "kid": testKeyID}, issuer.claims(), issuer.rsaKey.N.Bytes()), testNonce},
+		{"unknown kid", issuer.sign(t, map[string]string{"alg": "RS256", "kid": "rsa-2"}, issuer.claims(), nil), testNonce},
+		{"kid of the other key type", issuer.sign(t, map[string]string{"alg": "RS256", "kid": testECKeyID}, issuer.claims(), nil), testNonce},
+		{"tampered claims", tampered, testNonce},
+		{"malformed", "not.a-token", testNonce},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := provider.Verify(context.Background(), tt.token, tt.nonce)
+			if !errors.Is(err, ErrInvalidIDToken) {
+				t.Fatalf("Verify error = %v (claims %+v), want ErrInvalidIDToken", err, claims)
+			}
+		})
+	}
+}
+
+func TestCodeChallenge(t *testing.T) {
+	// The example from RFC 7636, appendix B.
+	if got := CodeChallenge("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"); got != "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM" {
+		t.Errorf("CodeChallenge = %q", got)
+	}
+
+	verifier, challenge, err := NewPKCE()
+	if err != nil {
+		t.Fatalf("NewPKCE: %v", err)
+	}
+	if len(verifier) < 43 || challenge != CodeChallenge(verifier) {
+		t.Errorf("NewPKCE = (%q, %q)", verifier, challenge)
+	}
+}
+
+func encode(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
@@ -0,0 +1,207 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"shorten-url/backend/pkg/db/sqlc"
+	"shorten-url/backend/pkg/utils"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	apiKeyPrefix       = "su_"
+	apiKeyBytes        = 32
+	apiKeyDisplayChars = 8
+	maxAPIKeyName      = 100
+)
+
+var (
+	ErrInvalidAPIKey     = errors.New("invalid API key")
+	ErrAPIKeyNotFound    = errors.New("API key not found")
+	ErrInvalidAPIKeyName = errors.New("API key name must be at most 100 characters")
+)
+
+// APIKey describes a key without its secret, which is only returned once by
+// CreateAPIKey.
+type APIKey struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	RevokedAt  *time.Time `json:"revokedAt,omitempty"`
+}
+
+// CreateAPIKey issues a new key for the user and returns it along with the
+// plaintext secret. Only a SHA-256 hash of the secret is stored, so it cannot
+// be shown again.
+func (s *UrlService) CreateAPIKey(userIDStr string, name string) (*APIKey, string, error) {
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return nil, "", ErrInvalidUserID
+	}
+	if len(name) > maxAPIKeyName {
+		return nil, "", ErrInvalidAPIKeyName
+	}
+	return createAPIKey(s.ctx, s.postgresClient.Queries, userID, name)
+}
+
+// ClaimLegacyUser issues the first key of a user from before API keys
+// existed, who has no email, key, login or session. It is for operators who
+// have verified out of band that the caller owns the userId. The claim and
+// the key are written in one transaction, and the claim is a single
+// conditional update, so a user can be claimed only once.
+func (s *UrlService) ClaimLegacyUser(userIDStr string) (*APIKey, string, error) {
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return nil, "", ErrInvalidUserID
+	}
+
+	tx, err := s.postgresClient.DB.Begin(s.ctx)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback(s.ctx)
+	queries := s.postgresClient.Queries.WithTx(tx)
+
+	if _, err := queries.ClaimLegacyUser(s.ctx, utils.ConvertFromUuidPg(userID)); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, "", ErrUserNotClaimable
+		}
+		return nil, "", fmt.Errorf("failed to claim user: %v", err)
+	}
+	key, secret, err := createAPIKey(s.ctx, queries, userID, "default")
+	if err != nil {
+		return nil, "", err
+	}
+	if err := tx.Commit(s.ctx); err != nil {
+		return nil, "", fmt.Errorf("failed to commit claim: %v", err)
+	}
+	return key, secret, nil
+}
+
+func createAPIKey(ctx context.Context, queries *sqlc.Queries, userID uuid.UUID, name string) (*APIKey, string, error) {
+	raw := make([]byte, apiKeyBytes)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, "", fmt.Errorf("failed to generate API key: %v", err)
+	}
+	secret := apiKeyPrefix + base64.RawURLEncoding.EncodeToString(raw)
+
+	key, err := queries.CreateAPIKey(ctx, sqlc.CreateAPIKeyParams{
+		UserID:  utils.ConvertFromUuidPg(userID),
+		Name:    name,
+		Prefix:  secret[:apiKeyDisplayChars],
+		KeyHash: hashToken(secret),
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create API key: %v", err)
+	}
+
+	return toAPIKey(key), secret, nil
+}
+
+func (s *UrlService) ListAPIKeys(userIDStr string) ([]APIKey, error) {
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return nil, ErrInvalidUserID
+	}
+
+	rows, err := s.postgresClient.Queries.ListAPIKeys(s.ctx, utils.ConvertFromUuidPg(userID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list API keys: %v", err)
+	}
+
+	keys := make([]APIKey, 0, len(rows))
+	for _, row := range rows {
+		keys = append(keys, *toAPIKey(row))
+	}
+	return keys, nil
+}
+
+// RevokeAPIKey disables a key of the user. Revoked keys stay listed so the
+// owner can see when they were retired.
+func (s *UrlService) RevokeAPIKey(userIDStr string, keyIDStr string) error {
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return ErrInvalidUserID
+	}
+	keyID, err := uuid.Parse(keyIDStr)
+	if err != nil {
+		return ErrAPIKeyNotFound
+	}
+
+	revoked, err := s.postgresClient.Queries.RevokeAPIKey(s.ctx, sqlc.RevokeAPIKeyParams{
+		ID:     utils.ConvertFromUuidPg(keyID),
+		UserID: utils.ConvertFromUuidPg(userID),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to revoke API key: %v", err)
+	}
+	if revoked == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// IsAPIKey tells API keys apart from other bearer tokens.
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, apiKeyPrefix)
+}
+
+// AuthenticateAPIKey resolves a bearer secret to the ID of the user owning
+// it.
+func (s *UrlService) AuthenticateAPIKey(secret string) (string, error) {
+	if !strings.HasPrefix(secret, apiKeyPrefix) {
+		return "", ErrInvalidAPIKey
+	}
+
+	key, err := s.postgresClient.Queries.GetAPIKeyByHash(s.ctx, hashToken(secret))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", ErrInvalidAPIKey
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to look up API key: %v", err)
+	}
+
+	// Bookkeeping only, the request does not wait for it.
+	go func() {
+		if err := s.postgresClient.Queries.TouchAPIKey(s.ctx, key.ID); err != nil {
+			log.Errorf("Failed to record API key use: %v", err)
+		}
+	}()
+
+	return utils.ConvertFromPgUuid(key.UserID).String(), nil
+}
+
+// hashToken is how API keys and other bearer secrets are stored. They are
+// long and random, so a fast hash is enough.
+func hashToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func toAPIKey(key sqlc.ApiKey) *APIKey {
+	apiKey := &APIKey{
+		ID:        utils.ConvertFromPgUuid(key.ID).String(),
+		Name:      key.Name,
+		Prefix:    key.Prefix,
+		CreatedAt: key.CreatedAt.Time,
+	}
+	if key.LastUsedAt.Valid {
+		apiKey.LastUsedAt = &key.LastUsedAt.Time
+	}
+	if key.RevokedAt.Valid {
+		apiKey.RevokedAt = &key.RevokedAt.Time
+	}
+	return apiKey
+}
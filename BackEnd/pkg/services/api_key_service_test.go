@@ -0,0 +1,59 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestClaimLegacyUser(t *testing.T) {
+	service, _, _ := newTestService(t)
+
+	legacy := uuid.NewString()
+	if err := service.CreateUser(legacy); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	withKey := uuid.NewString()
+	if err := service.CreateUser(withKey); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	if _, _, err := service.CreateAPIKey(withKey, "default"); err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+	account, _, err := service.SignUp("owner@example.com", "correct horse battery")
+	if err != nil {
+		t.Fatalf("SignUp: %v", err)
+	}
+
+	// Knowing a userId is not enough to take the account over.
+	if err := service.CreateUser(legacy); !errors.Is(err, ErrUserExists) {
+		t.Errorf("CreateUser with an existing id error = %v, want ErrUserExists", err)
+	}
+
+	tests := []struct {
+		name    string
+		userID  string
+		wantErr error
+	}{
+		{"legacy user", legacy, nil},
+		{"legacy user claimed twice", legacy, ErrUserNotClaimable},
+		{"user with an API key", withKey, ErrUserNotClaimable},
+		{"user with an email login", account.UserID, ErrUserNotClaimable},
+		{"unknown user", uuid.NewString(), ErrUserNotClaimable},
+		{"malformed id", "not-a-uuid", ErrInvalidUserID},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, secret, err := service.ClaimLegacyUser(tt.userID)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ClaimLegacyUser error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && (key == nil || !strings.HasPrefix(secret, apiKeyPrefix)) {
+				t.Errorf("ClaimLegacyUser = (%+v, %q), want a new key", key, secret)
+			}
+		})
+	}
+}
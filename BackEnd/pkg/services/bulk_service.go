@@ -0,0 +1,305 @@
+package services
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"shorten-url/backend/pkg/utils"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	MaxBulkItems = 1000
+	// Bounds how many items of one request are reserved and published at once.
+	bulkWorkers = 16
+)
+
+var (
+	ErrBulkTooLarge   = fmt.Errorf("a bulk request may contain at most %d items", MaxBulkItems)
+	ErrBulkEmpty      = errors.New("bulk request contains no items")
+	ErrBulkFormat     = errors.New("unsupported bulk format, expected json, ndjson or csv")
+	ErrBulkMissingURL = errors.New("missing url")
+)
+
+// BulkItem is one link of a bulk request. Fields mirror the query parameters
+// of POST /create.
+type BulkItem struct {
+	URL            string `json:"url"`
+	Alias          string `json:"alias"`
+	Title          string `json:"title"`
+	RedirectStatus int    `json:"redirectStatus"`
+	MaxClicks      int64  `json:"maxClicks"`
+	Burn           bool   `json:"burn"`
+	ExpiresAt      string `json:"expiresAt"`
+	TTL            string `json:"ttl"`
+	Password       string `json:"password"`
+	Workspace      string `json:"workspace"`
+
+	// parseErr records a row that could not be decoded, so it is reported in
+	// place instead of failing the whole request.
+	parseErr error
+}
+
+// BulkResult is the outcome of one BulkItem, at the same index as the input.
+type BulkResult struct {
+	Index    int    `json:"index"`
+	ShortURL string `json:"shortUrl,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// ParseBulkItems decodes a bulk request body. format is "json" (an array of
+// objects), "ndjson" (one object per line) or "csv" (a header row naming the
+// BulkItem fields, then one row per link).
+func ParseBulkItems(format string, body io.Reader) ([]BulkItem, error) {
+	var (
+		items []BulkItem
+		err   error
+	)
+	switch format {
+	case "json":
+		items, err = parseBulkJSON(body)
+	case "ndjson":
+		items, err = parseBulkNDJSON(body)
+	case "csv":
+		items, err = parseBulkCSV(body)
+	default:
+		return nil, ErrBulkFormat
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, ErrBulkEmpty
+	}
+	return items, nil
+}
+
+func parseBulkJSON(body io.Reader) ([]BulkItem, error) {
+	var raw []json.RawMessage
+	if err := json.NewDecoder(body).Decode(&raw); err != nil {
+		return nil, fmt.Errorf("invalid JSON array: %v", err)
+	}
+	if len(raw) > MaxBulkItems {
+		return nil, ErrBulkTooLarge
+	}
+
+	items := make([]BulkItem, len(raw))
+	for i, message := range raw {
+		if err := json.Unmarshal(message, &items[i]); err != nil {
+			items[i] = BulkItem{parseErr: fmt.Errorf("invalid item: %v", err)}
+		}
+	}
+	return items, nil
+}
+
+func parseBulkNDJSON(body io.Reader) ([]BulkItem, error) {
+	var items []BulkItem
+	scanner := bufio.NewScanner(body)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if len(items) == MaxBulkItems {
+			return nil, ErrBulkTooLarge
+		}
+		var item BulkItem
+		if err := json.Unmarshal([]byte(line), &item); err != nil {
+			item = BulkItem{parseErr: fmt.Errorf("invalid line: %v", err)}
+		}
+		items = append(items, item)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read NDJSON: %v", err)
+	}
+	return items, nil
+}
+
+func parseBulkCSV(body io.Reader) ([]BulkItem, error) {
+	reader := csv.NewReader(body)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV header: %v", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["url"]; !ok {
+		return nil, errors.New("CSV header must contain a url column")
+	}
+
+	var items []BulkItem
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if len(items) == MaxBulkItems {
+			return nil, ErrBulkTooLarge
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if !errors.As(err, &parseErr) {
+				return nil, fmt.Errorf("failed to read CSV: %v", err)
+			}
+			items = append(items, BulkItem{parseErr: fmt.Errorf("invalid row: %v", err)})
+			continue
+		}
+		items = append(items, bulkItemFromRecord(columns, record))
+	}
+	return items, nil
+}
+
+func bulkItemFromRecord(columns map[string]int, record []string) BulkItem {
+	field := func(name string) string {
+		if i, ok := columns[strings.ToLower(name)]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	item := BulkItem{
+		URL:       field("url"),
+		Alias:     field("alias"),
+		Title:     field("title"),
+		ExpiresAt: field("expiresAt"),
+		TTL:       field("ttl"),
+		Password:  field("password"),
+		Workspace: field("workspace"),
+	}
+	var err error
+	if value := field("redirectStatus"); value != "" {
+		if item.RedirectStatus, err = strconv.Atoi(value); err != nil {
+			item.parseErr = errors.New("invalid redirectStatus")
+		}
+	}
+	if value := field("maxClicks"); value != "" {
+		if item.MaxClicks, err = strconv.ParseInt(value, 10, 64); err != nil {
+			item.parseErr = errors.New("invalid maxClicks")
+		}
+	}
+	if value := field("burn"); value != "" {
+		if item.Burn, err = strconv.ParseBool(value); err != nil {
+			item.parseErr = errors.New("invalid burn")
+		}
+	}
+	return item
+}
+
+// options validates the request-level fields of an item and converts them
+// into CreateURLOptions, the same way the /create handler does.
+func (item BulkItem) options(now time.Time) (CreateURLOptions, error) {
+	if item.parseErr != nil {
+		return CreateURLOptions{}, item.parseErr
+	}
+	if item.URL == "" {
+		return CreateURLOptions{}, ErrBulkMissingURL
+	}
+
+	opts := CreateURLOptions{
+		RedirectStatus: item.RedirectStatus,
+		Alias:          item.Alias,
+		MaxClicks:      item.MaxClicks,
+		Password:       item.Password,
+		Title:          item.Title,
+		WorkspaceID:    item.Workspace,
+	}
+	if item.Burn {
+		if opts.MaxClicks > 1 {
+			return CreateURLOptions{}, errors.New("burn and maxClicks are mutually exclusive")
+		}
+		opts.MaxClicks = 1
+	}
+
+	expiresAt, never, err := utils.ParseExpiry(item.ExpiresAt, item.TTL, now)
+	if err != nil {
+		return CreateURLOptions{}, err
+	}
+	opts.ExpiresAt = expiresAt
+	opts.NeverExpires = never
+	return opts, nil
+}
+
+// CreateURLs creates every item through CreateURL, so each link goes through
+// the same reservation and queue as a single create. A failing item does not
+// stop the others; its error is reported in its result instead.
+func (s *UrlService) CreateURLs(port string, userIDStr string, items []BulkItem) ([]BulkResult, error) {
+	if len(items) == 0 {
+		return nil, ErrBulkEmpty
+	}
+	if len(items) > MaxBulkItems {
+		return nil, ErrBulkTooLarge
+	}
+	if _, err := uuid.Parse(userIDStr); err != nil {
+		return nil, ErrInvalidUserID
+	}
+
+	now := time.Now()
+	results := make([]BulkResult, len(items))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < bulkWorkers && w < len(items); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				results[i] = s.createBulkItem(port, userIDStr, i, items[i], now)
+			}
+		}()
+	}
+	for i := range items {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	return results, nil
+}
+
+func (s *UrlService) createBulkItem(port string, userID string, index int, item BulkItem, now time.Time) BulkResult {
+	result := BulkResult{Index: index}
+	opts, err := item.options(now)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	result.ShortURL, err = s.CreateURL(port, item.URL, userID, opts)
+	if err != nil {
+		result.Error = err.Error()
+		if !isItemError(err) {
+			// Do not leak backend details into the per-item result.
+			log.Errorf("Failed to create bulk item %d: %v", index, err)
+			result.Error = "failed to create URL"
+		}
+	}
+	return result
+}
+
+// isItemError reports whether a CreateURL error was caused by the item
+// itself rather than by a backend failure.
+func isItemError(err error) bool {
+	for _, target := range []error{
+		ErrInvalidRedirectStatus, ErrInvalidAlias, ErrAliasTaken, ErrInvalidExpiry,
+		ErrInvalidMaxClicks, ErrInvalidPassword, ErrInvalidURL, ErrInvalidTitle,
+		ErrWorkspaceNotFound, ErrWorkspaceForbidden, ErrCodeExhausted,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,132 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseBulkItems(t *testing.T) {
+	tests := []struct {
+		name      string
+		format    string
+		body      string
+		wantURLs  []string
+		wantBadAt []int
+		wantErr   error
+	}{
+		{
+			name:     "json array",
+			format:   "json",
+			body:     `[{"url": "https://a.example"}, {"url": "https://b.example", "maxClicks": 3}]`,
+			wantURLs: []string{"https://a.example", "https://b.example"},
+		},
+		{
+			name:      "json item of the wrong type",
+			format:    "json",
+			body:      `[{"url": "https://a.example"}, {"url": 42}]`,
+			wantURLs:  []string{"https://a.example", ""},
+			wantBadAt: []int{1},
+		},
+		{
+			name:      "ndjson with a blank and a broken line",
+			format:    "ndjson",
+			body:      "{\"url\": \"https://a.example\"}\n\n{\"url\": \n{\"url\": \"https://b.example\"}\n",
+			wantURLs:  []string{"https://a.example", "", "https://b.example"},
+			wantBadAt: []int{1},
+		},
+		{
+			name:     "csv with columns in any order and case",
+			format:   "csv",
+			body:     "Title, URL, maxClicks\nDocs, https://a.example, 2\n, https://b.example,\n",
+			wantURLs: []string{"https://a.example", "https://b.example"},
+		},
+		{
+			name:      "csv with bad numbers",
+			format:    "csv",
+			body:      "url,maxClicks,burn,redirectStatus\nhttps://a.example,many,,\nhttps://b.example,,maybe,\nhttps://c.example,,,moved\n",
+			wantURLs:  []string{"https://a.example", "https://b.example", "https://c.example"},
+			wantBadAt: []int{0, 1, 2},
+		},
+		{
+			name:      "csv with a broken quote",
+			format:    "csv",
+			body:      "url\n\"https://a.example\nhttps://b.example\n",
+			wantURLs:  []string{""},
+			wantBadAt: []int{0},
+		},
+		{name: "csv without a url column", format: "csv", body: "link\nhttps://a.example\n", wantErr: errAny},
+		{name: "not a json array", format: "json", body: `{"url": "https://a.example"}`, wantErr: errAny},
+		{name: "empty json array", format: "json", body: `[]`, wantErr: ErrBulkEmpty},
+		{name: "empty ndjson", format: "ndjson", body: "\n\n", wantErr: ErrBulkEmpty},
+		{name: "too many items", format: "ndjson", body: strings.Repeat("{}\n", MaxBulkItems+1), wantErr: ErrBulkTooLarge},
+		{name: "unknown format", format: "xml", body: "<links/>", wantErr: ErrBulkFormat},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items, err := ParseBulkItems(tt.format, strings.NewReader(tt.body))
+			if tt.wantErr != nil {
+				if err == nil || tt.wantErr != errAny && !errors.Is(err, tt.wantErr) {
+					t.Fatalf("ParseBulkItems error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseBulkItems: %v", err)
+			}
+			if len(items) != len(tt.wantURLs) {
+				t.Fatalf("got %d items, want %d", len(items), len(tt.wantURLs))
+			}
+			for i, item := range items {
+				if item.URL != tt.wantURLs[i] {
+					t.Errorf("item %d url = %q, want %q", i, item.URL, tt.wantURLs[i])
+				}
+				bad := false
+				for _, j := range tt.wantBadAt {
+					bad = bad || i == j
+				}
+				if (item.parseErr != nil) != bad {
+					t.Errorf("item %d parse error = %v, want error %v", i, item.parseErr, bad)
+				}
+			}
+		})
+	}
+}
+
+func TestBulkItemOptions(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		item    BulkItem
+		want    CreateURLOptions
+		wantErr bool
+	}{
+		{"plain link", BulkItem{URL: "https://a.example"}, CreateURLOptions{}, false},
+		{"burn after reading", BulkItem{URL: "https://a.example", Burn: true}, CreateURLOptions{MaxClicks: 1}, false},
+		{"burn with one click", BulkItem{URL: "https://a.example", Burn: true, MaxClicks: 1}, CreateURLOptions{MaxClicks: 1}, false},
+		{"ttl", BulkItem{URL: "https://a.example", TTL: "1h"}, CreateURLOptions{ExpiresAt: now.Add(time.Hour)}, false},
+		{"never expires", BulkItem{URL: "https://a.example", TTL: "never"}, CreateURLOptions{NeverExpires: true}, false},
+		{"burn with more clicks", BulkItem{URL: "https://a.example", Burn: true, MaxClicks: 2}, CreateURLOptions{}, true},
+		{"missing url", BulkItem{Alias: "docs"}, CreateURLOptions{}, true},
+		{"row that did not parse", BulkItem{URL: "https://a.example", parseErr: errAny}, CreateURLOptions{}, true},
+		{"bad expiry", BulkItem{URL: "https://a.example", ExpiresAt: "tomorrow"}, CreateURLOptions{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts, err := tt.item.options(now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("options error = %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && opts != tt.want {
+				t.Errorf("options = %+v, want %+v", opts, tt.want)
+			}
+		})
+	}
+}
+
+// errAny stands for any error in tables whose errors are not sentinels.
+var errAny = errors.New("any error")
@@ -0,0 +1,240 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"shorten-url/backend/pkg/db/sqlc"
+	"shorten-url/backend/pkg/stores"
+	"shorten-url/backend/pkg/utils"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/redis/go-redis/v9"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// Events waiting to be published; redirects drop events rather than
+	// wait once it is full.
+	clickBufferSize = 10000
+	// Monthly click_events partitions are created this many months ahead.
+	clickPartitionsAhead = 2
+	// More hits than this on one link from one address within the window
+	// are treated as automated.
+	repeatHitLimit  = 5
+	repeatHitWindow = 10 * time.Second
+
+	maxReferrerLength  = 2048
+	maxUserAgentLength = 512
+	maxLanguageLength  = 35
+)
+
+// ClickEvent is one redirect as recorded in click_events. IPPrefix is
+// already anonymized by the caller. Visitor is the fingerprint counted in the
+// unique visitor sketches; it never leaves the instance. Bot clicks are kept
+// for analytics but left out of the click count and unique visitors.
+type ClickEvent struct {
+	Shortened string    `json:"shortened"`
+	ClickedAt time.Time `json:"clicked_at"`
+	Referrer  string    `json:"referrer,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	Language  string    `json:"language,omitempty"`
+	IPPrefix  string    `json:"ip_prefix,omitempty"`
+	Bot       bool      `json:"bot,omitempty"`
+	Visitor   string    `json:"-"`
+}
+
+var droppedClicks atomic.Int64
+
+// repeatHitScript counts hits in a window that starts with the first one.
+var repeatHitScript = redis.NewScript(`
+local hits = redis.call('INCR', KEYS[1])
+if hits == 1 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+return hits
+`)
+
+// ClickQueue is the RabbitMQ queue carrying click events of one instance.
+func ClickQueue(port string) string {
+	return "click-events-" + port
+}
+
+// RecordClick queues a click event without blocking the redirect. When the
+// buffer is full the event is dropped and counted.
+func (s *UrlService) RecordClick(event ClickEvent) {
+	event.Referrer = truncate(event.Referrer, maxReferrerLength)
+	event.UserAgent = truncate(event.UserAgent, maxUserAgentLength)
+	event.Language = truncate(primaryLanguage(event.Language), maxLanguageLength)
+
+	select {
+	case s.clickEvents <- event:
+	default:
+		if dropped := droppedClicks.Add(1); dropped%1000 == 1 {
+			log.Warnf("Click buffer full, %d click events dropped so far", dropped)
+		}
+	}
+}
+
+// PublishClickEvents counts the visitor of each buffered click event and
+// moves the event onto the instance's click queue. It runs for the lifetime
+// of the server.
+func (s *UrlService) PublishClickEvents(port string) {
+	for event := range s.clickEvents {
+		if err := s.recordVisitor(event); err != nil {
+			log.Errorf("Failed to count visitor for %s: %v", event.Shortened, err)
+		}
+
+		body, err := json.Marshal(event)
+		if err != nil {
+			log.Errorf("Failed to marshal click event: %v", err)
+			continue
+		}
+
+		err = stores.RabbitMQClient.Channel.Publish(
+			"",
+			ClickQueue(port),
+			false,
+			false,
+			amqp.Publishing{
+				ContentType: "application/json",
+				Body:        body,
+			},
+		)
+		if err != nil {
+			log.Errorf("Failed to publish click event for %s: %v", event.Shortened, err)
+		}
+	}
+}
+
+// ProcessClickBatch consumes click events and writes them to click_events in
+// batches. Messages are acknowledged only once their batch is stored, so a
+// failed insert is redelivered instead of lost.
+func (s *UrlService) ProcessClickBatch(port string, consumerTag string, batchSize int, batchTimeout time.Duration) {
+	msgs, err := stores.RabbitMQClient.Channel.Consume(
+		ClickQueue(port),
+		consumerTag,
+		false,
+		false,
+		false,
+		false,
+		nil,
+	)
+	if err != nil {
+		log.Fatalf("Failed to register click consumer: %v", err)
+	}
+
+	batch := make([]ClickEvent, 0, batchSize)
+	deliveries := make([]amqp.Delivery, 0, batchSize)
+	timer := time.NewTimer(batchTimeout)
+
+	flush := func() {
+		if len(batch) > 0 {
+			err := s.insertClickEvents(batch)
+			for _, delivery := range deliveries {
+				if err != nil {
+					delivery.Nack(false, true)
+				} else {
+					delivery.Ack(false)
+				}
+			}
+			if err != nil {
+				log.Errorf("Consumer %s: failed to insert %d click events: %v", consumerTag, len(batch), err)
+			}
+			batch = batch[:0]
+			deliveries = deliveries[:0]
+		}
+		timer.Reset(batchTimeout)
+	}
+
+	for {
+		select {
+		case msg := <-msgs:
+			var event ClickEvent
+			if err := json.Unmarshal(msg.Body, &event); err != nil {
+				log.Printf("Consumer %s: Failed to unmarshal click event: %v", consumerTag, err)
+				msg.Nack(false, false)
+				continue
+			}
+
+			batch = append(batch, event)
+			deliveries = append(deliveries, msg)
+			if len(batch) >= batchSize {
+				flush()
+			}
+
+		case <-timer.C:
+			flush()
+		}
+	}
+}
+
+func (s *UrlService) insertClickEvents(batch []ClickEvent) error {
+	params := sqlc.BatchInsertClickEventsParams{
+		Column1:  make([]pgtype.Timestamptz, len(batch)),
+		Column2:  make([]string, len(batch)),
+		Column3:  make([]string, len(batch)),
+		Column4:  make([]string, len(batch)),
+		Column5:  make([]string, len(batch)),
+		Column6:  make([]string, len(batch)),
+		Column7:  make([]bool, len(batch)),
+		Column8:  make([]string, len(batch)),
+		Column9:  make([]string, len(batch)),
+		Column10: make([]string, len(batch)),
+		Column11: make([]string, len(batch)),
+	}
+	for i, event := range batch {
+		// Parsed here once, so the rollup job can group in SQL.
+		agent := utils.ParseUserAgent(event.UserAgent)
+		params.Column1[i] = pgtype.Timestamptz{Time: event.ClickedAt, Valid: true}
+		params.Column2[i] = event.Shortened
+		params.Column3[i] = event.Referrer
+		params.Column4[i] = event.UserAgent
+		params.Column5[i] = event.Language
+		params.Column6[i] = event.IPPrefix
+		params.Column7[i] = event.Bot
+		params.Column8[i] = truncate(utils.ReferrerDomain(event.Referrer), maxBreakdownLength)
+		params.Column9[i] = agent.Browser
+		params.Column10[i] = agent.OS
+		params.Column11[i] = agent.Device
+	}
+	return s.postgresClient.Queries.BatchInsertClickEvents(s.ctx, params)
+}
+
+// EnsureClickPartitions creates the click_events partitions for the current
+// month and the next few. Rows for months without a partition land in
+// click_events_default, which would block creating that month later, so
+// partitions must exist before their month starts.
+func (s *UrlService) EnsureClickPartitions(now time.Time) error {
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i <= clickPartitionsAhead; i++ {
+		from := month.AddDate(0, i, 0)
+		to := from.AddDate(0, 1, 0)
+		// Partition names and bounds come from time.Format, never from input.
+		_, err := s.postgresClient.DB.Exec(s.ctx, fmt.Sprintf(
+			"CREATE TABLE IF NOT EXISTS click_events_%s PARTITION OF click_events FOR VALUES FROM ('%s') TO ('%s')",
+			from.Format("2006_01"), from.Format(time.RFC3339), to.Format(time.RFC3339),
+		))
+		if err != nil {
+			return fmt.Errorf("failed to create click_events partition for %s: %w", from.Format("2006-01"), err)
+		}
+	}
+	return nil
+}
+
+// primaryLanguage keeps the first tag of an Accept-Language header.
+func primaryLanguage(acceptLanguage string) string {
+	tag, _, _ := strings.Cut(acceptLanguage, ",")
+	tag, _, _ = strings.Cut(tag, ";")
+	return strings.TrimSpace(tag)
+}
+
+func truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	return strings.ToValidUTF8(s[:max], "")
+}
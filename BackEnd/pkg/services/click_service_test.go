@@ -0,0 +1,72 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestPrimaryLanguage(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"", ""},
+		{"en-US", "en-US"},
+		{"fr-CH, fr;q=0.9, en;q=0.8", "fr-CH"},
+		{"de;q=0.7", "de"},
+		{"  pt-BR ,en", "pt-BR"},
+		{"*", "*"},
+	}
+	for _, tt := range tests {
+		if got := primaryLanguage(tt.header); got != tt.want {
+			t.Errorf("primaryLanguage(%q) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		max  int
+		want string
+	}{
+		{"short", "abc", 5, "abc"},
+		{"exact", "abcde", 5, "abcde"},
+		{"long", "abcdef", 5, "abcde"},
+		{"inside a rune", "abcdé", 5, "abcd"},
+		{"after a rune", "abcéd", 5, "abcé"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := truncate(tt.s, tt.max)
+			if got != tt.want {
+				t.Errorf("truncate(%q, %d) = %q, want %q", tt.s, tt.max, got, tt.want)
+			}
+			if !utf8.ValidString(got) {
+				t.Errorf("truncate(%q, %d) is not valid UTF-8", tt.s, tt.max)
+			}
+		})
+	}
+}
+
+func TestRecordClickTrimsEvents(t *testing.T) {
+	service, _, _ := newTestService(t)
+	service.RecordClick(ClickEvent{
+		Shortened: "abc",
+		ClickedAt: time.Now(),
+		Referrer:  "https://example.com/?q=" + strings.Repeat("a", maxReferrerLength),
+		UserAgent: strings.Repeat("b", maxUserAgentLength+1),
+		Language:  "en-GB,en;q=0.9",
+	})
+
+	event := <-service.clickEvents
+	if len(event.Referrer) != maxReferrerLength || len(event.UserAgent) != maxUserAgentLength {
+		t.Errorf("lengths = (%d, %d), want (%d, %d)", len(event.Referrer), len(event.UserAgent), maxReferrerLength, maxUserAgentLength)
+	}
+	if event.Language != "en-GB" {
+		t.Errorf("Language = %q, want en-GB", event.Language)
+	}
+}
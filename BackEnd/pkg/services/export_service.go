@@ -0,0 +1,191 @@
+package services
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"shorten-url/backend/pkg/db/sqlc"
+	"shorten-url/backend/pkg/utils"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Rows fetched per GetURLsByUser call while exporting.
+const exportPageSize = 500
+
+var ErrExportFormat = errors.New("unsupported export format, expected csv, json or ndjson")
+
+var exportCSVHeader = []string{
+	"shortened", "original", "title", "clicks", "created_at", "expired_at",
+	"expired", "redirect_status", "max_clicks", "protected",
+}
+
+// ExportContentType returns the media type and file extension for an export
+// format, or ErrExportFormat.
+func ExportContentType(format string) (string, string, error) {
+	switch format {
+	case "csv":
+		return "text/csv; charset=utf-8", "csv", nil
+	case "json":
+		return "application/json", "json", nil
+	case "ndjson":
+		return "application/x-ndjson", "ndjson", nil
+	}
+	return "", "", ErrExportFormat
+}
+
+func (s *UrlService) ExportURLs(userIDStr string, format string, w io.Writer) error {
+	return ExportURLs(s.ctx, s.postgresClient.Queries, userIDStr, format, w)
+}
+
+// ExportURLs streams every link of a user to w, newest first. Rows are read
+// from GetURLsByUser one page at a time, so memory stays flat however many
+// links the user owns. It is a plain function so the export CLI can run it
+// without Redis or RabbitMQ.
+func ExportURLs(ctx context.Context, queries *sqlc.Queries, userIDStr string, format string, w io.Writer) error {
+	if _, _, err := ExportContentType(format); err != nil {
+		return err
+	}
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return ErrInvalidUserID
+	}
+
+	writer := newExportWriter(format, w)
+	if err := writer.begin(); err != nil {
+		return err
+	}
+
+	params := sqlc.GetURLsByUserParams{
+		UserID:   utils.ConvertFromUuidPg(userID),
+		PageSize: exportPageSize,
+	}
+	for {
+		rows, err := queries.GetURLsByUser(ctx, params)
+		if err != nil {
+			return fmt.Errorf("failed to read URLs: %v", err)
+		}
+
+		now := time.Now()
+		for _, row := range rows {
+			if err := writer.write(toURLInfo(row, now)); err != nil {
+				return err
+			}
+		}
+		if err := writer.flush(); err != nil {
+			return err
+		}
+
+		if len(rows) < exportPageSize {
+			break
+		}
+		last := rows[len(rows)-1]
+		params.CursorCode = pgtype.Text{String: last.Shortened, Valid: true}
+		params.CursorCreatedAt = last.CreatedAt
+	}
+
+	return writer.end()
+}
+
+// exportWriter encodes URLInfo records in one of the export formats.
+type exportWriter struct {
+	format string
+	out    io.Writer
+	csv    *csv.Writer
+	json   *json.Encoder
+	count  int
+}
+
+func newExportWriter(format string, w io.Writer) *exportWriter {
+	writer := &exportWriter{format: format, out: w}
+	switch format {
+	case "csv":
+		writer.csv = csv.NewWriter(w)
+	default:
+		writer.json = json.NewEncoder(w)
+	}
+	return writer
+}
+
+func (e *exportWriter) begin() error {
+	switch e.format {
+	case "csv":
+		return e.csv.Write(exportCSVHeader)
+	case "json":
+		_, err := io.WriteString(e.out, "[\n")
+		return err
+	}
+	return nil
+}
+
+func (e *exportWriter) write(info URLInfo) error {
+	defer func() { e.count++ }()
+
+	if e.format == "csv" {
+		expiredAt := ""
+		if info.ExpiredAt != nil {
+			expiredAt = info.ExpiredAt.Format(time.RFC3339)
+		}
+		return e.csv.Write([]string{
+			csvCell(info.Shortened),
+			csvCell(info.Original),
+			csvCell(info.Title),
+			strconv.Itoa(info.Clicks),
+			info.CreatedAt.Format(time.RFC3339),
+			expiredAt,
+			strconv.FormatBool(info.Expired),
+			strconv.Itoa(info.RedirectStatus),
+			strconv.FormatInt(info.MaxClicks, 10),
+			strconv.FormatBool(info.Protected),
+		})
+	}
+
+	// A JSON array is written element by element with the encoder's own
+	// trailing newline, so a large export is never held in memory.
+	if e.format == "json" && e.count > 0 {
+		if _, err := io.WriteString(e.out, ","); err != nil {
+			return err
+		}
+	}
+	return e.json.Encode(info)
+}
+
+// csvCell quotes a user-controlled value that a spreadsheet would run as a
+// formula, so opening an export cannot execute what a link's owner typed.
+func csvCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// flush pushes the current page to the client.
+func (e *exportWriter) flush() error {
+	if e.csv != nil {
+		e.csv.Flush()
+		if err := e.csv.Error(); err != nil {
+			return err
+		}
+	}
+	if flusher, ok := e.out.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return nil
+}
+
+func (e *exportWriter) end() error {
+	if e.format == "json" {
+		if _, err := io.WriteString(e.out, "]\n"); err != nil {
+			return err
+		}
+	}
+	return e.flush()
+}
@@ -0,0 +1,66 @@
+package services
+
+import (
+	"bytes"
+	"encoding/csv"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestCSVCell(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"https://example.com/", "https://example.com/"},
+		{"=HYPERLINK(\"https://evil.example\")", "'=HYPERLINK(\"https://evil.example\")"},
+		{"+1+1", "'+1+1"},
+		{"-2+3", "'-2+3"},
+		{"@SUM(A1)", "'@SUM(A1)"},
+		{"\t=1", "'\t=1"},
+		{"\r=1", "'\r=1"},
+		{"a=1", "a=1"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := csvCell(tt.in); got != tt.want {
+			t.Errorf("csvCell(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestExportCSVNeutralizesFormulas(t *testing.T) {
+	var out bytes.Buffer
+	writer := newExportWriter("csv", &out)
+	info := URLInfo{
+		Shortened: "-promo",
+		Original:  "https://example.com/?q=1",
+		Title:     "=cmd|' /C calc'!A0",
+		Clicks:    -1,
+		CreatedAt: time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC),
+	}
+	if err := writer.begin(); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.write(info); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.end(); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := csv.NewReader(&out).ReadAll()
+	if err != nil {
+		t.Fatalf("export is not valid CSV: %v", err)
+	}
+	if !slices.Equal(records[0], exportCSVHeader) {
+		t.Errorf("header = %v", records[0])
+	}
+	// Only user-controlled cells are quoted; numbers written by the export
+	// stay numbers.
+	want := []string{"'-promo", "https://example.com/?q=1", "'=cmd|' /C calc'!A0", "-1"}
+	if got := records[1][:4]; !slices.Equal(got, want) {
+		t.Errorf("row = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,445 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"shorten-url/backend/pkg/db/sqlc"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// fakeDB is an in-memory stand-in for the Postgres pool that answers the
+// sqlc queries the service tests need, dispatching on the query name. Writes
+// made inside a transaction are applied immediately and not rolled back.
+type fakeDB struct {
+	mu       sync.Mutex
+	users    map[uuid.UUID]*fakeUser
+	emails   map[string]uuid.UUID
+	sessions map[uuid.UUID]*fakeSession
+	// Keyed by issuer and subject.
+	identities map[[2]string]uuid.UUID
+	urls       map[string]sqlc.Url
+	// Links another instance stores between a code check and an insert:
+	// invisible to ShortenedExists, but in the way of BatchInsertURLs.
+	racingURLs map[string]bool
+	// Roles keyed by workspace and user.
+	members map[[2]uuid.UUID]string
+	// Returned as is by GetClickSeries, whatever the link and range.
+	clickSeries []sqlc.GetClickSeriesRow
+}
+
+type fakeUser struct {
+	email         string
+	passwordHash  string
+	createdAt     time.Time
+	apiKeys       int
+	legacyClaimed bool
+}
+
+type fakeSession struct {
+	userID      uuid.UUID
+	refreshHash string
+	revoked     bool
+}
+
+func newFakeDB() *fakeDB {
+	return &fakeDB{
+		users:      make(map[uuid.UUID]*fakeUser),
+		emails:     make(map[string]uuid.UUID),
+		sessions:   make(map[uuid.UUID]*fakeSession),
+		identities: make(map[[2]string]uuid.UUID),
+		urls:       make(map[string]sqlc.Url),
+		racingURLs: make(map[string]bool),
+		members:    make(map[[2]uuid.UUID]string),
+	}
+}
+
+func (db *fakeDB) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	switch name := queryName(sql); name {
+	case "InsertUser":
+		userID := pgUUID(args[0])
+		if _, ok := db.users[userID]; ok {
+			return pgconn.CommandTag{}, uniqueViolation()
+		}
+		db.users[userID] = &fakeUser{createdAt: time.Now()}
+	case "InsertAccount":
+		userID := pgUUID(args[0])
+		if _, ok := db.users[userID]; ok {
+			return pgconn.CommandTag{}, uniqueViolation()
+		}
+		db.users[userID] = &fakeUser{
+			email:        args[1].(pgtype.Text).String,
+			passwordHash: args[2].(string),
+			createdAt:    time.Now(),
+		}
+	case "InsertUserEmail":
+		email := args[0].(string)
+		if _, ok := db.emails[email]; ok {
+			return pgconn.CommandTag{}, uniqueViolation()
+		}
+		db.emails[email] = pgUUID(args[1])
+	case "InsertUserIdentity":
+		identity := [2]string{args[0].(string), args[1].(string)}
+		if _, ok := db.identities[identity]; ok {
+			return pgconn.CommandTag{}, uniqueViolation()
+		}
+		db.identities[identity] = pgUUID(args[2])
+	case "UpdateUserPassword":
+		if user, ok := db.users[pgUUID(args[0])]; ok {
+			user.passwordHash = args[1].(string)
+		}
+	case "BatchInsertURLs":
+		// Like VARCHAR(250), one overlong original fails the whole statement.
+		codes, originals := args[0].([]string), args[1].([]string)
+		if slices.ContainsFunc(originals, func(original string) bool { return len(original) > 250 }) {
+			return pgconn.CommandTag{}, &pgconn.PgError{Code: "22001"}
+		}
+		inserted := 0
+		for i, code := range codes {
+			if _, ok := db.urls[code]; ok || db.racingURLs[code] {
+				continue
+			}
+			inserted++
+			db.urls[code] = sqlc.Url{
+				Shortened:   code,
+				Original:    originals[i],
+				CreatedAt:   args[3].([]pgtype.Timestamptz)[i],
+				ExpiredAt:   args[4].([]pgtype.Timestamptz)[i],
+				UserID:      args[5].([]pgtype.UUID)[i],
+				Title:       args[9].([]string)[i],
+				WorkspaceID: args[10].([]pgtype.UUID)[i],
+			}
+		}
+		return pgconn.NewCommandTag(fmt.Sprintf("INSERT 0 %d", inserted)), nil
+	case "UpdateExpirationDate":
+		if url, ok := db.urls[args[0].(string)]; ok {
+			url.ExpiredAt = args[1].(pgtype.Timestamptz)
+			db.urls[url.Shortened] = url
+		}
+	case "TransferURL":
+		url, ok := db.urls[args[2].(string)]
+		if !ok || url.UserID != args[3].(pgtype.UUID) {
+			return pgconn.NewCommandTag("UPDATE 0"), nil
+		}
+		url.UserID, url.WorkspaceID = args[0].(pgtype.UUID), args[1].(pgtype.UUID)
+		db.urls[url.Shortened] = url
+		return pgconn.NewCommandTag("UPDATE 1"), nil
+	case "UpsertWorkspaceMember":
+		db.members[[2]uuid.UUID{pgUUID(args[0]), pgUUID(args[1])}] = args[2].(string)
+	case "RemoveWorkspaceMember":
+		key := [2]uuid.UUID{pgUUID(args[0]), pgUUID(args[1])}
+		if _, ok := db.members[key]; !ok {
+			return pgconn.NewCommandTag("DELETE 0"), nil
+		}
+		delete(db.members, key)
+		return pgconn.NewCommandTag("DELETE 1"), nil
+	case "RevokeSession":
+		session, ok := db.sessions[pgUUID(args[0])]
+		if !ok || session.revoked || session.userID != pgUUID(args[1]) {
+			return pgconn.NewCommandTag("UPDATE 0"), nil
+		}
+		session.revoked = true
+		return pgconn.NewCommandTag("UPDATE 1"), nil
+	default:
+		return pgconn.CommandTag{}, fmt.Errorf("fakeDB: unsupported exec %s", name)
+	}
+	return pgconn.CommandTag{}, nil
+}
+
+func (db *fakeDB) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	switch name := queryName(sql); name {
+	case "RevokeUserSessions":
+		userID := pgUUID(args[0])
+		var rows [][]any
+		for id, session := range db.sessions {
+			if session.userID == userID && !session.revoked {
+				session.revoked = true
+				rows = append(rows, []any{pgtype.UUID{Bytes: id, Valid: true}})
+			}
+		}
+		return &fakeRows{rows: rows}, nil
+	case "SearchAllURLs":
+		return db.searchURLs(nil, args[0], args[1], args[2], args[3]), nil
+	case "SearchByOriginalURL":
+		userID := pgUUID(args[0])
+		return db.searchURLs(&userID, args[1], args[2], args[3], args[4]), nil
+	case "TransferUserURLs":
+		rows := &fakeRows{}
+		for code, url := range db.urls {
+			if url.UserID == args[2].(pgtype.UUID) && !url.WorkspaceID.Valid {
+				url.UserID, url.WorkspaceID = args[0].(pgtype.UUID), args[1].(pgtype.UUID)
+				db.urls[code] = url
+				rows.rows = append(rows.rows, []any{code})
+			}
+		}
+		return rows, nil
+	case "GetClickSeries":
+		rows := &fakeRows{}
+		for _, row := range db.clickSeries {
+			rows.rows = append(rows.rows, []any{row.BucketStart, row.Clicks, row.BotClicks})
+		}
+		return rows, nil
+	case "GetClickBreakdowns", "ListVisitorSketches":
+		return &fakeRows{}, nil
+	default:
+		return nil, fmt.Errorf("fakeDB: unsupported query %s", name)
+	}
+}
+
+func (db *fakeDB) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	switch name := queryName(sql); name {
+	case "GetUser":
+		user, ok := db.users[pgUUID(args[0])]
+		if !ok {
+			return fakeRow{err: pgx.ErrNoRows}
+		}
+		return fakeRow{values: user.row(pgUUID(args[0]))}
+	case "GetUserByEmail":
+		userID, ok := db.emails[args[0].(string)]
+		if !ok {
+			return fakeRow{err: pgx.ErrNoRows}
+		}
+		return fakeRow{values: db.users[userID].row(userID)}
+	case "GetOriginated":
+		url, ok := db.urls[args[0].(string)]
+		if !ok {
+			return fakeRow{err: pgx.ErrNoRows}
+		}
+		return fakeRow{values: []any{url.Shortened, url.Original, url.Clicks, url.CreatedAt, url.ExpiredAt,
+			url.UserID, url.RedirectStatus, url.MaxClicks, url.PasswordHash, url.Title, url.WorkspaceID}}
+	case "LockWorkspace":
+		// A workspace always keeps an owner, so it exists while it has members.
+		for key := range db.members {
+			if key[0] == pgUUID(args[0]) {
+				return fakeRow{values: []any{args[0]}}
+			}
+		}
+		return fakeRow{err: pgx.ErrNoRows}
+	case "GetWorkspaceRole":
+		role, ok := db.members[[2]uuid.UUID{pgUUID(args[0]), pgUUID(args[1])}]
+		if !ok {
+			return fakeRow{err: pgx.ErrNoRows}
+		}
+		return fakeRow{values: []any{role}}
+	case "CountWorkspaceOwners":
+		var owners int64
+		for key, role := range db.members {
+			if key[0] == pgUUID(args[0]) && role == RoleOwner {
+				owners++
+			}
+		}
+		return fakeRow{values: []any{owners}}
+	case "UserExists":
+		_, ok := db.users[pgUUID(args[0])]
+		return fakeRow{values: []any{ok}}
+	case "ShortenedExists":
+		_, ok := db.urls[args[0].(string)]
+		return fakeRow{values: []any{ok}}
+	case "GetUserIdentity":
+		userID, ok := db.identities[[2]string{args[0].(string), args[1].(string)}]
+		if !ok {
+			return fakeRow{err: pgx.ErrNoRows}
+		}
+		return fakeRow{values: []any{pgtype.UUID{Bytes: userID, Valid: true}}}
+	case "CountSearchAllURLs":
+		return fakeRow{values: []any{int64(len(db.matchURLs(nil, args[0].(string))))}}
+	case "CountSearchByOriginalURL":
+		userID := pgUUID(args[0])
+		return fakeRow{values: []any{int64(len(db.matchURLs(&userID, args[1].(string))))}}
+	case "ClaimLegacyUser":
+		userID := pgUUID(args[0])
+		user, ok := db.users[userID]
+		if !ok || user.legacyClaimed || user.email != "" || user.passwordHash != "" || user.apiKeys > 0 || db.hasLogin(userID) {
+			return fakeRow{err: pgx.ErrNoRows}
+		}
+		user.legacyClaimed = true
+		return fakeRow{values: []any{args[0]}}
+	case "CreateAPIKey":
+		if user, ok := db.users[pgUUID(args[0])]; ok {
+			user.apiKeys++
+		}
+		now := pgtype.Timestamptz{Time: time.Now(), Valid: true}
+		return fakeRow{values: []any{pgtype.UUID{Bytes: uuid.New(), Valid: true}, args[0], args[1], args[2], args[3],
+			now, pgtype.Timestamptz{}, pgtype.Timestamptz{}}}
+	case "CreateSession":
+		id := uuid.New()
+		db.sessions[id] = &fakeSession{userID: pgUUID(args[0]), refreshHash: args[1].(string)}
+		return fakeRow{values: []any{pgtype.UUID{Bytes: id, Valid: true}}}
+	default:
+		return fakeRow{err: fmt.Errorf("fakeDB: unsupported query %s", name)}
+	}
+}
+
+// hasLogin reports whether the user has a session or an identity provider
+// login.
+func (db *fakeDB) hasLogin(userID uuid.UUID) bool {
+	for _, session := range db.sessions {
+		if session.userID == userID {
+			return true
+		}
+	}
+	for _, id := range db.identities {
+		if id == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// matchURLs returns the links a search for pattern finds newest first, all
+// of them for a nil userID and otherwise those the user may read.
+func (db *fakeDB) matchURLs(userID *uuid.UUID, pattern string) []sqlc.Url {
+	text := strings.ToLower(strings.NewReplacer(`\\`, `\`, `\%`, `%`, `\_`, `_`).Replace(pattern))
+	var matches []sqlc.Url
+	for _, url := range db.urls {
+		if userID != nil {
+			personal := !url.WorkspaceID.Valid && uuid.UUID(url.UserID.Bytes) == *userID
+			member := url.WorkspaceID.Valid && db.members[[2]uuid.UUID{url.WorkspaceID.Bytes, *userID}] != ""
+			if !personal && !member {
+				continue
+			}
+		}
+		if strings.Contains(strings.ToLower(url.Original), text) || strings.Contains(strings.ToLower(url.Shortened), text) ||
+			strings.Contains(strings.ToLower(url.Title), text) {
+			matches = append(matches, url)
+		}
+	}
+	slices.SortFunc(matches, func(a, b sqlc.Url) int {
+		if c := b.CreatedAt.Time.Compare(a.CreatedAt.Time); c != 0 {
+			return c
+		}
+		return strings.Compare(b.Shortened, a.Shortened)
+	})
+	return matches
+}
+
+func (db *fakeDB) searchURLs(userID *uuid.UUID, pattern, cursorCode, cursorCreatedAt, pageSize any) pgx.Rows {
+	code := cursorCode.(pgtype.Text)
+	createdAt := cursorCreatedAt.(pgtype.Timestamptz).Time
+	rows := &fakeRows{}
+	for _, url := range db.matchURLs(userID, pattern.(string)) {
+		if code.Valid && !(url.CreatedAt.Time.Before(createdAt) || url.CreatedAt.Time.Equal(createdAt) && url.Shortened < code.String) {
+			continue
+		}
+		if len(rows.rows) == int(pageSize.(int32)) {
+			break
+		}
+		rows.rows = append(rows.rows, []any{url.Shortened, url.Original, url.Clicks, url.CreatedAt, url.ExpiredAt,
+			url.UserID, url.RedirectStatus, url.MaxClicks, url.PasswordHash, url.Title, url.WorkspaceID})
+	}
+	return rows
+}
+
+func (db *fakeDB) Begin(ctx context.Context) (pgx.Tx, error) {
+	return &fakeTx{db: db}, nil
+}
+
+func (db *fakeDB) Ping(ctx context.Context) error { return nil }
+
+func (db *fakeDB) Close() {}
+
+func (u *fakeUser) row(userID uuid.UUID) []any {
+	return []any{
+		pgtype.UUID{Bytes: userID, Valid: true},
+		pgtype.Text{String: u.email, Valid: u.email != ""},
+		u.passwordHash,
+		pgtype.Timestamptz{Time: u.createdAt, Valid: true},
+	}
+}
+
+// fakeTx runs statements straight against its fakeDB. The embedded pgx.Tx
+// is nil; calling anything not overridden here panics.
+type fakeTx struct {
+	pgx.Tx
+	db *fakeDB
+}
+
+func (tx *fakeTx) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	return tx.db.Exec(ctx, sql, args...)
+}
+
+func (tx *fakeTx) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	return tx.db.Query(ctx, sql, args...)
+}
+
+func (tx *fakeTx) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	return tx.db.QueryRow(ctx, sql, args...)
+}
+
+func (tx *fakeTx) Commit(ctx context.Context) error { return nil }
+
+func (tx *fakeTx) Rollback(ctx context.Context) error { return nil }
+
+type fakeRow struct {
+	values []any
+	err    error
+}
+
+func (r fakeRow) Scan(dest ...any) error {
+	if r.err != nil {
+		return r.err
+	}
+	return scanValues(r.values, dest)
+}
+
+type fakeRows struct {
+	pgx.Rows
+	rows [][]any
+	next int
+}
+
+func (r *fakeRows) Next() bool {
+	r.next++
+	return r.next <= len(r.rows)
+}
+
+func (r *fakeRows) Scan(dest ...any) error { return scanValues(r.rows[r.next-1], dest) }
+
+func (r *fakeRows) Err() error { return nil }
+
+func (r *fakeRows) Close() {}
+
+func scanValues(values []any, dest []any) error {
+	if len(values) != len(dest) {
+		return fmt.Errorf("fakeDB: scanning %d values into %d destinations", len(values), len(dest))
+	}
+	for i, value := range values {
+		reflect.ValueOf(dest[i]).Elem().Set(reflect.ValueOf(value))
+	}
+	return nil
+}
+
+// queryName returns the sqlc name of a query, "GetUser" for
+// "-- name: GetUser :one".
+func queryName(sql string) string {
+	fields := strings.Fields(sql)
+	if len(fields) < 3 {
+		return ""
+	}
+	return fields[2]
+}
+
+func pgUUID(arg any) uuid.UUID {
+	return arg.(pgtype.UUID).Bytes
+}
+
+func uniqueViolation() error {
+	return &pgconn.PgError{Code: "23505"}
+}
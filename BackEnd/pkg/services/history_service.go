@@ -0,0 +1,391 @@
+package services
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"shorten-url/backend/pkg/db/sqlc"
+	"shorten-url/backend/pkg/utils"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	defaultHistoryLimit = 50
+	maxHistoryLimit     = 500
+	minSearchLength     = 3
+)
+
+var (
+	ErrInvalidCursor       = errors.New("invalid cursor")
+	ErrInvalidHistoryQuery = errors.New("invalid history query")
+	ErrSearchTooShort      = errors.New("search query must be at least 3 characters")
+)
+
+// URLInfo is the public view of a link. Unlike CachedURL it carries the
+// code and never the password hash.
+type URLInfo struct {
+	Shortened      string     `json:"shortened"`
+	Original       string     `json:"original"`
+	Title          string     `json:"title,omitempty"`
+	Clicks         int        `json:"clicks"`
+	CreatedAt      time.Time  `json:"created_at"`
+	ExpiredAt      *time.Time `json:"expired_at"`
+	Expired        bool       `json:"expired"`
+	RedirectStatus int        `json:"redirect_status,omitempty"`
+	MaxClicks      int64      `json:"max_clicks,omitempty"`
+	Protected      bool       `json:"protected"`
+	WorkspaceID    string     `json:"workspace_id,omitempty"`
+	UniqueVisitors int64      `json:"unique_visitors"`
+}
+
+type URLPage struct {
+	Items      []URLInfo `json:"items"`
+	Total      int64     `json:"total"`
+	NextCursor string    `json:"next_cursor,omitempty"`
+}
+
+// HistoryQuery selects one page of a user's links. Sort is "created"
+// (newest first, default), "clicks" (most clicked first) or "expiry"
+// (soonest first, permanent links last). Status is "all" (default), "active"
+// or "expired". CreatedFrom/CreatedTo bound created_at as [from, to).
+// WorkspaceID lists a workspace's links instead of the user's personal ones.
+type HistoryQuery struct {
+	WorkspaceID string
+	Sort        string
+	Status      string
+	CreatedFrom time.Time
+	CreatedTo   time.Time
+	Search      string
+	Cursor      string
+	Limit       int
+}
+
+// SearchQuery looks for links whose destination, code or title contains
+// Text. An empty UserID searches every user and is reserved for admins.
+type SearchQuery struct {
+	UserID string
+	Text   string
+	Cursor string
+	Limit  int
+}
+
+// historyCursor is the last row of a page, serialized opaquely to clients.
+type historyCursor struct {
+	Sort      string    `json:"s"`
+	Code      string    `json:"c"`
+	CreatedAt time.Time `json:"t,omitempty"`
+	Clicks    int64     `json:"n,omitempty"`
+	ExpiredAt time.Time `json:"e,omitempty"`
+	Never     bool      `json:"i,omitempty"`
+}
+
+func (s *UrlService) GetURLs(userIDStr string, query HistoryQuery) (*URLPage, error) {
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return nil, ErrInvalidUserID
+	}
+
+	if query.Sort == "" {
+		query.Sort = "created"
+	}
+	if query.Limit <= 0 {
+		query.Limit = defaultHistoryLimit
+	}
+	if query.Limit > maxHistoryLimit {
+		query.Limit = maxHistoryLimit
+	}
+
+	filters := sqlc.CountUserURLsParams{
+		CreatedFrom: pgtype.Timestamptz{Time: query.CreatedFrom, Valid: !query.CreatedFrom.IsZero()},
+		CreatedTo:   pgtype.Timestamptz{Time: query.CreatedTo, Valid: !query.CreatedTo.IsZero()},
+		Search:      pgtype.Text{String: escapeLike(query.Search), Valid: query.Search != ""},
+	}
+	if query.WorkspaceID != "" {
+		workspaceID, err := s.requireWorkspaceRole(query.WorkspaceID, userID, RoleViewer)
+		if err != nil {
+			return nil, err
+		}
+		filters.WorkspaceID = utils.ConvertFromUuidPg(workspaceID)
+	} else {
+		filters.UserID = utils.ConvertFromUuidPg(userID)
+	}
+	switch query.Status {
+	case "", "all":
+	case "active":
+		filters.Active = pgtype.Bool{Bool: true, Valid: true}
+	case "expired":
+		filters.Active = pgtype.Bool{Bool: false, Valid: true}
+	default:
+		return nil, fmt.Errorf("%w: status must be all, active or expired", ErrInvalidHistoryQuery)
+	}
+
+	var cursor *historyCursor
+	if query.Cursor != "" {
+		cursor, err = decodeHistoryCursor(query.Cursor)
+		if err != nil || cursor.Sort != query.Sort {
+			return nil, ErrInvalidCursor
+		}
+	}
+
+	// Fetch one extra row to learn whether another page follows.
+	rows, err := s.listUserURLs(query.Sort, filters, cursor, int32(query.Limit+1))
+	if err != nil {
+		return nil, err
+	}
+
+	total, err := s.postgresClient.Queries.CountUserURLs(s.ctx, filters)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count URLs: %v", err)
+	}
+
+	page := &URLPage{Items: make([]URLInfo, 0, len(rows)), Total: total}
+	if len(rows) > query.Limit {
+		rows = rows[:query.Limit]
+		page.NextCursor = encodeHistoryCursor(query.Sort, rows[len(rows)-1])
+	}
+	now := time.Now()
+	for _, row := range rows {
+		page.Items = append(page.Items, toURLInfo(row, now))
+	}
+	if err := s.fillUniqueVisitors(page.Items); err != nil {
+		return nil, err
+	}
+
+	return page, nil
+}
+
+func (s *UrlService) listUserURLs(sort string, filters sqlc.CountUserURLsParams, cursor *historyCursor, limit int32) ([]sqlc.Url, error) {
+	var (
+		rows []sqlc.Url
+		err  error
+	)
+	cursorCode := pgtype.Text{}
+	if cursor != nil {
+		cursorCode = pgtype.Text{String: cursor.Code, Valid: true}
+	}
+
+	switch sort {
+	case "created":
+		params := sqlc.ListUserURLsByCreatedParams{
+			UserID:      filters.UserID,
+			WorkspaceID: filters.WorkspaceID,
+			Active:      filters.Active,
+			CreatedFrom: filters.CreatedFrom,
+			CreatedTo:   filters.CreatedTo,
+			Search:      filters.Search,
+			CursorCode:  cursorCode,
+			PageSize:    limit,
+		}
+		if cursor != nil {
+			params.CursorCreatedAt = pgtype.Timestamptz{Time: cursor.CreatedAt, Valid: true}
+		}
+		rows, err = s.postgresClient.Queries.ListUserURLsByCreated(s.ctx, params)
+	case "clicks":
+		params := sqlc.ListUserURLsByClicksParams{
+			UserID:      filters.UserID,
+			WorkspaceID: filters.WorkspaceID,
+			Active:      filters.Active,
+			CreatedFrom: filters.CreatedFrom,
+			CreatedTo:   filters.CreatedTo,
+			Search:      filters.Search,
+			CursorCode:  cursorCode,
+			PageSize:    limit,
+		}
+		if cursor != nil {
+			params.CursorClicks = pgtype.Int8{Int64: cursor.Clicks, Valid: true}
+		}
+		rows, err = s.postgresClient.Queries.ListUserURLsByClicks(s.ctx, params)
+	case "expiry":
+		params := sqlc.ListUserURLsByExpiryParams{
+			UserID:      filters.UserID,
+			WorkspaceID: filters.WorkspaceID,
+			Active:      filters.Active,
+			CreatedFrom: filters.CreatedFrom,
+			CreatedTo:   filters.CreatedTo,
+			Search:      filters.Search,
+			CursorCode:  cursorCode,
+			PageSize:    limit,
+		}
+		if cursor != nil {
+			params.CursorExpiredAt = pgtype.Timestamptz{Time: cursor.ExpiredAt, Valid: true}
+			if cursor.Never {
+				params.CursorExpiredAt = pgtype.Timestamptz{InfinityModifier: pgtype.Infinity, Valid: true}
+			}
+		}
+		rows, err = s.postgresClient.Queries.ListUserURLsByExpiry(s.ctx, params)
+	default:
+		return nil, fmt.Errorf("%w: sort must be created, clicks or expiry", ErrInvalidHistoryQuery)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list URLs: %v", err)
+	}
+
+	return rows, nil
+}
+
+// SearchURLs pages through matching links newest first. Shorter queries are
+// rejected because trigram indexes cannot serve them.
+func (s *UrlService) SearchURLs(query SearchQuery) (*URLPage, error) {
+	if len([]rune(query.Text)) < minSearchLength {
+		return nil, ErrSearchTooShort
+	}
+
+	pattern := escapeLike(query.Text)
+	if query.Limit <= 0 {
+		query.Limit = defaultHistoryLimit
+	}
+	if query.Limit > maxHistoryLimit {
+		query.Limit = maxHistoryLimit
+	}
+
+	var cursorCode pgtype.Text
+	var cursorCreatedAt pgtype.Timestamptz
+	if query.Cursor != "" {
+		cursor, err := decodeHistoryCursor(query.Cursor)
+		if err != nil || cursor.Sort != "created" {
+			return nil, ErrInvalidCursor
+		}
+		cursorCode = pgtype.Text{String: cursor.Code, Valid: true}
+		cursorCreatedAt = pgtype.Timestamptz{Time: cursor.CreatedAt, Valid: true}
+	}
+
+	rows, total, err := s.searchURLs(query.UserID, pattern, cursorCode, cursorCreatedAt, int32(query.Limit+1))
+	if err != nil {
+		return nil, err
+	}
+
+	page := &URLPage{Items: make([]URLInfo, 0, len(rows)), Total: total}
+	if len(rows) > query.Limit {
+		rows = rows[:query.Limit]
+		page.NextCursor = encodeHistoryCursor("created", rows[len(rows)-1])
+	}
+	now := time.Now()
+	for _, row := range rows {
+		page.Items = append(page.Items, toURLInfo(row, now))
+	}
+	if err := s.fillUniqueVisitors(page.Items); err != nil {
+		return nil, err
+	}
+
+	return page, nil
+}
+
+// searchURLs runs the search across every user for an empty userIDStr, and
+// otherwise over the links the user may read: their personal ones and those
+// of every workspace they belong to.
+func (s *UrlService) searchURLs(userIDStr string, pattern string, cursorCode pgtype.Text, cursorCreatedAt pgtype.Timestamptz, pageSize int32) ([]sqlc.Url, int64, error) {
+	if userIDStr == "" {
+		rows, err := s.postgresClient.Queries.SearchAllURLs(s.ctx, sqlc.SearchAllURLsParams{
+			Pattern:         pattern,
+			CursorCode:      cursorCode,
+			CursorCreatedAt: cursorCreatedAt,
+			PageSize:        pageSize,
+		})
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to search URLs: %v", err)
+		}
+		total, err := s.postgresClient.Queries.CountSearchAllURLs(s.ctx, pattern)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to count URLs: %v", err)
+		}
+		return rows, total, nil
+	}
+
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return nil, 0, ErrInvalidUserID
+	}
+	rows, err := s.postgresClient.Queries.SearchByOriginalURL(s.ctx, sqlc.SearchByOriginalURLParams{
+		UserID:          utils.ConvertFromUuidPg(userID),
+		Pattern:         pattern,
+		CursorCode:      cursorCode,
+		CursorCreatedAt: cursorCreatedAt,
+		PageSize:        pageSize,
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to search URLs: %v", err)
+	}
+	total, err := s.postgresClient.Queries.CountSearchByOriginalURL(s.ctx, sqlc.CountSearchByOriginalURLParams{
+		UserID:  utils.ConvertFromUuidPg(userID),
+		Pattern: pattern,
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count URLs: %v", err)
+	}
+	return rows, total, nil
+}
+
+// fillUniqueVisitors sets the lifetime unique visitors of each link.
+func (s *UrlService) fillUniqueVisitors(items []URLInfo) error {
+	codes := make([]string, len(items))
+	for i, item := range items {
+		codes[i] = item.Shortened
+	}
+	totals, err := s.uniqueVisitorTotals(codes)
+	if err != nil {
+		return err
+	}
+	for i := range items {
+		items[i].UniqueVisitors = totals[items[i].Shortened]
+	}
+	return nil
+}
+
+func toURLInfo(url sqlc.Url, now time.Time) URLInfo {
+	info := URLInfo{
+		Shortened:      url.Shortened,
+		Original:       url.Original,
+		Title:          url.Title,
+		Clicks:         int(url.Clicks.Int64),
+		CreatedAt:      url.CreatedAt.Time,
+		RedirectStatus: int(url.RedirectStatus),
+		MaxClicks:      url.MaxClicks,
+		Protected:      url.PasswordHash != "",
+	}
+	if url.WorkspaceID.Valid {
+		info.WorkspaceID = utils.ConvertFromPgUuid(url.WorkspaceID).String()
+	}
+	if url.ExpiredAt.Valid {
+		info.ExpiredAt = &url.ExpiredAt.Time
+		info.Expired = !url.ExpiredAt.Time.After(now)
+	}
+	return info
+}
+
+func encodeHistoryCursor(sort string, last sqlc.Url) string {
+	cursor := historyCursor{
+		Sort:      sort,
+		Code:      last.Shortened,
+		CreatedAt: last.CreatedAt.Time,
+		Clicks:    last.Clicks.Int64,
+		ExpiredAt: last.ExpiredAt.Time,
+		Never:     !last.ExpiredAt.Valid,
+	}
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeHistoryCursor(encoded string) (*historyCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	var cursor historyCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, err
+	}
+	if cursor.Code == "" {
+		return nil, ErrInvalidCursor
+	}
+	return &cursor, nil
+}
+
+// escapeLike makes user input match literally inside a LIKE pattern.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
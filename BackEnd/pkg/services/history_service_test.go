@@ -0,0 +1,260 @@
+package services
+
+import (
+	"encoding/base64"
+	"errors"
+	"shorten-url/backend/pkg/db/sqlc"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func TestSearchURLsScopes(t *testing.T) {
+	service, _, _ := newTestService(t)
+	db := service.postgresClient.DB.(*fakeDB)
+
+	alice, bob, workspace := uuid.New(), uuid.New(), uuid.New()
+	db.members[[2]uuid.UUID{workspace, alice}] = RoleViewer
+	now := time.Now()
+	for i, link := range []struct {
+		code      string
+		userID    uuid.UUID
+		workspace bool
+	}{
+		{"alice1", alice, false},
+		{"bob1", bob, false},
+		{"team1", bob, true},
+		{"alice2", alice, false},
+	} {
+		url := sqlc.Url{
+			Shortened: link.code,
+			Original:  "https://docs.example.com/" + link.code,
+			CreatedAt: pgtype.Timestamptz{Time: now.Add(time.Duration(i) * time.Minute), Valid: true},
+			UserID:    pgtype.UUID{Bytes: link.userID, Valid: true},
+		}
+		if link.workspace {
+			url.WorkspaceID = pgtype.UUID{Bytes: workspace, Valid: true}
+		}
+		db.urls[link.code] = url
+	}
+
+	tests := []struct {
+		name      string
+		userID    string
+		wantCodes []string
+	}{
+		{"personal and workspace links", alice.String(), []string{"alice2", "team1", "alice1"}},
+		// Bob created the workspace link but is not a member any more.
+		{"personal links only", bob.String(), []string{"bob1"}},
+		{"every user for admins", "", []string{"alice2", "team1", "bob1", "alice1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := service.SearchURLs(SearchQuery{UserID: tt.userID, Text: "docs.example"})
+			if err != nil {
+				t.Fatalf("SearchURLs: %v", err)
+			}
+			if codes := pageCodes(page); !slices.Equal(codes, tt.wantCodes) || page.Total != int64(len(tt.wantCodes)) {
+				t.Errorf("SearchURLs = %v (total %d), want %v", codes, page.Total, tt.wantCodes)
+			}
+		})
+	}
+
+	if _, err := service.SearchURLs(SearchQuery{UserID: "not-a-uuid", Text: "docs.example"}); !errors.Is(err, ErrInvalidUserID) {
+		t.Errorf("SearchURLs with a bad user error = %v, want ErrInvalidUserID", err)
+	}
+}
+
+func TestSearchAllURLsPages(t *testing.T) {
+	service, _, _ := newTestService(t)
+	db := service.postgresClient.DB.(*fakeDB)
+
+	now := time.Now()
+	var want []string
+	for i := 0; i < 5; i++ {
+		code := string(rune('a' + i))
+		db.urls[code] = sqlc.Url{
+			Shortened: code,
+			Original:  "https://shop.example.com/" + code,
+			CreatedAt: pgtype.Timestamptz{Time: now.Add(-time.Duration(i) * time.Minute), Valid: true},
+			UserID:    pgtype.UUID{Bytes: uuid.New(), Valid: true},
+		}
+		want = append(want, code)
+	}
+
+	var got []string
+	query := SearchQuery{Text: "shop.example", Limit: 2}
+	for {
+		page, err := service.SearchURLs(query)
+		if err != nil {
+			t.Fatalf("SearchURLs: %v", err)
+		}
+		got = append(got, pageCodes(page)...)
+		if page.NextCursor == "" {
+			break
+		}
+		query.Cursor = page.NextCursor
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("paged search = %v, want %v", got, want)
+	}
+}
+
+func pageCodes(page *URLPage) []string {
+	var codes []string
+	for _, item := range page.Items {
+		codes = append(codes, item.Shortened)
+	}
+	return codes
+}
+
+func TestHistoryCursorRoundTrip(t *testing.T) {
+	createdAt := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	expiredAt := createdAt.Add(48 * time.Hour)
+
+	tests := []struct {
+		name string
+		sort string
+		last sqlc.Url
+		want historyCursor
+	}{
+		{
+			"newest first", "created",
+			sqlc.Url{Shortened: "abc", CreatedAt: pgtype.Timestamptz{Time: createdAt, Valid: true}},
+			historyCursor{Sort: "created", Code: "abc", CreatedAt: createdAt, Never: true},
+		},
+		{
+			"most clicked first", "clicks",
+			sqlc.Url{Shortened: "abc", Clicks: pgtype.Int8{Int64: 42, Valid: true}},
+			historyCursor{Sort: "clicks", Code: "abc", Clicks: 42, Never: true},
+		},
+		{
+			"soonest expiry first", "expiry",
+			sqlc.Url{Shortened: "abc", ExpiredAt: pgtype.Timestamptz{Time: expiredAt, Valid: true}},
+			historyCursor{Sort: "expiry", Code: "abc", ExpiredAt: expiredAt},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cursor, err := decodeHistoryCursor(encodeHistoryCursor(tt.sort, tt.last))
+			if err != nil {
+				t.Fatalf("decodeHistoryCursor: %v", err)
+			}
+			if !cursor.CreatedAt.Equal(tt.want.CreatedAt) || !cursor.ExpiredAt.Equal(tt.want.ExpiredAt) {
+				t.Errorf("cursor times = (%v, %v), want (%v, %v)", cursor.CreatedAt, cursor.ExpiredAt, tt.want.CreatedAt, tt.want.ExpiredAt)
+			}
+			cursor.CreatedAt, cursor.ExpiredAt = tt.want.CreatedAt, tt.want.ExpiredAt
+			if *cursor != tt.want {
+				t.Errorf("cursor = %+v, want %+v", *cursor, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeHistoryCursorRejectsGarbage(t *testing.T) {
+	tests := []struct {
+		name    string
+		encoded string
+	}{
+		{"not base64", "not a cursor!"},
+		{"not JSON", base64.RawURLEncoding.EncodeToString([]byte("abc"))},
+		{"no code", base64.RawURLEncoding.EncodeToString([]byte(`{"s":"created"}`))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if cursor, err := decodeHistoryCursor(tt.encoded); err == nil {
+				t.Errorf("decodeHistoryCursor(%q) = %+v, want an error", tt.encoded, cursor)
+			}
+		})
+	}
+}
+
+func TestGetURLsRejectsBadQueries(t *testing.T) {
+	service, _, _ := newTestService(t)
+	clicksCursor := encodeHistoryCursor("clicks", sqlc.Url{Shortened: "abc"})
+
+	tests := []struct {
+		name    string
+		query   HistoryQuery
+		wantErr error
+	}{
+		{"cursor of another sort", HistoryQuery{Sort: "created", Cursor: clicksCursor}, ErrInvalidCursor},
+		{"garbage cursor", HistoryQuery{Cursor: "garbage!"}, ErrInvalidCursor},
+		{"unknown status", HistoryQuery{Status: "deleted"}, ErrInvalidHistoryQuery},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := service.GetURLs(uuid.NewString(), tt.query); !errors.Is(err, tt.wantErr) {
+				t.Errorf("GetURLs error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEscapeLike(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"example.com", "example.com"},
+		{"100%", `100\%`},
+		{"my_page", `my\_page`},
+		{`C:\temp`, `C:\\temp`},
+		{`%_\`, `\%\_\\`},
+	}
+
+	for _, tt := range tests {
+		if got := escapeLike(tt.in); got != tt.want {
+			t.Errorf("escapeLike(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSearchURLsMatchesLiterally(t *testing.T) {
+	service, _, _ := newTestService(t)
+	db := service.postgresClient.DB.(*fakeDB)
+	userID := uuid.New()
+	for code, original := range map[string]string{
+		"sale":    "https://shop.example.com/100%-off",
+		"other":   "https://shop.example.com/100-off",
+		"under":   "https://shop.example.com/a_b",
+		"nounder": "https://shop.example.com/axb",
+	} {
+		db.urls[code] = sqlc.Url{
+			Shortened: code,
+			Original:  original,
+			CreatedAt: pgtype.Timestamptz{Time: time.Now(), Valid: true},
+			UserID:    pgtype.UUID{Bytes: userID, Valid: true},
+		}
+	}
+
+	tests := []struct {
+		name      string
+		text      string
+		wantCodes []string
+		wantErr   error
+	}{
+		{"percent sign", "100%", []string{"sale"}, nil},
+		{"underscore", "a_b", []string{"under"}, nil},
+		{"too short", "ab", nil, ErrSearchTooShort},
+		{"too short in runes", "éé", nil, ErrSearchTooShort},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := service.SearchURLs(SearchQuery{UserID: userID.String(), Text: tt.text})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("SearchURLs error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && !slices.Equal(pageCodes(page), tt.wantCodes) {
+				t.Errorf("SearchURLs = %v, want %v", pageCodes(page), tt.wantCodes)
+			}
+		})
+	}
+}
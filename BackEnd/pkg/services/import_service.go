@@ -0,0 +1,255 @@
+package services
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"shorten-url/backend/pkg/utils"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrUserNotFound  = errors.New("user not found")
+	ErrInvalidImport = errors.New("invalid import file")
+)
+
+// Column names used by Bitly and Rebrandly exports, lower-cased. The first
+// present column wins.
+var (
+	importCodeColumns     = []string{"slashtag", "custom back-half", "backhalf", "code", "bitlink", "short link", "shortlink", "short url", "shorturl", "short_url", "link"}
+	importOriginalColumns = []string{"long url", "long_url", "destination", "original", "original url", "url"}
+	importTitleColumns    = []string{"title"}
+	importClicksColumns   = []string{"clicks", "total clicks", "total_clicks", "click count"}
+	importCreatedColumns  = []string{"created", "created_at", "createdat", "date created", "creation date"}
+)
+
+var importTimeLayouts = []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02T15:04:05", "2006-01-02", "1/2/2006 15:04", "1/2/2006"}
+
+// ImportIssue explains why one row of an import was not inserted. Row is
+// the 1-based line of the file the row starts on, counting the header.
+type ImportIssue struct {
+	Row    int    `json:"row"`
+	Code   string `json:"code,omitempty"`
+	Reason string `json:"reason"`
+}
+
+type ImportReport struct {
+	Imported  int           `json:"imported"`
+	Conflicts []ImportIssue `json:"conflicts"`
+	Invalid   []ImportIssue `json:"invalid"`
+}
+
+type importColumns struct {
+	code, original, title, clicks, created int
+}
+
+// ImportURLs reads a Bitly or Rebrandly style CSV export and inserts every
+// row for userIDStr, keeping the original code as the alias and its click
+// count. Imported links never expire, like on the platforms they come from.
+// Codes already taken here, or repeated in the file, are reported as
+// conflicts; rows that cannot be parsed are reported as invalid. Valid rows
+// are written batchSize at a time through BatchInsertURLs.
+func (s *UrlService) ImportURLs(userIDStr string, body io.Reader) (*ImportReport, error) {
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return nil, ErrInvalidUserID
+	}
+	exists, err := s.postgresClient.Queries.UserExists(s.ctx, utils.ConvertFromUuidPg(userID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up user: %v", err)
+	}
+	if !exists {
+		return nil, ErrUserNotFound
+	}
+
+	reader := csv.NewReader(body)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to read CSV header: %v", ErrInvalidImport, err)
+	}
+	columns, err := findImportColumns(header)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ImportReport{Conflicts: []ImportIssue{}, Invalid: []ImportIssue{}}
+	seen := make(map[string]int)
+	batch := make([]URLMessage, 0, batchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		params, err := batchInsertParams(batch)
+		if err != nil {
+			return err
+		}
+		// Rows the conflict clause skipped were not imported.
+		inserted, err := s.postgresClient.Queries.BatchInsertURLs(s.ctx, params)
+		if err != nil {
+			return fmt.Errorf("failed to insert rows: %v", err)
+		}
+		report.Imported += int(inserted)
+		batch = batch[:0]
+		return nil
+	}
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if !errors.As(err, &parseErr) {
+				return report, fmt.Errorf("failed to read CSV: %w", err)
+			}
+			report.Invalid = append(report.Invalid, ImportIssue{Row: parseErr.StartLine, Reason: err.Error()})
+			continue
+		}
+		// Quoted fields may span lines, so rows are numbered by the line
+		// they start on.
+		row, _ := reader.FieldPos(0)
+
+		message, err := importMessage(columns, record, userID.String())
+		if err != nil {
+			report.Invalid = append(report.Invalid, ImportIssue{Row: row, Code: message.Shortened, Reason: err.Error()})
+			continue
+		}
+		if first, ok := seen[message.Shortened]; ok {
+			report.Conflicts = append(report.Conflicts, ImportIssue{
+				Row:    row,
+				Code:   message.Shortened,
+				Reason: fmt.Sprintf("duplicate of line %d", first),
+			})
+			continue
+		}
+		seen[message.Shortened] = row
+
+		reserved, err := s.reserveCode(message.Shortened, message.UserID)
+		if err != nil {
+			return report, err
+		}
+		if !reserved {
+			report.Conflicts = append(report.Conflicts, ImportIssue{Row: row, Code: message.Shortened, Reason: ErrAliasTaken.Error()})
+			continue
+		}
+
+		batch = append(batch, message)
+		if len(batch) == batchSize {
+			if err := flush(); err != nil {
+				return report, err
+			}
+		}
+	}
+
+	if err := flush(); err != nil {
+		return report, err
+	}
+	return report, nil
+}
+
+func findImportColumns(header []string) (importColumns, error) {
+	index := make(map[string]int, len(header))
+	for i, name := range header {
+		// Excel likes to prefix the first column with a byte order mark.
+		name = strings.TrimPrefix(name, "\ufeff")
+		index[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	find := func(names []string) int {
+		for _, name := range names {
+			if i, ok := index[name]; ok {
+				return i
+			}
+		}
+		return -1
+	}
+
+	columns := importColumns{
+		code:     find(importCodeColumns),
+		original: find(importOriginalColumns),
+		title:    find(importTitleColumns),
+		clicks:   find(importClicksColumns),
+		created:  find(importCreatedColumns),
+	}
+	if columns.code < 0 || columns.original < 0 {
+		return columns, fmt.Errorf("%w: CSV header must name a short link and a destination column", ErrInvalidImport)
+	}
+	return columns, nil
+}
+
+func importMessage(columns importColumns, record []string, userID string) (URLMessage, error) {
+	field := func(i int) string {
+		if i < 0 || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	message := URLMessage{
+		Shortened:    importCode(field(columns.code)),
+		OriginalURL:  field(columns.original),
+		Title:        field(columns.title),
+		UserID:       userID,
+		CreatedAt:    time.Now(),
+		NeverExpires: true,
+	}
+
+	if err := utils.ValidateAlias(message.Shortened); err != nil {
+		return message, err
+	}
+	if message.OriginalURL == "" || len(message.OriginalURL) > maxOriginalLength {
+		return message, ErrInvalidURL
+	}
+	if len(message.Title) > maxTitleLength {
+		return message, ErrInvalidTitle
+	}
+	if value := field(columns.clicks); value != "" {
+		clicks, err := strconv.Atoi(strings.ReplaceAll(value, ",", ""))
+		if err != nil || clicks < 0 {
+			return message, fmt.Errorf("invalid click count %q", value)
+		}
+		message.Counter = clicks
+	}
+	if value := field(columns.created); value != "" {
+		createdAt, err := parseImportTime(value)
+		if err != nil {
+			return message, err
+		}
+		message.CreatedAt = createdAt
+	}
+	return message, nil
+}
+
+// importCode takes the back-half out of a value that may be a bare code or a
+// full short link such as "bit.ly/3xYzAb" or "https://rebrand.ly/promo".
+func importCode(value string) string {
+	if !strings.Contains(value, "/") {
+		return value
+	}
+	if !strings.Contains(value, "://") {
+		value = "https://" + value
+	}
+	parsed, err := url.Parse(value)
+	if err != nil {
+		return value
+	}
+	return strings.Trim(parsed.Path, "/")
+}
+
+func parseImportTime(value string) (time.Time, error) {
+	for _, layout := range importTimeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid created date %q", value)
+}
@@ -0,0 +1,130 @@
+package services
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestImportURLsReportsFileLines(t *testing.T) {
+	service, _, _ := newTestService(t)
+	db := service.postgresClient.DB.(*fakeDB)
+	userID := uuid.NewString()
+	if err := service.CreateUser(userID); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	db.racingURLs["late01"] = true
+
+	file := strings.Join([]string{
+		"Short link,Long URL,Title,Clicks",
+		"bit.ly/aaa111,https://a.example,A,3",
+		`bit.ly/bbb222,https://b.example,"Two`,
+		`lines",1`,
+		"bit.ly/ccc333,https://c.example,C,lots",
+		"bit.ly/aaa111,https://a2.example,A2,0",
+		"bit.ly/late01,https://late.example,L,0",
+		`bit.ly/ddd"444,https://d.example,D,0`,
+		"bit.ly/eee555,https://e.example,E,0",
+	}, "\n")
+
+	report, err := service.ImportURLs(userID, strings.NewReader(file))
+	if err != nil {
+		t.Fatalf("ImportURLs: %v", err)
+	}
+
+	// late01 was taken by another instance after its code was checked.
+	if report.Imported != 3 {
+		t.Errorf("imported = %d, want 3", report.Imported)
+	}
+	if got := issueLines(report.Invalid); !slices.Equal(got, []int{5, 8}) {
+		t.Errorf("invalid lines = %v, want [5 8]", got)
+	}
+	if got := issueLines(report.Conflicts); !slices.Equal(got, []int{6}) {
+		t.Errorf("conflict lines = %v, want [6]", got)
+	}
+	if title := db.urls["bbb222"].Title; title != "Two\nlines" {
+		t.Errorf("multi-line title = %q", title)
+	}
+}
+
+func TestImportCode(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"3xYzAb", "3xYzAb"},
+		{"bit.ly/3xYzAb", "3xYzAb"},
+		{"https://rebrand.ly/promo", "promo"},
+		{"http://bit.ly/3xYzAb/", "3xYzAb"},
+		{"https://rebrand.ly/promo?utm=x", "promo"},
+	}
+
+	for _, tt := range tests {
+		if got := importCode(tt.in); got != tt.want {
+			t.Errorf("importCode(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestFindImportColumns(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  []string
+		want    importColumns
+		wantErr bool
+	}{
+		{
+			"bitly",
+			[]string{"\ufeffTitle", "Bitlink", "Long URL", "Created", "Total Clicks"},
+			importColumns{code: 1, original: 2, title: 0, clicks: 4, created: 3},
+			false,
+		},
+		{
+			"rebrandly",
+			[]string{"slashtag", "destination", "clicks"},
+			importColumns{code: 0, original: 1, title: -1, clicks: 2, created: -1},
+			false,
+		},
+		{
+			"first alias wins",
+			[]string{"link", "slashtag", "url"},
+			importColumns{code: 1, original: 2, title: -1, clicks: -1, created: -1},
+			false,
+		},
+		{"no destination", []string{"bitlink", "title"}, importColumns{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			columns, err := findImportColumns(tt.header)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("findImportColumns error = %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && columns != tt.want {
+				t.Errorf("findImportColumns = %+v, want %+v", columns, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseImportTime(t *testing.T) {
+	want := time.Date(2024, 5, 7, 0, 0, 0, 0, time.UTC)
+	for _, value := range []string{"2024-05-07T00:00:00Z", "2024-05-07 00:00:00", "2024-05-07", "5/7/2024", "5/7/2024 00:00"} {
+		if got, err := parseImportTime(value); err != nil || !got.Equal(want) {
+			t.Errorf("parseImportTime(%q) = (%v, %v), want %v", value, got, err, want)
+		}
+	}
+	if _, err := parseImportTime("last Tuesday"); err == nil {
+		t.Error("parseImportTime accepted a date it cannot read")
+	}
+}
+
+func issueLines(issues []ImportIssue) []int {
+	var lines []int
+	for _, issue := range issues {
+		lines = append(lines, issue.Row)
+	}
+	return lines
+}
@@ -0,0 +1,187 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"shorten-url/backend/pkg/db/sqlc"
+	"shorten-url/backend/pkg/oidc"
+	"shorten-url/backend/pkg/utils"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/redis/go-redis/v9"
+)
+
+// How long a user has to finish logging in at the provider.
+const oidcStateTTL = 10 * time.Minute
+
+var (
+	ErrOIDCDisabled     = errors.New("single sign-on is not configured")
+	ErrInvalidOIDCState = errors.New("invalid or expired login state")
+)
+
+// oidcLoginState is kept in Redis between BeginOIDCLogin and the callback,
+// keyed by the state parameter.
+type oidcLoginState struct {
+	CodeVerifier string `json:"codeVerifier"`
+	Nonce        string `json:"nonce"`
+}
+
+func (s *UrlService) SetOIDCProvider(provider *oidc.Provider) {
+	s.oidcProvider = provider
+}
+
+// BeginOIDCLogin starts an authorization-code flow and returns the provider
+// URL to send the browser to.
+func (s *UrlService) BeginOIDCLogin() (string, error) {
+	if s.oidcProvider == nil {
+		return "", ErrOIDCDisabled
+	}
+
+	state, err := randomToken("")
+	if err != nil {
+		return "", err
+	}
+	nonce, err := randomToken("")
+	if err != nil {
+		return "", err
+	}
+	verifier, challenge, err := oidc.NewPKCE()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate PKCE verifier: %v", err)
+	}
+
+	loginState, err := json.Marshal(oidcLoginState{CodeVerifier: verifier, Nonce: nonce})
+	if err != nil {
+		return "", err
+	}
+	if err := s.redisClient.Set(s.ctx, oidcStateKey(state), loginState, oidcStateTTL).Err(); err != nil {
+		return "", fmt.Errorf("failed to store login state: %v", err)
+	}
+
+	return s.oidcProvider.AuthCodeURL(state, nonce, challenge), nil
+}
+
+// CompleteOIDCLogin handles the provider's callback: it redeems the code,
+// validates the ID token, provisions the user on first login and starts a
+// session.
+func (s *UrlService) CompleteOIDCLogin(code string, state string) (*User, *SessionTokens, error) {
+	if s.oidcProvider == nil {
+		return nil, nil, ErrOIDCDisabled
+	}
+
+	// GetDel makes every state single-use, so a replayed callback fails.
+	raw, err := s.redisClient.GetDel(s.ctx, oidcStateKey(state)).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil, ErrInvalidOIDCState
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read login state: %v", err)
+	}
+	var loginState oidcLoginState
+	if err := json.Unmarshal([]byte(raw), &loginState); err != nil {
+		return nil, nil, ErrInvalidOIDCState
+	}
+
+	rawIDToken, err := s.oidcProvider.Exchange(s.ctx, code, loginState.CodeVerifier)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to redeem authorization code: %v", err)
+	}
+	claims, err := s.oidcProvider.Verify(s.ctx, rawIDToken, loginState.Nonce)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	userID, err := s.provisionOIDCUser(claims)
+	if err != nil {
+		return nil, nil, err
+	}
+	tokens, err := s.startSession(userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	user, err := s.GetUser(userID.String())
+	if err != nil {
+		return nil, nil, err
+	}
+	return user, tokens, nil
+}
+
+// provisionOIDCUser maps an identity to its user. On first login a verified
+// email that already has an account is linked to it; otherwise a new
+// account without a password is created.
+func (s *UrlService) provisionOIDCUser(claims *oidc.Claims) (uuid.UUID, error) {
+	identity := sqlc.GetUserIdentityParams{Issuer: claims.Issuer, Subject: claims.Subject}
+	existing, err := s.postgresClient.Queries.GetUserIdentity(s.ctx, identity)
+	if err == nil {
+		return utils.ConvertFromPgUuid(existing), nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return uuid.Nil, fmt.Errorf("failed to look up identity: %v", err)
+	}
+
+	// An unverified email proves nothing about who owns it, so it is
+	// neither linked nor stored.
+	email := ""
+	if claims.EmailVerified {
+		email, _ = normalizeEmail(claims.Email)
+	}
+
+	tx, err := s.postgresClient.DB.Begin(s.ctx)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback(s.ctx)
+	queries := s.postgresClient.Queries.WithTx(tx)
+
+	var userID uuid.UUID
+	if email != "" {
+		account, err := queries.GetUserByEmail(s.ctx, email)
+		if err == nil {
+			userID = utils.ConvertFromPgUuid(account.UserID)
+		} else if !errors.Is(err, pgx.ErrNoRows) {
+			return uuid.Nil, fmt.Errorf("failed to look up account: %v", err)
+		}
+	}
+
+	if userID == uuid.Nil {
+		userID = uuid.New()
+		err = queries.InsertAccount(s.ctx, sqlc.InsertAccountParams{
+			UserID: utils.ConvertFromUuidPg(userID),
+			Email:  pgtype.Text{String: email, Valid: email != ""},
+		})
+		if err != nil {
+			return uuid.Nil, fmt.Errorf("failed to create account: %v", err)
+		}
+		if email != "" {
+			err = queries.InsertUserEmail(s.ctx, sqlc.InsertUserEmailParams{
+				Email:  email,
+				UserID: utils.ConvertFromUuidPg(userID),
+			})
+			if err != nil {
+				return uuid.Nil, fmt.Errorf("failed to register email: %v", err)
+			}
+		}
+	}
+
+	err = queries.InsertUserIdentity(s.ctx, sqlc.InsertUserIdentityParams{
+		Issuer:  claims.Issuer,
+		Subject: claims.Subject,
+		UserID:  utils.ConvertFromUuidPg(userID),
+	})
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to link identity: %v", err)
+	}
+
+	if err := tx.Commit(s.ctx); err != nil {
+		return uuid.Nil, fmt.Errorf("failed to commit account: %v", err)
+	}
+	return userID, nil
+}
+
+func oidcStateKey(state string) string {
+	return "oidc_state:" + state
+}
@@ -0,0 +1,241 @@
+package services
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"shorten-url/backend/pkg/oidc"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testOIDCClientID = "shorten-url"
+
+// testIdP approves every authorization request at once as one user, like
+// cmd/mockidp, and refuses to redeem a code unless the PKCE verifier matches
+// the challenge it was issued for.
+type testIdP struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]testAuthorization
+}
+
+type testAuthorization struct {
+	redirectURI   string
+	codeChallenge string
+	nonce         string
+}
+
+func newTestIdP(t *testing.T) *testIdP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &testIdP{key: key, codes: make(map[string]testAuthorization)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.server.URL,
+			"authorization_endpoint": idp.server.URL + "/authorize",
+			"token_endpoint":         idp.server.URL + "/token",
+			"jwks_uri":               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "test-1",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("GET /authorize", idp.authorize)
+	mux.HandleFunc("POST /token", idp.token)
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+func (idp *testIdP) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		http.Error(w, "PKCE with S256 is required", http.StatusBadRequest)
+		return
+	}
+	code, _ := randomToken("")
+	idp.mu.Lock()
+	idp.codes[code] = testAuthorization{
+		redirectURI:   query.Get("redirect_uri"),
+		codeChallenge: query.Get("code_challenge"),
+		nonce:         query.Get("nonce"),
+	}
+	idp.mu.Unlock()
+
+	callback, _ := url.Parse(query.Get("redirect_uri"))
+	callback.RawQuery = url.Values{"code": {code}, "state": {query.Get("state")}}.Encode()
+	http.Redirect(w, r, callback.String(), http.StatusFound)
+}
+
+func (idp *testIdP) token(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	code := r.PostForm.Get("code")
+	idp.mu.Lock()
+	auth, ok := idp.codes[code]
+	delete(idp.codes, code)
+	idp.mu.Unlock()
+
+	switch {
+	case !ok || r.PostForm.Get("redirect_uri") != auth.redirectURI:
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	case oidc.CodeChallenge(r.PostForm.Get("code_verifier")) != auth.codeChallenge:
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant", "error_description": "PKCE verification failed"})
+		return
+	}
+
+	now := time.Now()
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "test-1"})
+	claims, _ := json.Marshal(map[string]any{
+		"iss":            idp.server.URL,
+		"sub":            "idp-user-1",
+		"aud":            testOIDCClientID,
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+		"nonce":          auth.nonce,
+		"email":          "sso.user@example.com",
+		"email_verified": true,
+	})
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, _ := rsa.SignPKCS1v15(rand.Reader, idp.key, crypto.SHA256, digest[:])
+	json.NewEncoder(w).Encode(map[string]string{
+		"id_token": signingInput + "." + base64.RawURLEncoding.EncodeToString(signature),
+	})
+}
+
+// login follows the provider's redirect the way a browser would and
+// returns the code and state of the callback URL.
+func (idp *testIdP) login(t *testing.T, authURL string) (string, string) {
+	t.Helper()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatalf("GET %s: %v", authURL, err)
+	}
+	resp.Body.Close()
+	location, err := resp.Location()
+	if err != nil {
+		t.Fatalf("provider did not redirect back (status %d): %v", resp.StatusCode, err)
+	}
+	return location.Query().Get("code"), location.Query().Get("state")
+}
+
+func newOIDCTestService(t *testing.T) (*UrlService, *testIdP) {
+	t.Helper()
+	service, _, _ := newTestService(t)
+	idp := newTestIdP(t)
+	provider, err := oidc.NewProvider(context.Background(), oidc.Config{
+		Issuer:      idp.server.URL,
+		ClientID:    testOIDCClientID,
+		RedirectURL: "https://short.example/auth/oidc/callback",
+	})
+	if err != nil {
+		t.Fatalf("NewProvider: %v", err)
+	}
+	service.SetOIDCProvider(provider)
+	return service, idp
+}
+
+func TestOIDCCallbackPKCERoundTrip(t *testing.T) {
+	service, idp := newOIDCTestService(t)
+
+	authURL, err := service.BeginOIDCLogin()
+	if err != nil {
+		t.Fatalf("BeginOIDCLogin: %v", err)
+	}
+	code, state := idp.login(t, authURL)
+
+	user, tokens, err := service.CompleteOIDCLogin(code, state)
+	if err != nil {
+		t.Fatalf("CompleteOIDCLogin: %v", err)
+	}
+	if user.Email != "sso.user@example.com" {
+		t.Errorf("email = %q, want the verified email from the ID token", user.Email)
+	}
+	if userID, _, err := service.AuthenticateSession(tokens.AccessToken); err != nil || userID != user.UserID {
+		t.Errorf("AuthenticateSession = (%q, %v), want %q", userID, err, user.UserID)
+	}
+
+	// A replayed callback finds its state used up.
+	if _, _, err := service.CompleteOIDCLogin(code, state); !errors.Is(err, ErrInvalidOIDCState) {
+		t.Errorf("replayed callback error = %v, want ErrInvalidOIDCState", err)
+	}
+
+	// Logging in again maps the identity to the same user.
+	authURL, err = service.BeginOIDCLogin()
+	if err != nil {
+		t.Fatalf("BeginOIDCLogin: %v", err)
+	}
+	again, _, err := service.CompleteOIDCLogin(idp.login(t, authURL))
+	if err != nil {
+		t.Fatalf("second CompleteOIDCLogin: %v", err)
+	}
+	if again.UserID != user.UserID {
+		t.Errorf("second login user = %q, want %q", again.UserID, user.UserID)
+	}
+}
+
+func TestOIDCCallbackRejectsCodeOfAnotherLogin(t *testing.T) {
+	service, idp := newOIDCTestService(t)
+
+	// The code is bound to the first login's challenge, so redeeming it with
+	// the second login's verifier must fail at the token endpoint.
+	firstURL, err := service.BeginOIDCLogin()
+	if err != nil {
+		t.Fatalf("BeginOIDCLogin: %v", err)
+	}
+	secondURL, err := service.BeginOIDCLogin()
+	if err != nil {
+		t.Fatalf("BeginOIDCLogin: %v", err)
+	}
+	code, _ := idp.login(t, firstURL)
+	_, state := idp.login(t, secondURL)
+
+	_, _, err = service.CompleteOIDCLogin(code, state)
+	if err == nil || !strings.Contains(err.Error(), "PKCE verification failed") {
+		t.Fatalf("CompleteOIDCLogin error = %v, want a PKCE failure", err)
+	}
+}
+
+func TestOIDCCallbackRejectsUnknownState(t *testing.T) {
+	service, idp := newOIDCTestService(t)
+
+	authURL, err := service.BeginOIDCLogin()
+	if err != nil {
+		t.Fatalf("BeginOIDCLogin: %v", err)
+	}
+	code, _ := idp.login(t, authURL)
+
+	if _, _, err := service.CompleteOIDCLogin(code, "made-up-state"); !errors.Is(err, ErrInvalidOIDCState) {
+		t.Errorf("CompleteOIDCLogin error = %v, want ErrInvalidOIDCState", err)
+	}
+}
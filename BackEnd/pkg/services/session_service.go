@@ -0,0 +1,159 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"shorten-url/backend/pkg/config"
+	"shorten-url/backend/pkg/db/sqlc"
+	"shorten-url/backend/pkg/utils"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	accessTokenTTL  = 15 * time.Minute
+	sessionLifetime = 30 * 24 * time.Hour
+	refreshPrefix   = "rt_"
+	sessionSubject  = "session:"
+)
+
+var ErrInvalidSession = errors.New("invalid or expired session")
+
+// SessionTokens is returned on signup, login and refresh. The access token
+// is a short-lived signed token sent as "Authorization: Bearer"; the
+// refresh token is single-use and trades for a new pair.
+type SessionTokens struct {
+	AccessToken  string `json:"accessToken"`
+	RefreshToken string `json:"refreshToken"`
+	TokenType    string `json:"tokenType"`
+	ExpiresIn    int    `json:"expiresIn"`
+}
+
+func (s *UrlService) startSession(userID uuid.UUID) (*SessionTokens, error) {
+	refreshToken, err := randomToken(refreshPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	sessionID, err := s.postgresClient.Queries.CreateSession(s.ctx, sqlc.CreateSessionParams{
+		UserID:      utils.ConvertFromUuidPg(userID),
+		RefreshHash: hashToken(refreshToken),
+		ExpiresAt:   pgtype.Timestamptz{Time: time.Now().Add(sessionLifetime), Valid: true},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session: %v", err)
+	}
+
+	return newSessionTokens(utils.ConvertFromPgUuid(sessionID), userID, refreshToken), nil
+}
+
+// RefreshSession rotates a refresh token. Each refresh token works once, so
+// a stolen one stops working as soon as the legitimate client refreshes.
+func (s *UrlService) RefreshSession(refreshToken string) (*SessionTokens, error) {
+	if !strings.HasPrefix(refreshToken, refreshPrefix) {
+		return nil, ErrInvalidSession
+	}
+	next, err := randomToken(refreshPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := s.postgresClient.Queries.RotateSession(s.ctx, sqlc.RotateSessionParams{
+		NewRefreshHash: hashToken(next),
+		RefreshHash:    hashToken(refreshToken),
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrInvalidSession
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to refresh session: %v", err)
+	}
+
+	return newSessionTokens(utils.ConvertFromPgUuid(session.ID), utils.ConvertFromPgUuid(session.UserID), next), nil
+}
+
+// AuthenticateSession checks an access token and returns the user and
+// session it was issued for.
+func (s *UrlService) AuthenticateSession(accessToken string) (string, string, error) {
+	subject, ok := utils.VerifyToken(config.AppConfig.Server.TokenSecret, accessToken)
+	if !ok || !strings.HasPrefix(subject, sessionSubject) {
+		return "", "", ErrInvalidSession
+	}
+	sessionID, userID, ok := strings.Cut(strings.TrimPrefix(subject, sessionSubject), ":")
+	if !ok {
+		return "", "", ErrInvalidSession
+	}
+
+	// Access tokens are not looked up in Postgres; logging out leaves a
+	// marker that outlives every token of the session.
+	revoked, err := s.redisClient.Exists(s.ctx, revokedSessionKey(sessionID)).Result()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to check session: %v", err)
+	}
+	if revoked > 0 {
+		return "", "", ErrInvalidSession
+	}
+	return userID, sessionID, nil
+}
+
+// Logout ends one session of the user.
+func (s *UrlService) Logout(userIDStr string, sessionIDStr string) error {
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return ErrInvalidUserID
+	}
+	sessionID, err := uuid.Parse(sessionIDStr)
+	if err != nil {
+		return ErrInvalidSession
+	}
+
+	revoked, err := s.postgresClient.Queries.RevokeSession(s.ctx, sqlc.RevokeSessionParams{
+		ID:     utils.ConvertFromUuidPg(sessionID),
+		UserID: utils.ConvertFromUuidPg(userID),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to revoke session: %v", err)
+	}
+	if revoked == 0 {
+		return ErrInvalidSession
+	}
+	return s.markSessionRevoked(sessionID.String())
+}
+
+func (s *UrlService) revokeAllSessions(userID uuid.UUID) error {
+	sessionIDs, err := s.postgresClient.Queries.RevokeUserSessions(s.ctx, utils.ConvertFromUuidPg(userID))
+	if err != nil {
+		return fmt.Errorf("failed to revoke sessions: %v", err)
+	}
+	for _, id := range sessionIDs {
+		if err := s.markSessionRevoked(utils.ConvertFromPgUuid(id).String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *UrlService) markSessionRevoked(sessionID string) error {
+	if err := s.redisClient.Set(s.ctx, revokedSessionKey(sessionID), 1, accessTokenTTL).Err(); err != nil {
+		return fmt.Errorf("failed to mark session revoked: %v", err)
+	}
+	return nil
+}
+
+func newSessionTokens(sessionID uuid.UUID, userID uuid.UUID, refreshToken string) *SessionTokens {
+	subject := sessionSubject + sessionID.String() + ":" + userID.String()
+	return &SessionTokens{
+		AccessToken:  utils.SignToken(config.AppConfig.Server.TokenSecret, subject, time.Now().Add(accessTokenTTL)),
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(accessTokenTTL.Seconds()),
+	}
+}
+
+func revokedSessionKey(sessionID string) string {
+	return "revoked_session:" + sessionID
+}
@@ -0,0 +1,309 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"shorten-url/backend/pkg/db/sqlc"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	// Click events are inserted in short transactions; anything ingested
+	// more recently than this may still be followed by rows with an earlier
+	// ingested_at, so the rollup job leaves it for its next run.
+	rollupLag = time.Minute
+	// Each rollup transaction covers at most this much ingestion time.
+	rollupChunk = time.Hour
+
+	defaultStatsRange = 7 * 24 * time.Hour
+	maxStatsBuckets   = 1000
+	// Breakdowns list only the most clicked values of each dimension.
+	maxBreakdownValues = 10
+	maxBreakdownLength = 255
+
+	dimensionReferrer = "referrer"
+	dimensionBrowser  = "browser"
+	dimensionOS       = "os"
+	dimensionDevice   = "device"
+)
+
+var ErrInvalidStatsQuery = errors.New("invalid stats query")
+
+// StatsQuery selects the clicks of one link in [From, To), bucketed by
+// Interval ("hour", "day" or "week") in the IANA TimeZone. Zero values
+// default to the last seven days by day in UTC.
+type StatsQuery struct {
+	From     time.Time
+	To       time.Time
+	Interval string
+	TimeZone string
+}
+
+type StatsBucket struct {
+	Start     time.Time `json:"start"`
+	Clicks    int64     `json:"clicks"`
+	BotClicks int64     `json:"bot_clicks"`
+}
+
+type StatsCount struct {
+	Value  string `json:"value"`
+	Clicks int64  `json:"clicks"`
+}
+
+// LinkStats is served from the rollup tables and visitor sketches only.
+// Series has one bucket per interval, including empty ones. Clicks and
+// breakdowns count people; bots are only counted in BotClicks. Breakdowns
+// and UniqueVisitors cover whole UTC days.
+type LinkStats struct {
+	Shortened        string        `json:"shortened"`
+	Interval         string        `json:"interval"`
+	TimeZone         string        `json:"time_zone"`
+	From             time.Time     `json:"from"`
+	To               time.Time     `json:"to"`
+	Total            int64         `json:"total"`
+	BotClicks        int64         `json:"bot_clicks"`
+	UniqueVisitors   int64         `json:"unique_visitors"`
+	Series           []StatsBucket `json:"series"`
+	Referrers        []StatsCount  `json:"referrers"`
+	Browsers         []StatsCount  `json:"browsers"`
+	OperatingSystems []StatsCount  `json:"operating_systems"`
+	Devices          []StatsCount  `json:"devices"`
+}
+
+// GetStats returns click statistics for a link the user can view, which
+// includes every member of the link's workspace.
+func (s *UrlService) GetStats(shortenedURL string, userIDStr string, query StatsQuery) (*LinkStats, error) {
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return nil, ErrInvalidUserID
+	}
+
+	if query.Interval == "" {
+		query.Interval = "day"
+	}
+	if query.Interval != "hour" && query.Interval != "day" && query.Interval != "week" {
+		return nil, fmt.Errorf("%w: interval must be hour, day or week", ErrInvalidStatsQuery)
+	}
+	if query.TimeZone == "" {
+		query.TimeZone = "UTC"
+	}
+	// "Local" would be resolved by Go and Postgres to different zones.
+	location, err := time.LoadLocation(query.TimeZone)
+	if err != nil || query.TimeZone == "Local" {
+		return nil, fmt.Errorf("%w: unknown time zone %q", ErrInvalidStatsQuery, query.TimeZone)
+	}
+	if query.To.IsZero() {
+		query.To = time.Now()
+	}
+	if query.From.IsZero() {
+		query.From = query.To.Add(-defaultStatsRange)
+	}
+	if !query.From.Before(query.To) {
+		return nil, fmt.Errorf("%w: from must be before to", ErrInvalidStatsQuery)
+	}
+
+	// The first bucket is widened to its start so it is not partially counted.
+	from := bucketStart(query.From.In(location), query.Interval)
+	to := query.To.In(location)
+	buckets := 0
+	for t := from; t.Before(to); t = nextBucket(t, query.Interval) {
+		if buckets++; buckets > maxStatsBuckets {
+			return nil, fmt.Errorf("%w: range spans more than %d buckets", ErrInvalidStatsQuery, maxStatsBuckets)
+		}
+	}
+
+	url, err := s.lookupURL(shortenedURL)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrURLNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := s.authorizeLink(url, userID, RoleViewer); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.postgresClient.Queries.GetClickSeries(s.ctx, sqlc.GetClickSeriesParams{
+		Unit:      query.Interval,
+		TimeZone:  location.String(),
+		Shortened: shortenedURL,
+		RangeFrom: pgtype.Timestamptz{Time: from, Valid: true},
+		RangeTo:   pgtype.Timestamptz{Time: to, Valid: true},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get click series: %v", err)
+	}
+	// Postgres returns wall-clock bucket starts in the requested zone.
+	clicks := make(map[time.Time]StatsBucket, len(rows))
+	for _, row := range rows {
+		wall := row.BucketStart.Time
+		start := time.Date(wall.Year(), wall.Month(), wall.Day(), wall.Hour(), 0, 0, 0, location).UTC()
+		bucket := clicks[start]
+		bucket.Clicks += row.Clicks
+		bucket.BotClicks += row.BotClicks
+		clicks[start] = bucket
+	}
+
+	stats := &LinkStats{
+		Shortened:        shortenedURL,
+		Interval:         query.Interval,
+		TimeZone:         location.String(),
+		From:             from,
+		To:               to,
+		Series:           make([]StatsBucket, 0, buckets),
+		Referrers:        []StatsCount{},
+		Browsers:         []StatsCount{},
+		OperatingSystems: []StatsCount{},
+		Devices:          []StatsCount{},
+	}
+	for t := from; t.Before(to); t = nextBucket(t, query.Interval) {
+		bucket := clicks[t.UTC()]
+		bucket.Start = t
+		stats.Series = append(stats.Series, bucket)
+		stats.Total += bucket.Clicks
+		stats.BotClicks += bucket.BotClicks
+	}
+
+	breakdowns, err := s.postgresClient.Queries.GetClickBreakdowns(s.ctx, sqlc.GetClickBreakdownsParams{
+		Shortened: shortenedURL,
+		DayFrom:   pgtype.Date{Time: utcDay(from), Valid: true},
+		DayTo:     pgtype.Date{Time: utcDay(to.Add(-time.Nanosecond)), Valid: true},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get click breakdowns: %v", err)
+	}
+	// Rows arrive ordered by dimension and then clicks, most clicked first.
+	for _, row := range breakdowns {
+		var counts *[]StatsCount
+		switch row.Dimension {
+		case dimensionReferrer:
+			counts = &stats.Referrers
+		case dimensionBrowser:
+			counts = &stats.Browsers
+		case dimensionOS:
+			counts = &stats.OperatingSystems
+		case dimensionDevice:
+			counts = &stats.Devices
+		default:
+			continue
+		}
+		if len(*counts) < maxBreakdownValues {
+			*counts = append(*counts, StatsCount{Value: row.Value, Clicks: row.Clicks})
+		}
+	}
+
+	// Days before the link existed or after today have no sketches.
+	visitorsFrom, visitorsTo := from, to
+	if visitorsFrom.Before(url.CreatedAt) {
+		visitorsFrom = url.CreatedAt
+	}
+	if now := time.Now(); visitorsTo.After(now) {
+		visitorsTo = now
+	}
+	if visitorsFrom.Before(visitorsTo) {
+		stats.UniqueVisitors, err = s.uniqueVisitorsBetween(shortenedURL, visitorsFrom, visitorsTo)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return stats, nil
+}
+
+func bucketStart(t time.Time, interval string) time.Time {
+	switch interval {
+	case "hour":
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, t.Location())
+	case "week":
+		// Weeks start on Monday, as in Postgres' date_trunc.
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// nextBucket steps in calendar units so days and weeks stay aligned to
+// local midnight across daylight saving changes.
+func nextBucket(t time.Time, interval string) time.Time {
+	switch interval {
+	case "hour":
+		return t.Add(time.Hour)
+	case "week":
+		return t.AddDate(0, 0, 7)
+	}
+	return t.AddDate(0, 0, 1)
+}
+
+func utcDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// RollUpClicks folds click events ingested since the last run into the
+// hourly and daily breakdown rollups. Runs on several instances serialize on
+// the click_rollup_state row, and each chunk moves the watermark in the
+// same transaction as its counts, so every event is counted exactly once.
+func (s *UrlService) RollUpClicks() error {
+	for {
+		done, err := s.rollUpClickChunk()
+		if err != nil {
+			return err
+		}
+		if done {
+			return nil
+		}
+	}
+}
+
+// rollUpClickChunk aggregates one chunk in Postgres. The window ends on the
+// database clock, which also stamps ingested_at, so a skewed instance clock
+// can neither skip events nor roll up ones still being inserted.
+func (s *UrlService) rollUpClickChunk() (bool, error) {
+	tx, err := s.postgresClient.DB.Begin(s.ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback(s.ctx)
+	queries := s.postgresClient.Queries.WithTx(tx)
+
+	state, err := queries.LockClickRollupState(s.ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to lock click rollup state: %v", err)
+	}
+	from := state.RolledUpTo.Time
+	until := state.Now.Time.Add(-rollupLag)
+	if !from.Before(until) {
+		return true, nil
+	}
+	to := from.Add(rollupChunk)
+	if to.After(until) {
+		to = until
+	}
+
+	ingestedFrom := pgtype.Timestamptz{Time: from, Valid: true}
+	ingestedTo := pgtype.Timestamptz{Time: to, Valid: true}
+	if err := queries.RollUpHourlyClicks(s.ctx, sqlc.RollUpHourlyClicksParams{
+		IngestedFrom: ingestedFrom,
+		IngestedTo:   ingestedTo,
+	}); err != nil {
+		return false, fmt.Errorf("failed to roll up hourly clicks: %v", err)
+	}
+	if err := queries.RollUpClickBreakdowns(s.ctx, sqlc.RollUpClickBreakdownsParams{
+		IngestedFrom: ingestedFrom,
+		IngestedTo:   ingestedTo,
+	}); err != nil {
+		return false, fmt.Errorf("failed to roll up click breakdowns: %v", err)
+	}
+
+	if err := queries.UpdateClickRollupState(s.ctx, ingestedTo); err != nil {
+		return false, fmt.Errorf("failed to update click rollup state: %v", err)
+	}
+	if err := tx.Commit(s.ctx); err != nil {
+		return false, fmt.Errorf("failed to commit click rollup: %v", err)
+	}
+	return !to.Before(until), nil
+}
@@ -0,0 +1,144 @@
+package services
+
+import (
+	"errors"
+	"shorten-url/backend/pkg/db/sqlc"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func TestBucketStart(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A Thursday afternoon.
+	thursday := time.Date(2026, 10, 15, 14, 35, 12, 0, berlin)
+
+	tests := []struct {
+		name     string
+		t        time.Time
+		interval string
+		want     time.Time
+	}{
+		{"hour", thursday, "hour", time.Date(2026, 10, 15, 14, 0, 0, 0, berlin)},
+		{"day", thursday, "day", time.Date(2026, 10, 15, 0, 0, 0, 0, berlin)},
+		{"week from thursday", thursday, "week", time.Date(2026, 10, 12, 0, 0, 0, 0, berlin)},
+		{"week from monday", time.Date(2026, 10, 12, 0, 0, 0, 0, berlin), "week", time.Date(2026, 10, 12, 0, 0, 0, 0, berlin)},
+		{"week from sunday", time.Date(2026, 10, 18, 23, 59, 0, 0, berlin), "week", time.Date(2026, 10, 12, 0, 0, 0, 0, berlin)},
+		{"day in UTC", time.Date(2026, 10, 15, 23, 30, 0, 0, time.UTC), "day", time.Date(2026, 10, 15, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := bucketStart(tt.t, tt.interval); !got.Equal(tt.want) {
+				t.Errorf("bucketStart(%v, %q) = %v, want %v", tt.t, tt.interval, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNextBucketAcrossDaylightSaving(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Clocks in Berlin go forward on 29 March 2026 and back on 25 October.
+	tests := []struct {
+		name     string
+		t        time.Time
+		interval string
+		want     time.Time
+		length   time.Duration
+	}{
+		{"short day", time.Date(2026, 3, 29, 0, 0, 0, 0, berlin), "day", time.Date(2026, 3, 30, 0, 0, 0, 0, berlin), 23 * time.Hour},
+		{"long day", time.Date(2026, 10, 25, 0, 0, 0, 0, berlin), "day", time.Date(2026, 10, 26, 0, 0, 0, 0, berlin), 25 * time.Hour},
+		{"short week", time.Date(2026, 3, 23, 0, 0, 0, 0, berlin), "week", time.Date(2026, 3, 30, 0, 0, 0, 0, berlin), 7*24*time.Hour - time.Hour},
+		{"hour over the gap", time.Date(2026, 3, 29, 1, 0, 0, 0, berlin), "hour", time.Date(2026, 3, 29, 3, 0, 0, 0, berlin), time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := nextBucket(tt.t, tt.interval)
+			if !got.Equal(tt.want) {
+				t.Errorf("nextBucket(%v, %q) = %v, want %v", tt.t, tt.interval, got, tt.want)
+			}
+			if length := got.Sub(tt.t); length != tt.length {
+				t.Errorf("bucket lasts %v, want %v", length, tt.length)
+			}
+		})
+	}
+}
+
+func TestGetStatsRejectsBadQueries(t *testing.T) {
+	to := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		query StatsQuery
+	}{
+		{"unknown interval", StatsQuery{Interval: "month"}},
+		{"unknown time zone", StatsQuery{TimeZone: "Mars/Olympus_Mons"}},
+		{"server time zone", StatsQuery{TimeZone: "Local"}},
+		{"empty range", StatsQuery{From: to, To: to}},
+		{"reversed range", StatsQuery{From: to.Add(time.Hour), To: to}},
+		{"too many buckets", StatsQuery{From: to.AddDate(0, 0, -maxStatsBuckets/24-1), To: to, Interval: "hour"}},
+	}
+	service, _, _ := newTestService(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := service.GetStats("abc", uuid.NewString(), tt.query)
+			if !errors.Is(err, ErrInvalidStatsQuery) {
+				t.Errorf("GetStats error = %v, want ErrInvalidStatsQuery", err)
+			}
+		})
+	}
+}
+
+func TestGetStatsFillsLocalBuckets(t *testing.T) {
+	service, _, _ := newTestService(t)
+	db := service.postgresClient.DB.(*fakeDB)
+	userID := uuid.New()
+	addTestURL(db, "abc", userID, uuid.Nil)
+	// Postgres reports bucket starts as wall-clock times in the zone.
+	wall := func(day int) pgtype.Timestamp {
+		return pgtype.Timestamp{Time: time.Date(2026, 3, day, 0, 0, 0, 0, time.UTC), Valid: true}
+	}
+	db.clickSeries = []sqlc.GetClickSeriesRow{
+		{BucketStart: wall(29), Clicks: 5, BotClicks: 1},
+		{BucketStart: wall(30), Clicks: 2},
+	}
+
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats, err := service.GetStats("abc", userID.String(), StatsQuery{
+		From:     time.Date(2026, 3, 28, 10, 0, 0, 0, berlin),
+		To:       time.Date(2026, 3, 31, 0, 0, 0, 0, berlin),
+		TimeZone: "Europe/Berlin",
+	})
+	if err != nil {
+		t.Fatalf("GetStats: %v", err)
+	}
+
+	want := []StatsBucket{
+		{Start: time.Date(2026, 3, 28, 0, 0, 0, 0, berlin)},
+		{Start: time.Date(2026, 3, 29, 0, 0, 0, 0, berlin), Clicks: 5, BotClicks: 1},
+		{Start: time.Date(2026, 3, 30, 0, 0, 0, 0, berlin), Clicks: 2},
+	}
+	if len(stats.Series) != len(want) {
+		t.Fatalf("series has %d buckets, want %d: %+v", len(stats.Series), len(want), stats.Series)
+	}
+	for i, bucket := range stats.Series {
+		if !bucket.Start.Equal(want[i].Start) || bucket.Clicks != want[i].Clicks || bucket.BotClicks != want[i].BotClicks {
+			t.Errorf("bucket %d = %+v, want %+v", i, bucket, want[i])
+		}
+	}
+	if stats.Total != 7 || stats.BotClicks != 1 {
+		t.Errorf("totals = (%d, %d bots), want (7, 1 bots)", stats.Total, stats.BotClicks)
+	}
+	if _, err := service.GetStats("abc", uuid.NewString(), StatsQuery{}); !errors.Is(err, ErrNotOwner) {
+		t.Errorf("GetStats by a stranger: error = %v, want ErrNotOwner", err)
+	}
+}
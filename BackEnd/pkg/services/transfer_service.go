@@ -0,0 +1,151 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"shorten-url/backend/pkg/db/sqlc"
+	"shorten-url/backend/pkg/utils"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	log "github.com/sirupsen/logrus"
+)
+
+var ErrInvalidTransfer = errors.New("transfer needs exactly one of userId or workspaceId")
+
+// Cache entries of transferred links are dropped this many per pipeline.
+const transferInvalidateBatch = 1000
+
+// TransferTarget is the new owner of transferred links: a user, who gets
+// them as personal links, or a workspace.
+type TransferTarget struct {
+	UserID      string `json:"userId"`
+	WorkspaceID string `json:"workspaceId"`
+}
+
+// TransferURL hands one link to a new owner. The code, clicks and every
+// other column stay as they are. Personal links can be transferred by their
+// creator, workspace links by the workspace's owners.
+func (s *UrlService) TransferURL(shortenedURL string, actorIDStr string, target TransferTarget) (*CachedURL, error) {
+	actorID, err := uuid.Parse(actorIDStr)
+	if err != nil {
+		return nil, ErrInvalidUserID
+	}
+	url, err := s.editableURL(shortenedURL, actorIDStr)
+	if err != nil {
+		return nil, err
+	}
+	if url.WorkspaceID != "" {
+		if err := s.authorizeLink(url, actorID, RoleOwner); err != nil {
+			return nil, err
+		}
+	}
+
+	toUserID, workspaceID, err := s.resolveTransferTarget(actorID, target)
+	if err != nil {
+		return nil, err
+	}
+
+	// user_id is part of the primary key, so the update is guarded by the
+	// current owner: a concurrent transfer or delete turns this one into a
+	// not-found instead of silently moving the link twice.
+	moved, err := s.postgresClient.Queries.TransferURL(s.ctx, sqlc.TransferURLParams{
+		ToUserID:    utils.ConvertFromUuidPg(toUserID),
+		WorkspaceID: workspaceID,
+		Shortened:   shortenedURL,
+		FromUserID:  utils.ConvertFromUuidPg(uuid.MustParse(url.UserID)),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to transfer URL: %v", err)
+	}
+	if moved == 0 {
+		return nil, ErrURLNotFound
+	}
+
+	return s.refreshCache(shortenedURL)
+}
+
+// TransferUserURLs moves every personal link of fromUserIDStr in one
+// transaction and returns how many moved. Links in workspaces are left
+// alone since the workspace already owns them, and so are links still queued
+// for insertion. The caller decides who may empty another user's account.
+func (s *UrlService) TransferUserURLs(fromUserIDStr string, actorIDStr string, target TransferTarget) (int, error) {
+	fromUserID, err := uuid.Parse(fromUserIDStr)
+	if err != nil {
+		return 0, ErrInvalidUserID
+	}
+	actorID, err := uuid.Parse(actorIDStr)
+	if err != nil {
+		return 0, ErrInvalidUserID
+	}
+
+	toUserID, workspaceID, err := s.resolveTransferTarget(actorID, target)
+	if err != nil {
+		return 0, err
+	}
+	if toUserID == fromUserID && !workspaceID.Valid {
+		return 0, nil
+	}
+
+	tx, err := s.postgresClient.DB.Begin(s.ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback(s.ctx)
+
+	codes, err := s.postgresClient.Queries.WithTx(tx).TransferUserURLs(s.ctx, sqlc.TransferUserURLsParams{
+		ToUserID:    utils.ConvertFromUuidPg(toUserID),
+		WorkspaceID: workspaceID,
+		FromUserID:  utils.ConvertFromUuidPg(fromUserID),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to transfer URLs: %v", err)
+	}
+	if err := tx.Commit(s.ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit transfer: %v", err)
+	}
+
+	// Postgres is already consistent; the moved links are reloaded from it
+	// on their next lookup, so only log entries that could not be dropped.
+	for start := 0; start < len(codes); start += transferInvalidateBatch {
+		end := min(start+transferInvalidateBatch, len(codes))
+		pipe := s.redisClient.Pipeline()
+		for _, code := range codes[start:end] {
+			pipe.Del(s.ctx, code)
+		}
+		if _, err := pipe.Exec(s.ctx); err != nil {
+			log.Errorf("Failed to invalidate cache for %d transferred URLs: %v", end-start, err)
+		}
+	}
+	return len(codes), nil
+}
+
+// resolveTransferTarget validates target and returns the user_id and
+// workspace_id the links get. Links moved into a workspace are recorded under
+// the actor, who must be able to edit there.
+func (s *UrlService) resolveTransferTarget(actorID uuid.UUID, target TransferTarget) (uuid.UUID, pgtype.UUID, error) {
+	if (target.UserID == "") == (target.WorkspaceID == "") {
+		return uuid.Nil, pgtype.UUID{}, ErrInvalidTransfer
+	}
+
+	if target.WorkspaceID != "" {
+		workspaceID, err := s.requireWorkspaceRole(target.WorkspaceID, actorID, RoleEditor)
+		if err != nil {
+			return uuid.Nil, pgtype.UUID{}, err
+		}
+		return actorID, utils.ConvertFromUuidPg(workspaceID), nil
+	}
+
+	toUserID, err := uuid.Parse(target.UserID)
+	if err != nil {
+		return uuid.Nil, pgtype.UUID{}, ErrInvalidUserID
+	}
+	exists, err := s.postgresClient.Queries.UserExists(s.ctx, utils.ConvertFromUuidPg(toUserID))
+	if err != nil {
+		return uuid.Nil, pgtype.UUID{}, fmt.Errorf("failed to look up user: %v", err)
+	}
+	if !exists {
+		return uuid.Nil, pgtype.UUID{}, ErrUserNotFound
+	}
+	return toUserID, pgtype.UUID{}, nil
+}
@@ -0,0 +1,162 @@
+package services
+
+import (
+	"errors"
+	"shorten-url/backend/pkg/db/sqlc"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func addTestURL(db *fakeDB, code string, userID uuid.UUID, workspaceID uuid.UUID) {
+	url := sqlc.Url{
+		Shortened: code,
+		Original:  "https://example.com/" + code,
+		CreatedAt: pgtype.Timestamptz{Time: time.Now(), Valid: true},
+		UserID:    pgtype.UUID{Bytes: userID, Valid: true},
+	}
+	if workspaceID != uuid.Nil {
+		url.WorkspaceID = pgtype.UUID{Bytes: workspaceID, Valid: true}
+	}
+	db.urls[code] = url
+}
+
+func TestTransferURL(t *testing.T) {
+	tests := []struct {
+		name string
+		// The link is created by the editor, in the workspace if shared.
+		shared        bool
+		actor         func(w workspaceFixture) uuid.UUID
+		target        func(w workspaceFixture) TransferTarget
+		wantErr       error
+		wantUser      func(w workspaceFixture) uuid.UUID
+		wantWorkspace bool
+	}{
+		{
+			name:     "creator hands a personal link to another user",
+			actor:    func(w workspaceFixture) uuid.UUID { return w.editor },
+			target:   func(w workspaceFixture) TransferTarget { return TransferTarget{UserID: w.outsider.String()} },
+			wantUser: func(w workspaceFixture) uuid.UUID { return w.outsider },
+		},
+		{
+			name:          "creator moves a personal link into a workspace",
+			actor:         func(w workspaceFixture) uuid.UUID { return w.editor },
+			target:        func(w workspaceFixture) TransferTarget { return TransferTarget{WorkspaceID: w.id.String()} },
+			wantUser:      func(w workspaceFixture) uuid.UUID { return w.editor },
+			wantWorkspace: true,
+		},
+		{
+			name:     "owner takes a workspace link out",
+			shared:   true,
+			actor:    func(w workspaceFixture) uuid.UUID { return w.owner },
+			target:   func(w workspaceFixture) TransferTarget { return TransferTarget{UserID: w.viewer.String()} },
+			wantUser: func(w workspaceFixture) uuid.UUID { return w.viewer },
+		},
+		{
+			name:    "editor takes a workspace link out",
+			shared:  true,
+			actor:   func(w workspaceFixture) uuid.UUID { return w.editor },
+			target:  func(w workspaceFixture) TransferTarget { return TransferTarget{UserID: w.outsider.String()} },
+			wantErr: ErrWorkspaceForbidden,
+		},
+		{
+			name:    "someone else's personal link",
+			actor:   func(w workspaceFixture) uuid.UUID { return w.owner },
+			target:  func(w workspaceFixture) TransferTarget { return TransferTarget{UserID: w.owner.String()} },
+			wantErr: ErrNotOwner,
+		},
+		{
+			name:    "into a workspace the creator cannot edit",
+			actor:   func(w workspaceFixture) uuid.UUID { return w.editor },
+			target:  func(w workspaceFixture) TransferTarget { return TransferTarget{WorkspaceID: uuid.NewString()} },
+			wantErr: ErrWorkspaceNotFound,
+		},
+		{
+			name:    "to an unknown user",
+			actor:   func(w workspaceFixture) uuid.UUID { return w.editor },
+			target:  func(w workspaceFixture) TransferTarget { return TransferTarget{UserID: uuid.NewString()} },
+			wantErr: ErrUserNotFound,
+		},
+		{
+			name:  "to a user and a workspace at once",
+			actor: func(w workspaceFixture) uuid.UUID { return w.editor },
+			target: func(w workspaceFixture) TransferTarget {
+				return TransferTarget{UserID: w.outsider.String(), WorkspaceID: w.id.String()}
+			},
+			wantErr: ErrInvalidTransfer,
+		},
+		{
+			name:    "to nobody",
+			actor:   func(w workspaceFixture) uuid.UUID { return w.editor },
+			target:  func(w workspaceFixture) TransferTarget { return TransferTarget{} },
+			wantErr: ErrInvalidTransfer,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, _, _ := newTestService(t)
+			db := service.postgresClient.DB.(*fakeDB)
+			w := newWorkspaceFixture(t, service)
+			workspaceID := uuid.Nil
+			if tt.shared {
+				workspaceID = w.id
+			}
+			addTestURL(db, "abc", w.editor, workspaceID)
+
+			url, err := service.TransferURL("abc", tt.actor(w).String(), tt.target(w))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("TransferURL error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			wantWorkspace := ""
+			if tt.wantWorkspace {
+				wantWorkspace = w.id.String()
+			}
+			if url.UserID != tt.wantUser(w).String() || url.WorkspaceID != wantWorkspace {
+				t.Errorf("transferred link = (user %s, workspace %q), want (%s, %q)", url.UserID, url.WorkspaceID, tt.wantUser(w), wantWorkspace)
+			}
+			if cached, _ := service.getFromCache("abc"); cached == nil || cached.UserID != url.UserID {
+				t.Errorf("cache = %+v, want the new owner", cached)
+			}
+		})
+	}
+}
+
+func TestTransferUserURLsMovesPersonalLinksOnly(t *testing.T) {
+	service, mr, _ := newTestService(t)
+	db := service.postgresClient.DB.(*fakeDB)
+	w := newWorkspaceFixture(t, service)
+	addTestURL(db, "mine1", w.editor, uuid.Nil)
+	addTestURL(db, "mine2", w.editor, uuid.Nil)
+	addTestURL(db, "team1", w.editor, w.id)
+	addTestURL(db, "theirs", w.viewer, uuid.Nil)
+	mr.Set("mine1", `{"original":"https://example.com/mine1"}`)
+
+	moved, err := service.TransferUserURLs(w.editor.String(), w.owner.String(), TransferTarget{UserID: w.owner.String()})
+	if err != nil {
+		t.Fatalf("TransferUserURLs: %v", err)
+	}
+	if moved != 2 {
+		t.Errorf("moved = %d, want 2", moved)
+	}
+
+	var owned []string
+	for code, url := range db.urls {
+		if url.UserID.Bytes == w.owner {
+			owned = append(owned, code)
+		}
+	}
+	slices.Sort(owned)
+	if !slices.Equal(owned, []string{"mine1", "mine2"}) {
+		t.Errorf("links of the new owner = %v, want [mine1 mine2]", owned)
+	}
+	if mr.Exists("mine1") {
+		t.Error("cache entry of a transferred link was not dropped")
+	}
+}
@@ -3,15 +3,22 @@ package services
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgtype"
 	amqp "github.com/rabbitmq/amqp091-go"
 	"github.com/redis/go-redis/v9"
 	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
 	"shorten-url/backend/pkg/db/sqlc"
+	"shorten-url/backend/pkg/mail"
+	"shorten-url/backend/pkg/oidc"
 	"shorten-url/backend/pkg/stores"
 	"shorten-url/backend/pkg/utils"
+	"sort"
 	"sync"
 	"time"
 )
@@ -20,14 +27,70 @@ const (
 	batchSize  = 100
 	maxRetries = 3
 	baseDelay  = 100 * time.Millisecond
+
+	// Long enough for the queued row to be flushed to Postgres.
+	codeReservationTTL = 10 * time.Minute
+	maxCodeAttempts    = 5
+	maxOriginalLength  = 250
+	maxTitleLength     = 250
+
+	defaultLinkLifetime = 100 * 24 * time.Hour
+
+	// Links with pending clicks, drained by FlushClicks. Codes never contain
+	// ':', so no cache entry can collide with it.
+	clicksDirtyKey  = "dirty:clicks"
+	clickFlushBatch = 1000
 )
 
+var (
+	ErrInvalidRedirectStatus = errors.New("redirect status must be one of 301, 302, 307 or 308")
+	ErrInvalidAlias          = errors.New("invalid alias")
+	ErrAliasTaken            = errors.New("alias is already taken")
+	ErrCodeExhausted         = errors.New("failed to generate a unique short code")
+	ErrInvalidExpiry         = errors.New("expiry must be in the future")
+	ErrURLNotFound           = errors.New("url not found")
+	ErrNotOwner              = errors.New("url belongs to another user")
+	ErrURLPending            = errors.New("url is still being created, retry shortly")
+	ErrURLExpired            = errors.New("url has expired")
+	ErrInvalidMaxClicks      = errors.New("max clicks must not be negative")
+	ErrClickLimitReached     = errors.New("url has reached its click limit")
+	ErrInvalidPassword       = errors.New("password must be at most 72 bytes")
+	ErrWrongPassword         = errors.New("wrong password")
+	ErrInvalidURL            = errors.New("url must be between 1 and 250 characters")
+	ErrInvalidUserID         = errors.New("invalid user ID")
+	ErrInvalidTitle          = errors.New("title must be at most 250 characters")
+
+	errInvalidMessage = errors.New("invalid queued link")
+)
+
+// consumeClickScript seeds the shared counter from the persisted click count
+// the first time it is used, then increments it. Running in Redis makes the
+// check-and-increment atomic across every server instance.
+//
+// The counter gets no TTL: Redis runs with volatile-lru, which only evicts
+// keys that have one, and a counter reseeded from a stale count would hand
+// out used clicks again. The expiry cleanup deletes it with its link.
+var consumeClickScript = redis.NewScript(`
+redis.call('SET', KEYS[1], ARGV[1], 'NX')
+return redis.call('INCR', KEYS[1])
+`)
+
 type CachedURL struct {
-	Original  string    `json:"original"`
-	Clicks    int       `json:"clicks"`
-	CreatedAt time.Time `json:"created_at"`
-	ExpiredAt time.Time `json:"expired_at,omitempty"`
-	UserID    string    `json:"user_id,omitempty"`
+	Original       string    `json:"original"`
+	Clicks         int       `json:"clicks"`
+	CreatedAt      time.Time `json:"created_at"`
+	ExpiredAt      time.Time `json:"expired_at,omitempty"` // zero means the link never expires
+	UserID         string    `json:"user_id,omitempty"`
+	RedirectStatus int       `json:"redirect_status,omitempty"`
+	MaxClicks      int64     `json:"max_clicks,omitempty"` // zero means unlimited
+	PasswordHash   string    `json:"password_hash,omitempty"`
+	Title          string    `json:"title,omitempty"`
+	// Set for links shared through a workspace; member roles then decide
+	// who may change them.
+	WorkspaceID string `json:"workspace_id,omitempty"`
+	// Pending is set on entries written at create time, before the queued
+	// row has been flushed to Postgres.
+	Pending bool `json:"pending,omitempty"`
 }
 
 type UrlService struct {
@@ -36,29 +99,64 @@ type UrlService struct {
 	redisClient    *redis.ClusterClient
 	postgresClient *stores.Postgres
 	RabbitMQClient *stores.RabbitMQ
-	cacheMutex     sync.RWMutex
 	errorChan      chan error
 	instanceId     string
+	codeGenerator  utils.CodeGenerator
+	// Delivers password reset links; see SetMailSender.
+	mailSender       mail.Sender
+	passwordResetURL string
+	// Single sign-on provider, nil while SSO is not configured.
+	oidcProvider *oidc.Provider
+	// Buffers click events between redirects and PublishClickEvents.
+	clickEvents chan ClickEvent
 }
 type URLMessage struct {
-	OriginalURL string `json:"original_url"`
-	Shortened   string `json:"shortened"`
-	UserID      string `json:"user_id"`
-	Counter     int    `json:"counter"`
+	OriginalURL    string    `json:"original_url"`
+	Shortened      string    `json:"shortened"`
+	UserID         string    `json:"user_id"`
+	Counter        int       `json:"counter"`
+	RedirectStatus int       `json:"redirect_status,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+	ExpiredAt      time.Time `json:"expired_at,omitempty"`
+	NeverExpires   bool      `json:"never_expires,omitempty"`
+	MaxClicks      int64     `json:"max_clicks,omitempty"`
+	PasswordHash   string    `json:"password_hash,omitempty"`
+	Title          string    `json:"title,omitempty"`
+	WorkspaceID    string    `json:"workspace_id,omitempty"`
+}
+
+// CreateURLOptions holds the optional per-link settings accepted by CreateURL.
+// A zero RedirectStatus falls back to the server-wide default, an empty Alias
+// lets the server pick the code and a zero ExpiresAt means the default
+// lifetime unless NeverExpires is set. MaxClicks of 1 makes a burn-after-reading
+// link, 0 means unlimited. A non-empty Password protects the link.
+type CreateURLOptions struct {
+	RedirectStatus int
+	Alias          string
+	ExpiresAt      time.Time
+	NeverExpires   bool
+	MaxClicks      int64
+	Password       string
+	Title          string
+	// Creates the link in a workspace the user can edit instead of as a
+	// personal link.
+	WorkspaceID string
 }
 
 var UrlServiceInstance *UrlService
 
-func NewUrlService(redisClient *redis.ClusterClient, postgresClient *stores.Postgres, RabbitMQClient *stores.RabbitMQ) *UrlService {
+func NewUrlService(redisClient *redis.ClusterClient, postgresClient *stores.Postgres, RabbitMQClient *stores.RabbitMQ, codeGenerator utils.CodeGenerator) *UrlService {
 	UrlServiceInstance = &UrlService{
 		ctx:            context.Background(),
 		cacheTimeout:   24 * time.Hour,
 		redisClient:    redisClient,
 		postgresClient: postgresClient,
 		RabbitMQClient: stores.RabbitMQClient,
-		cacheMutex:     sync.RWMutex{},
 		errorChan:      make(chan error, 100),
 		instanceId:     uuid.New().String()[0:8],
+		codeGenerator:  codeGenerator,
+		mailSender:     mail.LogSender{},
+		clickEvents:    make(chan ClickEvent, clickBufferSize),
 	}
 
 	go UrlServiceInstance.handleErrors()
@@ -66,7 +164,23 @@ func NewUrlService(redisClient *redis.ClusterClient, postgresClient *stores.Post
 	return UrlServiceInstance
 }
 
+// GetURL resolves a code for serving and fails with ErrURLExpired once the
+// link is past its expiry, even if the cleanup cron hasn't removed it yet.
 func (s *UrlService) GetURL(shortenedURL string) (*CachedURL, error) {
+	url, err := s.lookupURL(shortenedURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if url.IsExpired(time.Now()) {
+		return nil, ErrURLExpired
+	}
+
+	return url, nil
+}
+
+// lookupURL reads a link from cache or Postgres without any expiry check.
+func (s *UrlService) lookupURL(shortenedURL string) (*CachedURL, error) {
 
 	var cachedData *CachedURL
 	var err error
@@ -80,24 +194,123 @@ func (s *UrlService) GetURL(shortenedURL string) (*CachedURL, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err := s.setCache(shortenedURL, url); err != nil {
+		log.Errorf("Failed to cache %s: %v", shortenedURL, err)
+	}
 
 	return url, nil
 }
 
-func (s *UrlService) CreateURL(port string, originalURL string, userIDStr string) (string, error) {
-	baseHash := utils.Hash(originalURL)
-	shortenedURL := baseHash
+func (u *CachedURL) IsExpired(now time.Time) bool {
+	return !u.ExpiredAt.IsZero() && !u.ExpiredAt.After(now)
+}
+
+func (u *CachedURL) IsProtected() bool {
+	return u.PasswordHash != ""
+}
+
+// CheckURLPassword verifies the password of a protected link. Unprotected
+// links accept any password.
+func (s *UrlService) CheckURLPassword(shortenedURL string, password string) error {
+	url, err := s.GetURL(shortenedURL)
+	if err != nil {
+		return err
+	}
+	if !url.IsProtected() {
+		return nil
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(url.PasswordHash), []byte(password)); err != nil {
+		return ErrWrongPassword
+	}
+	return nil
+}
+
+// hashPassword returns the bcrypt hash of password, or "" for no password.
+func hashPassword(password string) (string, error) {
+	if password == "" {
+		return "", nil
+	}
+	if len(password) > 72 {
+		return "", ErrInvalidPassword
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %v", err)
+	}
+	return string(hash), nil
+}
+
+func (s *UrlService) CreateURL(port string, originalURL string, userIDStr string, opts CreateURLOptions) (string, error) {
+	if opts.RedirectStatus != 0 && !utils.IsRedirectStatus(opts.RedirectStatus) {
+		return "", ErrInvalidRedirectStatus
+	}
+	createdAt := time.Now()
+	if !opts.ExpiresAt.IsZero() && !opts.ExpiresAt.After(createdAt) {
+		return "", ErrInvalidExpiry
+	}
+	if opts.MaxClicks < 0 {
+		return "", ErrInvalidMaxClicks
+	}
+	if len(originalURL) > maxOriginalLength {
+		return "", ErrInvalidURL
+	}
+	if len(opts.Title) > maxTitleLength {
+		return "", ErrInvalidTitle
+	}
+	passwordHash, err := hashPassword(opts.Password)
+	if err != nil {
+		return "", err
+	}
 
 	userID, err := uuid.Parse(userIDStr)
 	if err != nil {
-		return "", fmt.Errorf("invalid user ID: %v", err)
+		return "", fmt.Errorf("%w: %v", ErrInvalidUserID, err)
+	}
+	if opts.WorkspaceID != "" {
+		workspaceID, err := s.requireWorkspaceRole(opts.WorkspaceID, userID, RoleEditor)
+		if err != nil {
+			return "", err
+		}
+		opts.WorkspaceID = workspaceID.String()
+	}
+
+	var shortenedURL string
+	if opts.Alias != "" {
+		if err := utils.ValidateAlias(opts.Alias); err != nil {
+			return "", fmt.Errorf("%w: %v", ErrInvalidAlias, err)
+		}
+		reserved, err := s.reserveCode(opts.Alias, userID.String())
+		if err != nil {
+			return "", err
+		}
+		if !reserved {
+			return "", ErrAliasTaken
+		}
+		shortenedURL = opts.Alias
+	} else {
+		shortenedURL, err = s.generateCode(originalURL, userID.String())
+		if err != nil {
+			return "", err
+		}
 	}
 
 	message := URLMessage{
-		OriginalURL: originalURL,
-		Shortened:   shortenedURL,
-		UserID:      userID.String(),
-		Counter:     0,
+		OriginalURL:    originalURL,
+		Shortened:      shortenedURL,
+		UserID:         userID.String(),
+		Counter:        0,
+		RedirectStatus: opts.RedirectStatus,
+		CreatedAt:      createdAt,
+		ExpiredAt:      opts.ExpiresAt,
+		NeverExpires:   opts.NeverExpires,
+		MaxClicks:      opts.MaxClicks,
+		PasswordHash:   passwordHash,
+		Title:          opts.Title,
+		WorkspaceID:    opts.WorkspaceID,
+	}
+	if message.ExpiredAt.IsZero() && !message.NeverExpires {
+		message.ExpiredAt = createdAt.Add(defaultLinkLifetime)
 	}
 
 	messageBody, err := json.Marshal(message)
@@ -119,9 +332,68 @@ func (s *UrlService) CreateURL(port string, originalURL string, userIDStr string
 		return "", fmt.Errorf("failed to publish message: %v", err)
 	}
 
+	// Make the link resolvable right away; the batch insert stays the durable
+	// path and only catches up later.
+	pending := &CachedURL{
+		Original:       message.OriginalURL,
+		Clicks:         message.Counter,
+		CreatedAt:      message.CreatedAt,
+		ExpiredAt:      message.ExpiredAt,
+		UserID:         message.UserID,
+		RedirectStatus: message.RedirectStatus,
+		MaxClicks:      message.MaxClicks,
+		PasswordHash:   message.PasswordHash,
+		Title:          message.Title,
+		WorkspaceID:    message.WorkspaceID,
+		Pending:        true,
+	}
+	if err := s.setCache(shortenedURL, pending); err != nil {
+		log.Errorf("Failed to write pending URL %s to cache: %v", shortenedURL, err)
+	}
+
 	return shortenedURL, nil
 }
 
+// generateCode asks the configured generator for candidates until one can be
+// reserved, so a code is never handed out twice.
+func (s *UrlService) generateCode(originalURL string, userID string) (string, error) {
+	for attempt := 0; attempt < maxCodeAttempts; attempt++ {
+		code, err := s.codeGenerator.Generate(originalURL, attempt)
+		if err != nil {
+			return "", err
+		}
+
+		reserved, err := s.reserveCode(code, userID)
+		if err != nil {
+			return "", err
+		}
+		if reserved {
+			return code, nil
+		}
+		log.Warnf("Short code collision on %s (attempt %d)", code, attempt+1)
+	}
+
+	return "", ErrCodeExhausted
+}
+
+// reserveCode claims a short code for userID across all instances. The Redis
+// reservation covers the window before the queued row reaches Postgres.
+func (s *UrlService) reserveCode(code string, userID string) (bool, error) {
+	exists, err := s.postgresClient.Queries.ShortenedExists(s.ctx, code)
+	if err != nil {
+		return false, fmt.Errorf("failed to check code availability: %v", err)
+	}
+	if exists {
+		return false, nil
+	}
+
+	reserved, err := s.redisClient.SetNX(s.ctx, "reserved:"+code, userID, codeReservationTTL).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to reserve code: %v", err)
+	}
+	return reserved, nil
+}
+
 func (s *UrlService) ProcessQueueBatch(port string, consumerTag string, batchSize int, batchTimeout time.Duration) {
 	msgs, err := stores.RabbitMQClient.Channel.Consume(
 		"queue-based-load-leveling-" + port, 
@@ -138,8 +410,41 @@ func (s *UrlService) ProcessQueueBatch(port string, consumerTag string, batchSiz
 
 
 	batch := make([]URLMessage, 0, batchSize)
+	deliveries := make([]amqp.Delivery, 0, batchSize)
 	timer := time.NewTimer(batchTimeout)
 
+	// Messages are acknowledged only once they are stored, so a failed
+	// insert is redelivered and the pending links stay resolvable meanwhile.
+	// Links the database rejects would fail forever; they go to the dead
+	// letter queue instead.
+	flush := func() {
+		if len(batch) > 0 {
+			var retried, rejected []URLMessage
+			for i, err := range s.storeBatch(batch) {
+				switch {
+				case err == nil:
+					deliveries[i].Ack(false)
+				case isRejected(err):
+					log.Errorf("Consumer %s: dead-lettering link %s: %v", consumerTag, batch[i].Shortened, err)
+					deliveries[i].Nack(false, false)
+					rejected = append(rejected, batch[i])
+				default:
+					deliveries[i].Nack(false, true)
+					retried = append(retried, batch[i])
+				}
+			}
+			if len(retried) > 0 {
+				log.Errorf("Consumer %s: failed to insert %d links, requeued", consumerTag, len(retried))
+			}
+			if len(rejected) > 0 {
+				s.clearPending(rejected)
+			}
+			batch = batch[:0]
+			deliveries = deliveries[:0]
+		}
+		timer.Reset(batchTimeout)
+	}
+
 	for {
 		select {
 		case msg := <-msgs:
@@ -151,134 +456,422 @@ func (s *UrlService) ProcessQueueBatch(port string, consumerTag string, batchSiz
 			}
 
 			batch = append(batch, urlMessage)
-
-			msg.Ack(false)
-
+			deliveries = append(deliveries, msg)
 			if len(batch) >= batchSize {
-				s.processBatch(batch)
-				batch = batch[:0]
-				timer.Reset(batchTimeout)
+				flush()
 			}
 
 		case <-timer.C:
-			if len(batch) > 0 {
-				s.processBatch(batch)
-				batch = batch[:0]
-			}
-			timer.Reset(batchTimeout)
+			flush()
 		}
 	}
 }
 
-func (s *UrlService) processBatch(batch []URLMessage) {
-	if len(batch) == 0 {
-		return
+// storeBatch inserts a batch of queued links and returns the outcome of each.
+// When the database rejects the batch, the links are inserted one by one so
+// a single bad link does not hold back the rest.
+func (s *UrlService) storeBatch(batch []URLMessage) []error {
+	errs := make([]error, len(batch))
+	err := s.processBatch(batch)
+	if err == nil || len(batch) == 1 || !isRejected(err) {
+		for i := range errs {
+			errs[i] = err
+		}
+		return errs
+	}
+
+	log.Warnf("Batch of %d links rejected, inserting them one by one: %v", len(batch), err)
+	for i, message := range batch {
+		errs[i] = s.processBatch([]URLMessage{message})
 	}
+	return errs
+}
+
+// isRejected reports whether a link failed on its own content rather than on
+// the connection, so storing it again can never succeed.
+func isRejected(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.Is(err, errInvalidMessage) || errors.As(err, &pgErr)
+}
 
+func (s *UrlService) processBatch(batch []URLMessage) error {
+	params, err := batchInsertParams(batch)
+	if err != nil {
+		return err
+	}
+	if _, err := s.postgresClient.Queries.BatchInsertURLs(s.ctx, params); err != nil {
+		return err
+	}
+	log.Debugf("Stored batch of %d links", len(batch))
+	s.clearPending(batch)
+	return nil
+}
+
+// clearPending drops the create-time cache entries of a stored batch, so the
+// next lookup loads the links from Postgres without the pending flag.
+func (s *UrlService) clearPending(batch []URLMessage) {
+	pipe := s.redisClient.Pipeline()
+	for _, message := range batch {
+		pipe.Del(s.ctx, message.Shortened)
+	}
+	if _, err := pipe.Exec(s.ctx); err != nil {
+		log.Errorf("Failed to clear pending cache entries: %v", err)
+	}
+}
+
+// batchInsertParams lays a batch of messages out as the column arrays
+// BatchInsertURLs unnests. It fails with errInvalidMessage on a malformed ID.
+func batchInsertParams(batch []URLMessage) (sqlc.BatchInsertURLsParams, error) {
 	params := sqlc.BatchInsertURLsParams{
-		Column1: make([]string, len(batch)),
-		Column2: make([]string, len(batch)),
-		Column3: make([]int64, len(batch)),
-		Column4: make([]pgtype.Timestamptz, len(batch)),
-		Column5: make([]pgtype.Timestamptz, len(batch)),
-		Column6: make([]pgtype.UUID, len(batch)),
+		Column1:  make([]string, len(batch)),
+		Column2:  make([]string, len(batch)),
+		Column3:  make([]int64, len(batch)),
+		Column4:  make([]pgtype.Timestamptz, len(batch)),
+		Column5:  make([]pgtype.Timestamptz, len(batch)),
+		Column6:  make([]pgtype.UUID, len(batch)),
+		Column7:  make([]int32, len(batch)),
+		Column8:  make([]int64, len(batch)),
+		Column9:  make([]string, len(batch)),
+		Column10: make([]string, len(batch)),
+		Column11: make([]pgtype.UUID, len(batch)),
 	}
 
 	for i, message := range batch {
+		createdAt := message.CreatedAt
+		if createdAt.IsZero() {
+			createdAt = time.Now()
+		}
+		expiredAt := pgtype.Timestamptz{Time: message.ExpiredAt, Valid: !message.NeverExpires}
+		if expiredAt.Valid && expiredAt.Time.IsZero() {
+			expiredAt.Time = createdAt.Add(defaultLinkLifetime)
+		}
+
 		params.Column1[i] = message.Shortened
 		params.Column2[i] = message.OriginalURL
 		params.Column3[i] = int64(message.Counter)
-		params.Column4[i] = pgtype.Timestamptz{Time: time.Now(), Valid: true}
-		params.Column5[i] = pgtype.Timestamptz{Time: time.Now().Add(24 * time.Hour * 100), Valid: true}
-		params.Column6[i] = pgtype.UUID{
-			Bytes: uuid.MustParse(message.UserID),
-			Valid: true,
+		params.Column4[i] = pgtype.Timestamptz{Time: createdAt, Valid: true}
+		params.Column5[i] = expiredAt
+		userID, err := uuid.Parse(message.UserID)
+		if err != nil {
+			return sqlc.BatchInsertURLsParams{}, fmt.Errorf("%w %s: user ID: %v", errInvalidMessage, message.Shortened, err)
+		}
+		params.Column6[i] = utils.ConvertFromUuidPg(userID)
+		params.Column7[i] = int32(message.RedirectStatus)
+		params.Column8[i] = message.MaxClicks
+		params.Column9[i] = message.PasswordHash
+		params.Column10[i] = message.Title
+		if message.WorkspaceID != "" {
+			workspaceID, err := uuid.Parse(message.WorkspaceID)
+			if err != nil {
+				return sqlc.BatchInsertURLsParams{}, fmt.Errorf("%w %s: workspace ID: %v", errInvalidMessage, message.Shortened, err)
+			}
+			params.Column11[i] = utils.ConvertFromUuidPg(workspaceID)
 		}
 	}
 
-	err := s.postgresClient.Queries.BatchInsertURLs(s.ctx, params)
-	if err != nil {
-		log.Printf("Failed to insert batch: %v", err)
-	} else {
-		fmt.Println("Successful append size ", len(batch));
-	}
+	return params, nil
 }
 
-func (s *UrlService) IncrementClicks(shortenedURL string) (*CachedURL, error) {
-	var updatedURL *CachedURL
-
-	s.cacheMutex.Lock()
-	defer s.cacheMutex.Unlock()
+// URLPatch lists the mutable fields of a link; nil (or zero) fields are left
+// untouched. An empty Password removes the protection.
+type URLPatch struct {
+	Original       *string
+	ExpiresAt      time.Time
+	NeverExpires   bool
+	RedirectStatus *int
+	MaxClicks      *int64
+	Password       *string
+	Title          *string
+}
 
-	cachedURL, err := s.getFromCache(shortenedURL)
-	if err == nil {
-		cachedURL.Clicks++
-		updatedURL = cachedURL
+// EditURL applies patch to a link owned by userIDStr and refreshes the shared
+// cache entry, so every instance serves the new settings at once.
+func (s *UrlService) EditURL(shortenedURL string, userIDStr string, patch URLPatch) (*CachedURL, error) {
+	url, err := s.editableURL(shortenedURL, userIDStr)
+	if err != nil {
+		return nil, err
+	}
 
-		if err := s.setCache(shortenedURL, cachedURL); err != nil {
-			log.Errorf("Failed to update clicks in cache for %s: %v", shortenedURL, err)
+	if patch.Original != nil {
+		if *patch.Original == "" || len(*patch.Original) > maxOriginalLength {
+			return nil, ErrInvalidURL
 		}
-	} else {
-		dbURL, err := s.getFromDB(shortenedURL)
+		url.Original = *patch.Original
+	}
+	expiryChanged := patch.NeverExpires || !patch.ExpiresAt.IsZero()
+	if expiryChanged {
+		if !patch.NeverExpires && !patch.ExpiresAt.After(time.Now()) {
+			return nil, ErrInvalidExpiry
+		}
+		url.ExpiredAt = patch.ExpiresAt
+	}
+	if patch.RedirectStatus != nil {
+		if *patch.RedirectStatus != 0 && !utils.IsRedirectStatus(*patch.RedirectStatus) {
+			return nil, ErrInvalidRedirectStatus
+		}
+		url.RedirectStatus = *patch.RedirectStatus
+	}
+	if patch.MaxClicks != nil {
+		if *patch.MaxClicks < 0 {
+			return nil, ErrInvalidMaxClicks
+		}
+		url.MaxClicks = *patch.MaxClicks
+	}
+	if patch.Password != nil {
+		url.PasswordHash, err = hashPassword(*patch.Password)
 		if err != nil {
-			return nil, fmt.Errorf("failed to get URL from database: %v", err)
+			return nil, err
 		}
-		dbURL.Clicks++
-		updatedURL = dbURL
+	}
+	if patch.Title != nil {
+		if len(*patch.Title) > maxTitleLength {
+			return nil, ErrInvalidTitle
+		}
+		url.Title = *patch.Title
+	}
 
-		if err := s.setCache(shortenedURL, dbURL); err != nil {
-			log.Errorf("Failed to set cache for %s: %v", shortenedURL, err)
+	tx, err := s.postgresClient.DB.Begin(s.ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback(s.ctx)
+	queries := s.postgresClient.Queries.WithTx(tx)
+
+	if patch.Original != nil {
+		err = queries.UpdateOriginalURL(s.ctx, sqlc.UpdateOriginalURLParams{
+			Shortened: shortenedURL,
+			Original:  url.Original,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to update destination: %v", err)
+		}
+	}
+	if expiryChanged {
+		err = queries.UpdateExpirationDate(s.ctx, sqlc.UpdateExpirationDateParams{
+			Shortened: shortenedURL,
+			ExpiredAt: pgtype.Timestamptz{Time: url.ExpiredAt, Valid: !patch.NeverExpires},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to update expiration date: %v", err)
+		}
+	}
+	if patch.RedirectStatus != nil || patch.MaxClicks != nil || patch.Password != nil || patch.Title != nil {
+		err = queries.UpdateURLSettings(s.ctx, sqlc.UpdateURLSettingsParams{
+			Shortened:      shortenedURL,
+			RedirectStatus: int32(url.RedirectStatus),
+			MaxClicks:      url.MaxClicks,
+			PasswordHash:   url.PasswordHash,
+			Title:          url.Title,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to update settings: %v", err)
 		}
 	}
 
-	go func() {
-		if err := s.postgresClient.Queries.IncrementClicks(s.ctx, shortenedURL); err != nil {
-			log.Errorf("Failed to increment clicks in database for %s: %v", shortenedURL, err)
-			s.errorChan <- fmt.Errorf("DB click increment failed for %s: %w", shortenedURL, err)
+	if err := tx.Commit(s.ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit link update: %v", err)
+	}
+
+	return s.refreshCache(shortenedURL)
+}
+
+// refreshCache reloads a link from Postgres into the shared cache after a
+// change, so every instance sees it at once.
+func (s *UrlService) refreshCache(shortenedURL string) (*CachedURL, error) {
+	updated, err := s.getFromDB(shortenedURL)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.setCache(shortenedURL, updated); err != nil {
+		// A stale entry would keep serving the old settings; drop it instead.
+		if err := s.redisClient.Del(s.ctx, shortenedURL).Err(); err != nil {
+			return nil, fmt.Errorf("failed to invalidate cache: %v", err)
 		}
-	}()
+	}
 
-	return updatedURL, nil
+	return updated, nil
 }
 
-func (s *UrlService) DeleteURL(shortenedURL string) error {
-	go func() {
-		if err := s.postgresClient.Queries.DeleteURL(s.ctx, shortenedURL); err != nil {
-			log.Errorf("failed to delete URL from database: %v", err)
+// UpdateExpiration moves a link's expiry. A zero expiresAt with never=true
+// makes it permanent.
+func (s *UrlService) UpdateExpiration(shortenedURL string, userIDStr string, expiresAt time.Time, never bool) error {
+	_, err := s.EditURL(shortenedURL, userIDStr, URLPatch{ExpiresAt: expiresAt, NeverExpires: never})
+	return err
+}
+
+// editableURL loads a link for a mutation by userIDStr: personal links only
+// by their creator, workspace links by the workspace's owners and editors.
+// Expired links are included so they can still be revived before the
+// cleanup cron runs.
+func (s *UrlService) editableURL(shortenedURL string, userIDStr string) (*CachedURL, error) {
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return nil, ErrInvalidUserID
+	}
+
+	url, err := s.lookupURL(shortenedURL)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrURLNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := s.authorizeLink(url, userID, RoleEditor); err != nil {
+		return nil, err
+	}
+	if url.Pending {
+		// The cached entry may predate the batch insert; Postgres decides.
+		url, err = s.refreshCache(shortenedURL)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrURLPending
 		}
-	}()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return url, nil
+}
+
+// CountClick takes a click by a person. It enforces the link's click limit,
+// failing with ErrClickLimitReached once the limit is used up and retiring
+// the link on its last allowed click. With analytics on it also counts the
+// click, unless the client hits the link more often than a person plausibly
+// does, as link checkers and scripts do; such a click is reported as a
+// repeat and left to be recorded as a bot click.
+//
+// The limit, the repeat check and the flusher's mark go to Redis in one
+// pipeline; the click count follows only when the click is kept.
+func (s *UrlService) CountClick(shortenedURL string, url *CachedURL, clientIP string, analytics bool) (bool, error) {
+	pipe := s.redisClient.Pipeline()
+	var consumed, hits *redis.Cmd
+	var mark *redis.IntCmd
+	if url.MaxClicks > 0 {
+		consumed = consumeClickScript.Eval(s.ctx, pipe, []string{clickCounterKey(shortenedURL)}, url.Clicks)
+	}
+	if analytics {
+		hits = repeatHitScript.Eval(s.ctx, pipe, []string{"hits:" + shortenedURL + ":" + clientIP},
+			repeatHitWindow.Milliseconds())
+		mark = pipe.SAdd(s.ctx, clicksDirtyKey, shortenedURL)
+	}
+	if pipe.Len() == 0 {
+		return false, nil
+	}
+	// Errors are checked per command: only the click limit may fail the
+	// redirect.
+	pipe.Exec(s.ctx)
+
+	if consumed != nil {
+		clicks, err := consumed.Int64()
+		if err != nil {
+			return false, fmt.Errorf("failed to consume click: %v", err)
+		}
+		if clicks > url.MaxClicks {
+			return false, ErrClickLimitReached
+		}
+		if clicks == url.MaxClicks {
+			s.retireURL(shortenedURL)
+		}
+	}
+
+	if !analytics {
+		return false, nil
+	}
+	if n, err := hits.Int64(); err != nil {
+		log.Errorf("Failed to count repeat hits on %s: %v", shortenedURL, err)
+	} else if n > repeatHitLimit {
+		return true, nil
+	}
+	s.incrementClicks(shortenedURL, mark.Err() == nil)
+	return false, nil
+}
 
+// retireURL expires a link now so every instance and the cleanup cron treat
+// it as gone. The click counter key stays behind to keep rejecting clicks
+// until then.
+func (s *UrlService) retireURL(shortenedURL string) {
+	err := s.postgresClient.Queries.UpdateExpirationDate(s.ctx, sqlc.UpdateExpirationDateParams{
+		Shortened: shortenedURL,
+		ExpiredAt: pgtype.Timestamptz{Time: time.Now(), Valid: true},
+	})
+	if err != nil {
+		s.errorChan <- fmt.Errorf("failed to retire %s: %w", shortenedURL, err)
+	}
 	if err := s.redisClient.Del(s.ctx, shortenedURL).Err(); err != nil {
-		return fmt.Errorf("failed to delete URL from cache: %v", err)
+		s.errorChan <- fmt.Errorf("failed to drop retired %s from cache: %w", shortenedURL, err)
 	}
+}
 
-	return nil
+func clickCounterKey(shortenedURL string) string {
+	return "clicks:" + shortenedURL
+}
+
+// pendingClicksKey holds clicks not yet written to Postgres.
+func pendingClicksKey(shortenedURL string) string {
+	return "pending_clicks:" + shortenedURL
 }
 
-func (s *UrlService) GetURLs(userId string) []CachedURL {
-	userID, err := uuid.Parse(userId)
+// incrementClicks counts a click with an atomic INCR shared by every
+// instance. The flusher moves the accumulated counts to Postgres in batches
+// and finds them by the link's mark.
+//
+// The two keys live in different slots, so the link is marked before the
+// count is taken: a count is never left without a mark. A fresh count may
+// follow a flush that popped the mark, so it marks the link again, as it
+// does when the earlier mark failed.
+func (s *UrlService) incrementClicks(shortenedURL string, marked bool) {
+	count, err := s.redisClient.Incr(s.ctx, pendingClicksKey(shortenedURL)).Result()
 	if err != nil {
-		log.Errorf("Failed to parse user ID: %v", err)
-		return []CachedURL{}
+		log.Errorf("Failed to count click for %s: %v", shortenedURL, err)
+		return
 	}
+	if count == 1 || !marked {
+		if err := s.redisClient.SAdd(s.ctx, clicksDirtyKey, shortenedURL).Err(); err != nil {
+			log.Errorf("Failed to mark %s as clicked: %v", shortenedURL, err)
+		}
+	}
+}
 
-	urls, err := s.postgresClient.Queries.GetURLsByUser(s.ctx, utils.ConvertFromUuidPg(userID))
+// DeleteURL removes a link editable by userIDStr together with its click
+// history, visitor sketches and everything derived from it in Redis.
+func (s *UrlService) DeleteURL(shortenedURL string, userIDStr string) error {
+	url, err := s.editableURL(shortenedURL, userIDStr)
 	if err != nil {
-		log.Errorf("Failed to get URLs by user: %v", err)
-		return []CachedURL{}
+		return err
 	}
 
-	var response []CachedURL
-	for _, url := range urls {
-		response = append(response, CachedURL{
-			Original:  url.Original,
-			Clicks:    int(url.Clicks.Int64),
-			CreatedAt: url.CreatedAt.Time,
-			ExpiredAt: url.ExpiredAt.Time,
-		})
+	// The row is keyed by its creator, who is not necessarily the caller for
+	// workspace links.
+	deleted, err := s.postgresClient.Queries.DeleteUserURL(s.ctx, sqlc.DeleteUserURLParams{
+		Shortened: shortenedURL,
+		UserID:    utils.ConvertFromUuidPg(uuid.MustParse(url.UserID)),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete URL from database: %v", err)
+	}
+	if deleted == 0 {
+		return ErrURLNotFound
+	}
+	// Statistics are keyed by code; a link reusing it must start from zero.
+	if err := s.postgresClient.Queries.DeleteClickHistory(s.ctx, []string{shortenedURL}); err != nil {
+		return fmt.Errorf("failed to delete click history: %v", err)
+	}
+	if err := s.dropVisitorSketches([]string{shortenedURL}); err != nil {
+		return err
 	}
 
-	return response
+	return s.dropDerivedState(shortenedURL)
+}
+
+// dropDerivedState deletes the cache entry and every other Redis key kept
+// for a link. Keys live in different cluster slots, so they are deleted one
+// by one.
+func (s *UrlService) dropDerivedState(shortenedURL string) error {
+	for _, key := range []string{shortenedURL, clickCounterKey(shortenedURL), pendingClicksKey(shortenedURL), "reserved:" + shortenedURL} {
+		if err := s.redisClient.Del(s.ctx, key).Err(); err != nil {
+			return fmt.Errorf("failed to delete %s from cache: %v", key, err)
+		}
+	}
+	return nil
 }
 
 func (s *UrlService) DeleteExpiredURLs() error {
@@ -294,12 +887,23 @@ func (s *UrlService) DeleteExpiredURLs() error {
 		}
 		batch := expiredUrls[i:end]
 
+		codes := make([]string, len(batch))
+		for j, url := range batch {
+			codes[j] = url.Shortened
+		}
+		if err := s.postgresClient.Queries.DeleteClickHistory(s.ctx, codes); err != nil {
+			return fmt.Errorf("failed to delete click history of expired URLs: %w", err)
+		}
+		if err := s.dropVisitorSketches(codes); err != nil {
+			return fmt.Errorf("failed to drop visitors of expired URLs: %w", err)
+		}
+
 		var wg sync.WaitGroup
 		for _, url := range batch {
 			wg.Add(1)
 			go func(shortened string) {
 				defer wg.Done()
-				if err := s.redisClient.Del(s.ctx, shortened).Err(); err != nil {
+				if err := s.dropDerivedState(shortened); err != nil {
 					s.errorChan <- fmt.Errorf("failed to delete from cache: %s: %w", shortened, err)
 				}
 			}(url.Shortened)
@@ -331,7 +935,7 @@ func (s *UrlService) getFromCache(shortenedURL string) (*CachedURL, error) {
 func (s *UrlService) getFromDB(shortenedURL string) (*CachedURL, error) {
 	url, err := s.postgresClient.Queries.GetOriginated(s.ctx, shortenedURL)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get URL from database: %v", err)
+		return nil, fmt.Errorf("failed to get URL from database: %w", err)
 	}
 
 	var userIDStr string
@@ -342,55 +946,164 @@ func (s *UrlService) getFromDB(shortenedURL string) (*CachedURL, error) {
 		}
 		userIDStr = userUUID.String()
 	}
+	var workspaceIDStr string
+	if url.WorkspaceID.Valid {
+		workspaceIDStr = utils.ConvertFromPgUuid(url.WorkspaceID).String()
+	}
 
 	return &CachedURL{
-		Original:  url.Original,
-		Clicks:    int(url.Clicks.Int64),
-		CreatedAt: url.CreatedAt.Time,
-		ExpiredAt: url.ExpiredAt.Time,
-		UserID:    userIDStr,
+		Original:       url.Original,
+		Clicks:         int(url.Clicks.Int64),
+		CreatedAt:      url.CreatedAt.Time,
+		ExpiredAt:      url.ExpiredAt.Time,
+		UserID:         userIDStr,
+		RedirectStatus: int(url.RedirectStatus),
+		MaxClicks:      url.MaxClicks,
+		PasswordHash:   url.PasswordHash,
+		Title:          url.Title,
+		WorkspaceID:    workspaceIDStr,
 	}, nil
 }
 func (s *UrlService) setCache(shortenedURL string, url *CachedURL) error {
+	ttl := s.cacheTTL(url)
+	if ttl <= 0 {
+		return s.redisClient.Del(s.ctx, shortenedURL).Err()
+	}
+
 	data, err := json.Marshal(url)
 	if err != nil {
 		return err
 	}
-	return s.redisClient.Set(s.ctx, shortenedURL, data, s.cacheTimeout).Err()
+	return s.redisClient.Set(s.ctx, shortenedURL, data, ttl).Err()
+}
+
+// cacheTTL keeps a cache entry from outliving the link it describes.
+func (s *UrlService) cacheTTL(url *CachedURL) time.Duration {
+	if url.ExpiredAt.IsZero() {
+		return s.cacheTimeout
+	}
+	return min(s.cacheTimeout, time.Until(url.ExpiredAt))
 }
 
-func (s *UrlService) StartCacheSyncWorker(interval time.Duration) {
+// StartClickFlusher writes pending click counts to Postgres every interval.
+func (s *UrlService) StartClickFlusher(interval time.Duration) {
 	go func() {
 		ticker := time.NewTicker(interval)
 		defer ticker.Stop()
 
 		for range ticker.C {
-			s.syncCacheWithDB()
+			if err := s.FlushClicks(); err != nil {
+				log.Error(err)
+			}
 		}
 	}()
 }
 
-func (s *UrlService) syncCacheWithDB() {
-	keys, err := s.redisClient.Keys(s.ctx, "*").Result()
-	if err != nil {
-		log.Errorf("Failed to get keys from Redis: %v", err)
-		return
+// FlushClicks moves the pending clicks of every link clicked since the last
+// flush into urls.clicks, one UPDATE per batch of links. SPOP hands each
+// link to a single instance and GETDEL takes its count atomically, so
+// concurrent clicks and flushers never lose or double count. Counts whose
+// update failed, or whose link is still queued for insert, are put back for
+// the next flush.
+func (s *UrlService) FlushClicks() error {
+	for {
+		codes, err := s.redisClient.SPopN(s.ctx, clicksDirtyKey, clickFlushBatch).Result()
+		if err != nil {
+			return fmt.Errorf("failed to list clicked URLs: %v", err)
+		}
+		if len(codes) == 0 {
+			return nil
+		}
+		// Updating rows in a stable order keeps concurrent flushes from
+		// deadlocking.
+		sort.Strings(codes)
+
+		pipe := s.redisClient.Pipeline()
+		pending := make([]*redis.StringCmd, len(codes))
+		for i, code := range codes {
+			pending[i] = pipe.GetDel(s.ctx, pendingClicksKey(code))
+		}
+		// Errors are checked per command: counts that were taken must be
+		// flushed even if another node failed.
+		pipe.Exec(s.ctx)
+
+		params := sqlc.AddClicksParams{}
+		var failed []string
+		for i, code := range codes {
+			delta, err := pending[i].Int64()
+			if errors.Is(err, redis.Nil) || (err == nil && delta == 0) {
+				continue
+			}
+			if err != nil {
+				failed = append(failed, code)
+				continue
+			}
+			params.Codes = append(params.Codes, code)
+			params.Deltas = append(params.Deltas, delta)
+		}
+
+		if len(params.Codes) > 0 {
+			updated, err := s.postgresClient.Queries.AddClicks(s.ctx, params)
+			if err != nil {
+				s.restorePendingClicks(params)
+				return fmt.Errorf("failed to flush clicks of %d URLs: %v", len(params.Codes), err)
+			}
+			if len(updated) < len(params.Codes) {
+				s.requeueUnstoredClicks(params, updated)
+			}
+		}
+		if len(failed) > 0 {
+			s.redisClient.SAdd(s.ctx, clicksDirtyKey, failed)
+			return fmt.Errorf("failed to take pending clicks of %d URLs, retrying next flush", len(failed))
+		}
+		if len(codes) < clickFlushBatch {
+			return nil
+		}
 	}
+}
 
-	for _, key := range keys {
-		cachedURL, err := s.getFromCache(key)
-		if err != nil {
-			continue
+// requeueUnstoredClicks puts back the clicks of links whose row has not been
+// inserted yet. Their code reservation outlives the queued insert; links
+// without one were deleted and their clicks are dropped.
+func (s *UrlService) requeueUnstoredClicks(params sqlc.AddClicksParams, updated []string) {
+	stored := make(map[string]bool, len(updated))
+	for _, code := range updated {
+		stored[code] = true
+	}
+
+	pipe := s.redisClient.Pipeline()
+	reserved := make(map[int]*redis.IntCmd)
+	for i, code := range params.Codes {
+		if !stored[code] {
+			reserved[i] = pipe.Exists(s.ctx, "reserved:"+code)
 		}
+	}
+	if _, err := pipe.Exec(s.ctx); err != nil {
+		log.Errorf("Failed to look up reservations of %d unstored URLs: %v", len(reserved), err)
+		return
+	}
 
-		err = s.postgresClient.Queries.UpdateURL(s.ctx, sqlc.UpdateURLParams{
-			Shortened: key,
-			Clicks:    pgtype.Int8{Int64: int64(cachedURL.Clicks), Valid: true},
-		})
-		if err != nil {
-			log.Errorf("Failed to sync URL %s to database: %v", key, err)
+	requeue := sqlc.AddClicksParams{}
+	for i, exists := range reserved {
+		if exists.Val() > 0 {
+			requeue.Codes = append(requeue.Codes, params.Codes[i])
+			requeue.Deltas = append(requeue.Deltas, params.Deltas[i])
 		}
 	}
+	if len(requeue.Codes) > 0 {
+		s.restorePendingClicks(requeue)
+	}
+}
+
+func (s *UrlService) restorePendingClicks(params sqlc.AddClicksParams) {
+	pipe := s.redisClient.Pipeline()
+	for i, code := range params.Codes {
+		pipe.IncrBy(s.ctx, pendingClicksKey(code), params.Deltas[i])
+		pipe.SAdd(s.ctx, clicksDirtyKey, code)
+	}
+	if _, err := pipe.Exec(s.ctx); err != nil {
+		log.Errorf("Failed to restore pending clicks of %d URLs: %v", len(params.Codes), err)
+	}
 }
 
 func (s *UrlService) handleErrors() {
@@ -0,0 +1,133 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"shorten-url/backend/pkg/db/sqlc"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func TestGetURLCachesDatabaseHits(t *testing.T) {
+	service, mr, _ := newTestService(t)
+	db := service.postgresClient.DB.(*fakeDB)
+	db.urls["abc"] = sqlc.Url{
+		Shortened: "abc",
+		Original:  "https://example.com/",
+		CreatedAt: pgtype.Timestamptz{Time: time.Now(), Valid: true},
+		ExpiredAt: pgtype.Timestamptz{Time: time.Now().Add(time.Hour), Valid: true},
+	}
+
+	if _, err := service.GetURL("abc"); err != nil {
+		t.Fatalf("GetURL: %v", err)
+	}
+	if !mr.Exists("abc") {
+		t.Fatal("a link read from Postgres was not cached")
+	}
+	if ttl := mr.TTL("abc"); ttl <= 0 || ttl > time.Hour {
+		t.Errorf("cache TTL = %v, want at most the hour left of the link", ttl)
+	}
+}
+
+func TestCountClickEnforcesLimit(t *testing.T) {
+	service, mr, _ := newTestService(t)
+	url := &CachedURL{Original: "https://example.com/", CreatedAt: time.Now(), ExpiredAt: time.Now().Add(time.Hour), MaxClicks: 3}
+
+	tests := []struct {
+		name    string
+		wantErr error
+	}{
+		{"first click", nil},
+		{"second click", nil},
+		{"last allowed click", nil},
+		{"click over the limit", ErrClickLimitReached},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := service.CountClick("limited", url, "203.0.113.1", false); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("CountClick error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	// An evicted counter would be reseeded from a stale count.
+	if ttl := mr.TTL(clickCounterKey("limited")); ttl != 0 {
+		t.Errorf("click counter TTL = %v, want none", ttl)
+	}
+	if mr.Exists(pendingClicksKey("limited")) {
+		t.Error("clicks were counted with analytics off")
+	}
+}
+
+func TestCountClickFlagsRepeatHits(t *testing.T) {
+	service, mr, _ := newTestService(t)
+	url := &CachedURL{Original: "https://example.com/", CreatedAt: time.Now()}
+
+	for i := 1; i <= repeatHitLimit+2; i++ {
+		repeat, err := service.CountClick("popular", url, "203.0.113.1", true)
+		if err != nil {
+			t.Fatalf("CountClick: %v", err)
+		}
+		if want := i > repeatHitLimit; repeat != want {
+			t.Errorf("hit %d: repeat = %v, want %v", i, repeat, want)
+		}
+	}
+	if repeat, _ := service.CountClick("popular", url, "198.51.100.7", true); repeat {
+		t.Error("another client's first hit was flagged as a repeat")
+	}
+
+	if pending, _ := mr.Get(pendingClicksKey("popular")); pending != strconv.Itoa(repeatHitLimit+1) {
+		t.Errorf("pending clicks = %s, want %d", pending, repeatHitLimit+1)
+	}
+	if marked, _ := mr.SIsMember(clicksDirtyKey, "popular"); !marked {
+		t.Error("link with pending clicks is not marked for the flusher")
+	}
+}
+
+func TestStoreBatchSetsAsideRejectedLinks(t *testing.T) {
+	service, mr, _ := newTestService(t)
+	db := service.postgresClient.DB.(*fakeDB)
+
+	userID := uuid.NewString()
+	batch := []URLMessage{
+		{Shortened: "ok1", OriginalURL: "https://example.com/1", UserID: userID},
+		{Shortened: "baduser", OriginalURL: "https://example.com/2", UserID: "not-a-uuid"},
+		{Shortened: "long", OriginalURL: "https://example.com/" + strings.Repeat("a", 250), UserID: userID},
+		{Shortened: "badteam", OriginalURL: "https://example.com/3", UserID: userID, WorkspaceID: "team"},
+		{Shortened: "ok2", OriginalURL: "https://example.com/4", UserID: userID},
+	}
+	for _, message := range batch {
+		mr.Set(message.Shortened, `{"pending":true}`)
+	}
+
+	errs := service.storeBatch(batch)
+	for i, message := range batch {
+		stored := message.Shortened == "ok1" || message.Shortened == "ok2"
+		if stored != (errs[i] == nil) || !stored && !isRejected(errs[i]) {
+			t.Errorf("%s: error = %v, want stored %v or a rejection", message.Shortened, errs[i], stored)
+		}
+		if _, ok := db.urls[message.Shortened]; ok != stored {
+			t.Errorf("%s: in database = %v, want %v", message.Shortened, ok, stored)
+		}
+	}
+	if mr.Exists("ok1") || mr.Exists("ok2") {
+		t.Error("stored links kept their pending cache entries")
+	}
+}
+
+func TestIsRejected(t *testing.T) {
+	if isRejected(fmt.Errorf("failed to connect: %w", context.DeadlineExceeded)) {
+		t.Error("a connection error was treated as a rejected link")
+	}
+	if !isRejected(&pgconn.PgError{Code: "22001"}) {
+		t.Error("a database error was not treated as a rejected link")
+	}
+}
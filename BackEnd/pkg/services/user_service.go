@@ -2,16 +2,57 @@ package services
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	netmail "net/mail"
+	"shorten-url/backend/pkg/db/sqlc"
+	"shorten-url/backend/pkg/mail"
 	"shorten-url/backend/pkg/utils"
+	"strings"
+	"time"
+
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/redis/go-redis/v9"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	minAccountPassword = 8
+	maxEmailLength     = 254
+	passwordResetTTL   = time.Hour
 )
 
+var (
+	ErrInvalidEmail       = errors.New("invalid email address")
+	ErrEmailTaken         = errors.New("email is already registered")
+	ErrWeakPassword       = errors.New("password must be between 8 and 72 bytes")
+	ErrInvalidCredentials = errors.New("invalid email or password")
+	ErrInvalidResetToken  = errors.New("invalid or expired password reset token")
+	ErrUserExists         = errors.New("user already exists")
+	ErrUserNotClaimable   = errors.New("user does not exist or has already been claimed")
+)
+
+// Compared against when the email is unknown, so a failed login takes as
+// long whether or not the account exists.
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+
+// User is the public view of an account. Anonymous users created through
+// POST /users have no email.
 type User struct {
-	UserID string `json:"userId"`
+	UserID    string     `json:"userId"`
+	Email     string     `json:"email,omitempty"`
+	CreatedAt *time.Time `json:"createdAt,omitempty"`
 }
 
-
+// CreateUser registers an anonymous user. An existing userId is refused with
+// ErrUserExists: knowing an id proves nothing, so users from before API keys
+// existed get their first key through ClaimLegacyUser instead.
 func (s *UrlService) CreateUser(userIDStr string) error {
 	userID, err := uuid.Parse(userIDStr)
 	if err != nil {
@@ -19,6 +60,10 @@ func (s *UrlService) CreateUser(userIDStr string) error {
 	}
 	err = s.postgresClient.Queries.InsertUser(context.Background(), utils.ConvertFromUuidPg(userID))
 
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return ErrUserExists
+	}
 	if err != nil {
 		return fmt.Errorf(err.Error())
 	}
@@ -26,3 +71,206 @@ func (s *UrlService) CreateUser(userIDStr string) error {
 	return nil
 }
 
+func (s *UrlService) GetUser(userIDStr string) (*User, error) {
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return nil, ErrInvalidUserID
+	}
+
+	user, err := s.postgresClient.Queries.GetUser(s.ctx, utils.ConvertFromUuidPg(userID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %v", err)
+	}
+
+	return &User{
+		UserID:    userID.String(),
+		Email:     user.Email.String,
+		CreatedAt: &user.CreatedAt.Time,
+	}, nil
+}
+
+// SignUp creates an account with an email and password and logs it in.
+func (s *UrlService) SignUp(email string, password string) (*User, *SessionTokens, error) {
+	email, err := normalizeEmail(email)
+	if err != nil {
+		return nil, nil, err
+	}
+	passwordHash, err := hashAccountPassword(password)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	userID := uuid.New()
+	tx, err := s.postgresClient.DB.Begin(s.ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback(s.ctx)
+	queries := s.postgresClient.Queries.WithTx(tx)
+
+	err = queries.InsertAccount(s.ctx, sqlc.InsertAccountParams{
+		UserID:       utils.ConvertFromUuidPg(userID),
+		Email:        pgtype.Text{String: email, Valid: true},
+		PasswordHash: passwordHash,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create account: %v", err)
+	}
+	err = queries.InsertUserEmail(s.ctx, sqlc.InsertUserEmailParams{
+		Email:  email,
+		UserID: utils.ConvertFromUuidPg(userID),
+	})
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return nil, nil, ErrEmailTaken
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to register email: %v", err)
+	}
+
+	if err := tx.Commit(s.ctx); err != nil {
+		return nil, nil, fmt.Errorf("failed to commit account: %v", err)
+	}
+
+	tokens, err := s.startSession(userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	return &User{UserID: userID.String(), Email: email, CreatedAt: &now}, tokens, nil
+}
+
+// Login checks an email and password and starts a new session.
+func (s *UrlService) Login(email string, password string) (*SessionTokens, error) {
+	email, err := normalizeEmail(email)
+	if err != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	user, err := s.postgresClient.Queries.GetUserByEmail(s.ctx, email)
+	if errors.Is(err, pgx.ErrNoRows) {
+		bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up account: %v", err)
+	}
+	if user.PasswordHash == "" || bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	return s.startSession(utils.ConvertFromPgUuid(user.UserID))
+}
+
+// RequestPasswordReset mails a single-use reset link to the account. Unknown
+// emails are ignored without an error so callers cannot probe for accounts.
+func (s *UrlService) RequestPasswordReset(email string) error {
+	email, err := normalizeEmail(email)
+	if err != nil {
+		return ErrInvalidEmail
+	}
+
+	user, err := s.postgresClient.Queries.GetUserByEmail(s.ctx, email)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to look up account: %v", err)
+	}
+
+	token, err := randomToken("pr_")
+	if err != nil {
+		return err
+	}
+	userID := utils.ConvertFromPgUuid(user.UserID).String()
+	if err := s.redisClient.Set(s.ctx, passwordResetKey(token), userID, passwordResetTTL).Err(); err != nil {
+		return fmt.Errorf("failed to store password reset token: %v", err)
+	}
+
+	return s.mailSender.Send(mail.Message{
+		To:      email,
+		Subject: "Reset your password",
+		Body: "Someone asked to reset the password of your account. If it was you, open the link below within an hour:\n\n" +
+			s.passwordResetURL + token + "\n\nOtherwise you can ignore this message.\n",
+	})
+}
+
+// ResetPassword sets a new password with a token from RequestPasswordReset
+// and signs the account out everywhere.
+func (s *UrlService) ResetPassword(token string, password string) error {
+	passwordHash, err := hashAccountPassword(password)
+	if err != nil {
+		return err
+	}
+
+	userIDStr, err := s.redisClient.GetDel(s.ctx, passwordResetKey(token)).Result()
+	if errors.Is(err, redis.Nil) {
+		return ErrInvalidResetToken
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read password reset token: %v", err)
+	}
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return ErrInvalidResetToken
+	}
+
+	err = s.postgresClient.Queries.UpdateUserPassword(s.ctx, sqlc.UpdateUserPasswordParams{
+		UserID:       utils.ConvertFromUuidPg(userID),
+		PasswordHash: passwordHash,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update password: %v", err)
+	}
+
+	if err := s.revokeAllSessions(userID); err != nil {
+		log.Errorf("Failed to revoke sessions of %s after a password reset: %v", userID, err)
+	}
+	return nil
+}
+
+// SetMailSender replaces the default LogSender. resetURL is the page that
+// accepts password reset tokens; the token is appended to it.
+func (s *UrlService) SetMailSender(sender mail.Sender, resetURL string) {
+	s.mailSender = sender
+	s.passwordResetURL = resetURL
+}
+
+func normalizeEmail(email string) (string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if email == "" || len(email) > maxEmailLength {
+		return "", ErrInvalidEmail
+	}
+	address, err := netmail.ParseAddress(email)
+	if err != nil || address.Address != email {
+		return "", ErrInvalidEmail
+	}
+	return email, nil
+}
+
+func hashAccountPassword(password string) (string, error) {
+	if len(password) < minAccountPassword || len(password) > 72 {
+		return "", ErrWeakPassword
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %v", err)
+	}
+	return string(hash), nil
+}
+
+func passwordResetKey(token string) string {
+	return "password_reset:" + hashToken(token)
+}
+
+// randomToken returns prefix followed by 32 random bytes, base64url encoded.
+func randomToken(prefix string) (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("failed to generate token: %v", err)
+	}
+	return prefix + base64.RawURLEncoding.EncodeToString(raw), nil
+}
@@ -0,0 +1,167 @@
+package services
+
+import (
+	"errors"
+	"shorten-url/backend/pkg/config"
+	"shorten-url/backend/pkg/db/sqlc"
+	"shorten-url/backend/pkg/mail"
+	"shorten-url/backend/pkg/stores"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+const testResetURL = "https://short.example/reset?token="
+
+// newTestService returns a UrlService backed by fakeDB and miniredis, which
+// answers CLUSTER SLOTS as a single-node cluster.
+func newTestService(t *testing.T) (*UrlService, *miniredis.Miniredis, *mail.FakeSender) {
+	t.Helper()
+	config.AppConfig.Server.TokenSecret = []byte("test secret")
+
+	mr := miniredis.RunT(t)
+	redisClient := redis.NewClusterClient(&redis.ClusterOptions{Addrs: []string{mr.Addr()}})
+	t.Cleanup(func() { redisClient.Close() })
+
+	db := newFakeDB()
+	service := NewUrlService(redisClient, &stores.Postgres{DB: db, Queries: sqlc.New(db)}, nil, nil)
+	sender := &mail.FakeSender{}
+	service.SetMailSender(sender, testResetURL)
+	return service, mr, sender
+}
+
+func TestSignUpStartsAVerifiableSession(t *testing.T) {
+	service, _, _ := newTestService(t)
+
+	user, tokens, err := service.SignUp(" Alice@Example.com ", "correct horse")
+	if err != nil {
+		t.Fatalf("SignUp: %v", err)
+	}
+	if user.Email != "alice@example.com" {
+		t.Errorf("email = %q, want it normalized", user.Email)
+	}
+
+	userID, sessionID, err := service.AuthenticateSession(tokens.AccessToken)
+	if err != nil {
+		t.Fatalf("AuthenticateSession: %v", err)
+	}
+	if userID != user.UserID || sessionID == "" {
+		t.Errorf("session = (%q, %q), want user %q", userID, sessionID, user.UserID)
+	}
+
+	if _, _, err := service.SignUp("alice@example.com", "another password"); !errors.Is(err, ErrEmailTaken) {
+		t.Errorf("second SignUp error = %v, want ErrEmailTaken", err)
+	}
+}
+
+func TestLogin(t *testing.T) {
+	service, _, _ := newTestService(t)
+	user, _, err := service.SignUp("bob@example.com", "correct horse")
+	if err != nil {
+		t.Fatalf("SignUp: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		email    string
+		password string
+		wantErr  error
+	}{
+		{"good credentials", "bob@example.com", "correct horse", nil},
+		{"email in another case", "BOB@example.com", "correct horse", nil},
+		{"wrong password", "bob@example.com", "battery staple", ErrInvalidCredentials},
+		{"unknown email", "carol@example.com", "correct horse", ErrInvalidCredentials},
+		{"malformed email", "bob", "correct horse", ErrInvalidCredentials},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens, err := service.Login(tt.email, tt.password)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Login error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			userID, _, err := service.AuthenticateSession(tokens.AccessToken)
+			if err != nil || userID != user.UserID {
+				t.Errorf("AuthenticateSession = (%q, %v), want %q", userID, err, user.UserID)
+			}
+		})
+	}
+}
+
+func TestPasswordResetTokenIsSingleUse(t *testing.T) {
+	service, _, sender := newTestService(t)
+	_, session, err := service.SignUp("dave@example.com", "old password")
+	if err != nil {
+		t.Fatalf("SignUp: %v", err)
+	}
+
+	token := requestResetToken(t, service, sender, "dave@example.com")
+	if err := service.ResetPassword(token, "new password"); err != nil {
+		t.Fatalf("ResetPassword: %v", err)
+	}
+	if err := service.ResetPassword(token, "newer password"); !errors.Is(err, ErrInvalidResetToken) {
+		t.Errorf("reused token error = %v, want ErrInvalidResetToken", err)
+	}
+
+	if _, err := service.Login("dave@example.com", "old password"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("login with the old password error = %v, want ErrInvalidCredentials", err)
+	}
+	if _, err := service.Login("dave@example.com", "new password"); err != nil {
+		t.Errorf("login with the new password: %v", err)
+	}
+	// A reset signs the account out everywhere.
+	if _, _, err := service.AuthenticateSession(session.AccessToken); !errors.Is(err, ErrInvalidSession) {
+		t.Errorf("old session error = %v, want ErrInvalidSession", err)
+	}
+}
+
+func TestPasswordResetTokenExpires(t *testing.T) {
+	service, mr, sender := newTestService(t)
+	if _, _, err := service.SignUp("erin@example.com", "old password"); err != nil {
+		t.Fatalf("SignUp: %v", err)
+	}
+
+	token := requestResetToken(t, service, sender, "erin@example.com")
+	mr.FastForward(passwordResetTTL + time.Second)
+	if err := service.ResetPassword(token, "new password"); !errors.Is(err, ErrInvalidResetToken) {
+		t.Errorf("expired token error = %v, want ErrInvalidResetToken", err)
+	}
+}
+
+func TestPasswordResetIgnoresUnknownEmail(t *testing.T) {
+	service, _, sender := newTestService(t)
+
+	if err := service.RequestPasswordReset("nobody@example.com"); err != nil {
+		t.Fatalf("RequestPasswordReset: %v", err)
+	}
+	if sent := sender.Sent(); len(sent) != 0 {
+		t.Errorf("sent %d messages for an unknown email", len(sent))
+	}
+	if err := service.ResetPassword("pr_made-up", "new password"); !errors.Is(err, ErrInvalidResetToken) {
+		t.Errorf("made-up token error = %v, want ErrInvalidResetToken", err)
+	}
+}
+
+// requestResetToken asks for a reset link and returns the token from the
+// mail it produced.
+func requestResetToken(t *testing.T, service *UrlService, sender *mail.FakeSender, email string) string {
+	t.Helper()
+	if err := service.RequestPasswordReset(email); err != nil {
+		t.Fatalf("RequestPasswordReset: %v", err)
+	}
+	sent := sender.Sent()
+	if len(sent) == 0 || sent[len(sent)-1].To != email {
+		t.Fatalf("no reset mail sent to %s", email)
+	}
+	_, rest, ok := strings.Cut(sent[len(sent)-1].Body, testResetURL)
+	if !ok {
+		t.Fatalf("reset mail has no link: %q", sent[len(sent)-1].Body)
+	}
+	return strings.Fields(rest)[0]
+}
@@ -0,0 +1,273 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"shorten-url/backend/pkg/db/sqlc"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/redis/go-redis/v9"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// Sketches are copied to Postgres well within this, so an evicted or
+	// expired one is restored rather than lost.
+	visitorSketchTTL = 7 * 24 * time.Hour
+	// Sketches changed since the last persist run, as their Redis keys.
+	visitorsDirtyKey = "visitors:dirty"
+	// Lifetime sketch of a link, next to the daily ones.
+	visitorTotalPeriod = "total"
+
+	visitorPersistBatch = 500
+)
+
+// visitorKey is the HyperLogLog of one link and period. The hash tag keeps
+// every period of a link in one cluster slot, so PFCOUNT can merge days.
+func visitorKey(shortenedURL string, period string) string {
+	return "visitors:{" + shortenedURL + "}:" + period
+}
+
+func parseVisitorKey(key string) (string, string, bool) {
+	rest, ok := strings.CutPrefix(key, "visitors:{")
+	if !ok {
+		return "", "", false
+	}
+	return strings.Cut(rest, "}:")
+}
+
+func visitorDay(t time.Time) string {
+	return t.UTC().Format(time.DateOnly)
+}
+
+// recordVisitor adds the click's visitor to the daily and lifetime sketches
+// of its link. Bots are not visitors.
+func (s *UrlService) recordVisitor(event ClickEvent) error {
+	if event.Visitor == "" || event.Bot {
+		return nil
+	}
+	dayKey := visitorKey(event.Shortened, visitorDay(event.ClickedAt))
+	totalKey := visitorKey(event.Shortened, visitorTotalPeriod)
+
+	pipe := s.redisClient.Pipeline()
+	pipe.PFAdd(s.ctx, dayKey, event.Visitor)
+	pipe.Expire(s.ctx, dayKey, visitorSketchTTL)
+	pipe.PFAdd(s.ctx, totalKey, event.Visitor)
+	pipe.Expire(s.ctx, totalKey, visitorSketchTTL)
+	pipe.SAdd(s.ctx, visitorsDirtyKey, dayKey, totalKey)
+	_, err := pipe.Exec(s.ctx)
+	return err
+}
+
+// PersistVisitorSketches copies every sketch changed since the last run to
+// Postgres. A sketch that failed is marked dirty again for the next run.
+func (s *UrlService) PersistVisitorSketches() error {
+	for {
+		keys, err := s.redisClient.SPopN(s.ctx, visitorsDirtyKey, visitorPersistBatch).Result()
+		if err != nil {
+			return fmt.Errorf("failed to list changed visitor sketches: %v", err)
+		}
+		if len(keys) == 0 {
+			return nil
+		}
+
+		for _, key := range keys {
+			if err := s.persistVisitorSketch(key); err != nil {
+				log.Errorf("Failed to persist visitor sketch %s: %v", key, err)
+				s.redisClient.SAdd(s.ctx, visitorsDirtyKey, key)
+			}
+		}
+		if len(keys) < visitorPersistBatch {
+			return nil
+		}
+	}
+}
+
+func (s *UrlService) persistVisitorSketch(key string) error {
+	shortenedURL, period, ok := parseVisitorKey(key)
+	if !ok {
+		return nil
+	}
+
+	// A sketch recreated after eviction holds only the newest visitors;
+	// merging in the stored one first keeps the older ones. Merging is a
+	// union, so doing it twice is harmless.
+	stored, err := s.postgresClient.Queries.GetVisitorSketch(s.ctx, sqlc.GetVisitorSketchParams{
+		Shortened: shortenedURL,
+		Period:    period,
+	})
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return err
+	}
+	if err == nil {
+		if err := s.restoreVisitorSketch(key, stored); err != nil {
+			return err
+		}
+	}
+
+	sketch, err := s.redisClient.Get(s.ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return s.postgresClient.Queries.UpsertVisitorSketch(s.ctx, sqlc.UpsertVisitorSketchParams{
+		Shortened: shortenedURL,
+		Period:    period,
+		Sketch:    sketch,
+	})
+}
+
+// restoreVisitorSketch merges a persisted sketch into its Redis key through
+// a scratch key in the same slot.
+func (s *UrlService) restoreVisitorSketch(key string, sketch []byte) error {
+	shortenedURL, _, _ := parseVisitorKey(key)
+	scratch := visitorKey(shortenedURL, "restore:"+uuid.NewString())
+
+	pipe := s.redisClient.Pipeline()
+	pipe.Set(s.ctx, scratch, sketch, time.Minute)
+	pipe.PFMerge(s.ctx, key, scratch)
+	pipe.Del(s.ctx, scratch)
+	pipe.Expire(s.ctx, key, visitorSketchTTL)
+	_, err := pipe.Exec(s.ctx)
+	return err
+}
+
+// dropVisitorSketches deletes every sketch of the given links from Postgres
+// and Redis. A link's sketches share its hash tag, so one node holds them all.
+func (s *UrlService) dropVisitorSketches(shortenedURLs []string) error {
+	if err := s.postgresClient.Queries.DeleteVisitorSketches(s.ctx, shortenedURLs); err != nil {
+		return fmt.Errorf("failed to delete visitor sketches: %v", err)
+	}
+
+	for _, shortenedURL := range shortenedURLs {
+		node, err := s.redisClient.MasterForKey(s.ctx, visitorKey(shortenedURL, visitorTotalPeriod))
+		if err != nil {
+			return fmt.Errorf("failed to locate visitor sketches of %s: %v", shortenedURL, err)
+		}
+		var keys []string
+		iter := node.Scan(s.ctx, 0, visitorKey(shortenedURL, "*"), visitorPersistBatch).Iterator()
+		for iter.Next(s.ctx) {
+			keys = append(keys, iter.Val())
+		}
+		if err := iter.Err(); err != nil {
+			return fmt.Errorf("failed to list visitor sketches of %s: %v", shortenedURL, err)
+		}
+		if len(keys) == 0 {
+			continue
+		}
+		if err := node.Del(s.ctx, keys...).Err(); err != nil {
+			return fmt.Errorf("failed to delete visitor sketches of %s: %v", shortenedURL, err)
+		}
+	}
+	return nil
+}
+
+// loadVisitorSketches makes sure the given sketches are in Redis, restoring
+// the ones that were evicted from Postgres, and returns the keys of the
+// sketches that exist.
+func (s *UrlService) loadVisitorSketches(shortenedURLs []string, periods []string) ([]string, error) {
+	var keys []string
+	for _, shortenedURL := range shortenedURLs {
+		for _, period := range periods {
+			keys = append(keys, visitorKey(shortenedURL, period))
+		}
+	}
+
+	pipe := s.redisClient.Pipeline()
+	exists := make([]*redis.IntCmd, len(keys))
+	for i, key := range keys {
+		exists[i] = pipe.Exists(s.ctx, key)
+	}
+	if _, err := pipe.Exec(s.ctx); err != nil {
+		return nil, fmt.Errorf("failed to look up visitor sketches: %v", err)
+	}
+
+	present := make(map[string]bool, len(keys))
+	missing := false
+	for i, key := range keys {
+		present[key] = exists[i].Val() > 0
+		missing = missing || !present[key]
+	}
+	if missing {
+		rows, err := s.postgresClient.Queries.ListVisitorSketches(s.ctx, sqlc.ListVisitorSketchesParams{
+			Codes:   shortenedURLs,
+			Periods: periods,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to load visitor sketches: %v", err)
+		}
+		for _, row := range rows {
+			key := visitorKey(row.Shortened, row.Period)
+			if present[key] {
+				continue
+			}
+			if err := s.restoreVisitorSketch(key, row.Sketch); err != nil {
+				return nil, fmt.Errorf("failed to restore visitor sketch: %v", err)
+			}
+			present[key] = true
+		}
+	}
+
+	found := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if present[key] {
+			found = append(found, key)
+		}
+	}
+	return found, nil
+}
+
+// uniqueVisitorTotals returns the estimated lifetime unique visitors of each
+// link. Links nobody visited are left out.
+func (s *UrlService) uniqueVisitorTotals(shortenedURLs []string) (map[string]int64, error) {
+	totals := make(map[string]int64, len(shortenedURLs))
+	if len(shortenedURLs) == 0 {
+		return totals, nil
+	}
+	keys, err := s.loadVisitorSketches(shortenedURLs, []string{visitorTotalPeriod})
+	if err != nil {
+		return nil, err
+	}
+
+	pipe := s.redisClient.Pipeline()
+	counts := make([]*redis.IntCmd, len(keys))
+	for i, key := range keys {
+		counts[i] = pipe.PFCount(s.ctx, key)
+	}
+	if _, err := pipe.Exec(s.ctx); err != nil {
+		return nil, fmt.Errorf("failed to count unique visitors: %v", err)
+	}
+	for i, key := range keys {
+		shortenedURL, _, _ := parseVisitorKey(key)
+		totals[shortenedURL] = counts[i].Val()
+	}
+	return totals, nil
+}
+
+// uniqueVisitorsBetween estimates the unique visitors of a link over the UTC
+// days overlapping [from, to) by merging their daily sketches.
+func (s *UrlService) uniqueVisitorsBetween(shortenedURL string, from time.Time, to time.Time) (int64, error) {
+	var days []string
+	last := utcDay(to.Add(-time.Nanosecond))
+	for day := utcDay(from); !day.After(last); day = day.AddDate(0, 0, 1) {
+		days = append(days, visitorDay(day))
+	}
+
+	keys, err := s.loadVisitorSketches([]string{shortenedURL}, days)
+	if err != nil {
+		return 0, err
+	}
+	if len(keys) == 0 {
+		return 0, nil
+	}
+	count, err := s.redisClient.PFCount(s.ctx, keys...).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to count unique visitors: %v", err)
+	}
+	return count, nil
+}
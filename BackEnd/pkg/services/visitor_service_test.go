@@ -0,0 +1,84 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestParseVisitorKey(t *testing.T) {
+	tests := []struct {
+		key    string
+		code   string
+		period string
+		ok     bool
+	}{
+		{visitorKey("abc", "2026-10-18"), "abc", "2026-10-18", true},
+		{visitorKey("abc", visitorTotalPeriod), "abc", visitorTotalPeriod, true},
+		{"visitors:dirty", "", "", false},
+		{"visitors:{abc", "abc", "", false},
+		{"abc", "", "", false},
+	}
+	for _, tt := range tests {
+		code, period, ok := parseVisitorKey(tt.key)
+		if code != tt.code || period != tt.period || ok != tt.ok {
+			t.Errorf("parseVisitorKey(%q) = (%q, %q, %v), want (%q, %q, %v)", tt.key, code, period, ok, tt.code, tt.period, tt.ok)
+		}
+	}
+}
+
+func TestUniqueVisitorsBetween(t *testing.T) {
+	service, mr, _ := newTestService(t)
+	day := time.Date(2026, 10, 12, 15, 0, 0, 0, time.UTC)
+	// miniredis adds up PFCOUNT over several keys instead of merging them,
+	// so nobody comes back on a later day.
+	clicks := []ClickEvent{
+		{Visitor: "alice", ClickedAt: day},
+		{Visitor: "alice", ClickedAt: day.Add(time.Hour)},
+		{Visitor: "bob", ClickedAt: day.Add(time.Hour)},
+		{Visitor: "dave", ClickedAt: day.AddDate(0, 0, 1)},
+		{Visitor: "carol", ClickedAt: day.AddDate(0, 0, 2)},
+		{Visitor: "crawler", ClickedAt: day, Bot: true},
+		{ClickedAt: day},
+	}
+	for _, click := range clicks {
+		click.Shortened = "abc"
+		if err := service.recordVisitor(click); err != nil {
+			t.Fatalf("recordVisitor: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		from, to time.Time
+		want     int64
+	}{
+		{"first day", day, day.Add(time.Minute), 2},
+		{"two days", day, day.AddDate(0, 0, 1).Add(time.Minute), 3},
+		{"three days", day, day.AddDate(0, 0, 2).Add(time.Minute), 4},
+		{"second day only", day.AddDate(0, 0, 1), day.AddDate(0, 0, 1).Add(time.Minute), 1},
+		{"days without visitors", day.AddDate(0, 0, 5), day.AddDate(0, 0, 7), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := service.uniqueVisitorsBetween("abc", tt.from, tt.to)
+			if err != nil {
+				t.Fatalf("uniqueVisitorsBetween: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("uniqueVisitorsBetween = %d, want %d", got, tt.want)
+			}
+		})
+	}
+
+	totals, err := service.uniqueVisitorTotals([]string{"abc", "other"})
+	if err != nil {
+		t.Fatalf("uniqueVisitorTotals: %v", err)
+	}
+	if fmt.Sprint(totals) != "map[abc:4]" {
+		t.Errorf("uniqueVisitorTotals = %v, want map[abc:4]", totals)
+	}
+	if dirty, _ := mr.Members(visitorsDirtyKey); len(dirty) != 4 {
+		t.Errorf("dirty sketches = %v, want the total and three days", dirty)
+	}
+}
@@ -0,0 +1,305 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"shorten-url/backend/pkg/db/sqlc"
+	"shorten-url/backend/pkg/utils"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Workspace roles, from most to least privileged. Owners manage members,
+// editors create and change links, viewers see links and their analytics.
+const (
+	RoleOwner  = "owner"
+	RoleEditor = "editor"
+	RoleViewer = "viewer"
+
+	maxWorkspaceName = 100
+)
+
+var roleRank = map[string]int{RoleViewer: 1, RoleEditor: 2, RoleOwner: 3}
+
+var (
+	ErrWorkspaceNotFound    = errors.New("workspace not found")
+	ErrWorkspaceForbidden   = errors.New("your workspace role does not allow this")
+	ErrInvalidRole          = errors.New("role must be owner, editor or viewer")
+	ErrInvalidWorkspaceName = errors.New("workspace name must be between 1 and 100 characters")
+	ErrLastOwner            = errors.New("a workspace needs at least one owner")
+)
+
+type Workspace struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	CreatedBy string    `json:"createdBy"`
+	CreatedAt time.Time `json:"createdAt"`
+	// Role of the requesting user.
+	Role string `json:"role"`
+}
+
+type WorkspaceMember struct {
+	UserID   string    `json:"userId"`
+	Email    string    `json:"email,omitempty"`
+	Role     string    `json:"role"`
+	JoinedAt time.Time `json:"joinedAt"`
+}
+
+// CreateWorkspace creates a workspace with userIDStr as its first owner.
+func (s *UrlService) CreateWorkspace(userIDStr string, name string) (*Workspace, error) {
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return nil, ErrInvalidUserID
+	}
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > maxWorkspaceName {
+		return nil, ErrInvalidWorkspaceName
+	}
+
+	tx, err := s.postgresClient.DB.Begin(s.ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback(s.ctx)
+	queries := s.postgresClient.Queries.WithTx(tx)
+
+	workspace, err := queries.CreateWorkspace(s.ctx, sqlc.CreateWorkspaceParams{
+		Name:      name,
+		CreatedBy: utils.ConvertFromUuidPg(userID),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create workspace: %v", err)
+	}
+	err = queries.UpsertWorkspaceMember(s.ctx, sqlc.UpsertWorkspaceMemberParams{
+		WorkspaceID: workspace.ID,
+		UserID:      utils.ConvertFromUuidPg(userID),
+		Role:        RoleOwner,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to add workspace owner: %v", err)
+	}
+
+	if err := tx.Commit(s.ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit workspace: %v", err)
+	}
+
+	return &Workspace{
+		ID:        utils.ConvertFromPgUuid(workspace.ID).String(),
+		Name:      workspace.Name,
+		CreatedBy: userID.String(),
+		CreatedAt: workspace.CreatedAt.Time,
+		Role:      RoleOwner,
+	}, nil
+}
+
+// ListWorkspaces returns the workspaces userIDStr belongs to.
+func (s *UrlService) ListWorkspaces(userIDStr string) ([]Workspace, error) {
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return nil, ErrInvalidUserID
+	}
+
+	rows, err := s.postgresClient.Queries.ListUserWorkspaces(s.ctx, utils.ConvertFromUuidPg(userID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list workspaces: %v", err)
+	}
+
+	workspaces := make([]Workspace, 0, len(rows))
+	for _, row := range rows {
+		workspaces = append(workspaces, Workspace{
+			ID:        utils.ConvertFromPgUuid(row.ID).String(),
+			Name:      row.Name,
+			CreatedBy: utils.ConvertFromPgUuid(row.CreatedBy).String(),
+			CreatedAt: row.CreatedAt.Time,
+			Role:      row.Role,
+		})
+	}
+	return workspaces, nil
+}
+
+// ListWorkspaceMembers is open to every member of the workspace.
+func (s *UrlService) ListWorkspaceMembers(userIDStr string, workspaceIDStr string) ([]WorkspaceMember, error) {
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return nil, ErrInvalidUserID
+	}
+	workspaceID, err := s.requireWorkspaceRole(workspaceIDStr, userID, RoleViewer)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.postgresClient.Queries.ListWorkspaceMembers(s.ctx, utils.ConvertFromUuidPg(workspaceID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list workspace members: %v", err)
+	}
+
+	members := make([]WorkspaceMember, 0, len(rows))
+	for _, row := range rows {
+		members = append(members, WorkspaceMember{
+			UserID:   utils.ConvertFromPgUuid(row.UserID).String(),
+			Email:    row.Email.String,
+			Role:     row.Role,
+			JoinedAt: row.CreatedAt.Time,
+		})
+	}
+	return members, nil
+}
+
+// SetWorkspaceMember adds memberIDStr to the workspace or changes their
+// role. Only owners may do this.
+func (s *UrlService) SetWorkspaceMember(userIDStr string, workspaceIDStr string, memberIDStr string, role string) error {
+	if _, ok := roleRank[role]; !ok {
+		return ErrInvalidRole
+	}
+	memberID, err := uuid.Parse(memberIDStr)
+	if err != nil {
+		return ErrInvalidUserID
+	}
+
+	return s.changeMembership(userIDStr, workspaceIDStr, memberID, false, func(queries *sqlc.Queries, workspaceID pgtype.UUID) error {
+		exists, err := queries.UserExists(s.ctx, utils.ConvertFromUuidPg(memberID))
+		if err != nil {
+			return fmt.Errorf("failed to look up user: %v", err)
+		}
+		if !exists {
+			return ErrUserNotFound
+		}
+
+		return queries.UpsertWorkspaceMember(s.ctx, sqlc.UpsertWorkspaceMemberParams{
+			WorkspaceID: workspaceID,
+			UserID:      utils.ConvertFromUuidPg(memberID),
+			Role:        role,
+		})
+	})
+}
+
+// RemoveWorkspaceMember takes memberIDStr out of the workspace. Owners may
+// remove anyone; every member may leave on their own.
+func (s *UrlService) RemoveWorkspaceMember(userIDStr string, workspaceIDStr string, memberIDStr string) error {
+	memberID, err := uuid.Parse(memberIDStr)
+	if err != nil {
+		return ErrInvalidUserID
+	}
+
+	return s.changeMembership(userIDStr, workspaceIDStr, memberID, true, func(queries *sqlc.Queries, workspaceID pgtype.UUID) error {
+		removed, err := queries.RemoveWorkspaceMember(s.ctx, sqlc.RemoveWorkspaceMemberParams{
+			WorkspaceID: workspaceID,
+			UserID:      utils.ConvertFromUuidPg(memberID),
+		})
+		if err != nil {
+			return err
+		}
+		if removed == 0 {
+			return ErrUserNotFound
+		}
+		return nil
+	})
+}
+
+// changeMembership runs a membership change by an owner, or by the member
+// themselves when allowSelf is set. The workspace row stays locked until
+// commit, so concurrent changes cannot both remove the last owner.
+func (s *UrlService) changeMembership(userIDStr string, workspaceIDStr string, memberID uuid.UUID, allowSelf bool, change func(*sqlc.Queries, pgtype.UUID) error) error {
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return ErrInvalidUserID
+	}
+	workspaceID, err := uuid.Parse(workspaceIDStr)
+	if err != nil {
+		return ErrWorkspaceNotFound
+	}
+	pgWorkspaceID := utils.ConvertFromUuidPg(workspaceID)
+
+	tx, err := s.postgresClient.DB.Begin(s.ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback(s.ctx)
+	queries := s.postgresClient.Queries.WithTx(tx)
+
+	if _, err := queries.LockWorkspace(s.ctx, pgWorkspaceID); errors.Is(err, pgx.ErrNoRows) {
+		return ErrWorkspaceNotFound
+	} else if err != nil {
+		return fmt.Errorf("failed to lock workspace: %v", err)
+	}
+
+	role, err := s.workspaceRole(queries, pgWorkspaceID, userID)
+	if err != nil {
+		return err
+	}
+	if role != RoleOwner && !(allowSelf && memberID == userID) {
+		return ErrWorkspaceForbidden
+	}
+
+	if err := change(queries, pgWorkspaceID); err != nil {
+		return err
+	}
+
+	owners, err := queries.CountWorkspaceOwners(s.ctx, pgWorkspaceID)
+	if err != nil {
+		return fmt.Errorf("failed to count workspace owners: %v", err)
+	}
+	if owners == 0 {
+		return ErrLastOwner
+	}
+
+	if err := tx.Commit(s.ctx); err != nil {
+		return fmt.Errorf("failed to commit membership change: %v", err)
+	}
+	return nil
+}
+
+// requireWorkspaceRole checks that userID holds at least the minimum role in
+// the workspace. Non-members get ErrWorkspaceNotFound, so workspace IDs
+// cannot be probed.
+func (s *UrlService) requireWorkspaceRole(workspaceIDStr string, userID uuid.UUID, minimum string) (uuid.UUID, error) {
+	workspaceID, err := uuid.Parse(workspaceIDStr)
+	if err != nil {
+		return uuid.Nil, ErrWorkspaceNotFound
+	}
+
+	role, err := s.workspaceRole(s.postgresClient.Queries, utils.ConvertFromUuidPg(workspaceID), userID)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if roleRank[role] < roleRank[minimum] {
+		return uuid.Nil, ErrWorkspaceForbidden
+	}
+	return workspaceID, nil
+}
+
+// authorizeLink decides whether userID may act on url: personal links
+// belong to their creator alone, workspace links to members holding at least
+// the minimum role.
+func (s *UrlService) authorizeLink(url *CachedURL, userID uuid.UUID, minimum string) error {
+	if url.WorkspaceID == "" {
+		if url.UserID != userID.String() {
+			return ErrNotOwner
+		}
+		return nil
+	}
+
+	_, err := s.requireWorkspaceRole(url.WorkspaceID, userID, minimum)
+	if errors.Is(err, ErrWorkspaceNotFound) {
+		return ErrNotOwner
+	}
+	return err
+}
+
+func (s *UrlService) workspaceRole(queries *sqlc.Queries, workspaceID pgtype.UUID, userID uuid.UUID) (string, error) {
+	role, err := queries.GetWorkspaceRole(s.ctx, sqlc.GetWorkspaceRoleParams{
+		WorkspaceID: workspaceID,
+		UserID:      utils.ConvertFromUuidPg(userID),
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", ErrWorkspaceNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to look up workspace role: %v", err)
+	}
+	return role, nil
+}
@@ -0,0 +1,147 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// workspaceFixture is a workspace with one member of each role.
+type workspaceFixture struct {
+	id                              uuid.UUID
+	owner, editor, viewer, outsider uuid.UUID
+}
+
+func newWorkspaceFixture(t *testing.T, service *UrlService) workspaceFixture {
+	t.Helper()
+	db := service.postgresClient.DB.(*fakeDB)
+	w := workspaceFixture{id: uuid.New(), owner: uuid.New(), editor: uuid.New(), viewer: uuid.New(), outsider: uuid.New()}
+	for _, userID := range []uuid.UUID{w.owner, w.editor, w.viewer, w.outsider} {
+		if err := service.CreateUser(userID.String()); err != nil {
+			t.Fatalf("CreateUser: %v", err)
+		}
+	}
+	db.members[[2]uuid.UUID{w.id, w.owner}] = RoleOwner
+	db.members[[2]uuid.UUID{w.id, w.editor}] = RoleEditor
+	db.members[[2]uuid.UUID{w.id, w.viewer}] = RoleViewer
+	return w
+}
+
+func TestRequireWorkspaceRole(t *testing.T) {
+	service, _, _ := newTestService(t)
+	w := newWorkspaceFixture(t, service)
+
+	tests := []struct {
+		name    string
+		userID  uuid.UUID
+		minimum string
+		wantErr error
+	}{
+		{"owner may do anything", w.owner, RoleOwner, nil},
+		{"editor may edit", w.editor, RoleEditor, nil},
+		{"editor may view", w.editor, RoleViewer, nil},
+		{"editor may not manage", w.editor, RoleOwner, ErrWorkspaceForbidden},
+		{"viewer may view", w.viewer, RoleViewer, nil},
+		{"viewer may not edit", w.viewer, RoleEditor, ErrWorkspaceForbidden},
+		// Outsiders cannot tell a workspace they are not in from none at all.
+		{"outsider", w.outsider, RoleViewer, ErrWorkspaceNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := service.requireWorkspaceRole(w.id.String(), tt.userID, tt.minimum); !errors.Is(err, tt.wantErr) {
+				t.Errorf("requireWorkspaceRole error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if _, err := service.requireWorkspaceRole("not-a-uuid", w.owner, RoleViewer); !errors.Is(err, ErrWorkspaceNotFound) {
+		t.Errorf("requireWorkspaceRole with a bad ID error = %v, want ErrWorkspaceNotFound", err)
+	}
+}
+
+func TestAuthorizeLink(t *testing.T) {
+	service, _, _ := newTestService(t)
+	w := newWorkspaceFixture(t, service)
+	personal := &CachedURL{UserID: w.viewer.String()}
+	shared := &CachedURL{UserID: w.outsider.String(), WorkspaceID: w.id.String()}
+
+	tests := []struct {
+		name    string
+		url     *CachedURL
+		userID  uuid.UUID
+		minimum string
+		wantErr error
+	}{
+		{"creator of a personal link", personal, w.viewer, RoleEditor, nil},
+		{"anyone else on a personal link", personal, w.owner, RoleViewer, ErrNotOwner},
+		{"editor of a workspace link", shared, w.editor, RoleEditor, nil},
+		{"viewer editing a workspace link", shared, w.viewer, RoleEditor, ErrWorkspaceForbidden},
+		// The creator left the workspace; the link stays with it.
+		{"creator outside the workspace", shared, w.outsider, RoleViewer, ErrNotOwner},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := service.authorizeLink(tt.url, tt.userID, tt.minimum); !errors.Is(err, tt.wantErr) {
+				t.Errorf("authorizeLink error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWorkspaceMembershipChanges(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(service *UrlService, w workspaceFixture) error
+		wantErr error
+	}{
+		{"owner adds a member", func(service *UrlService, w workspaceFixture) error {
+			return service.SetWorkspaceMember(w.owner.String(), w.id.String(), w.outsider.String(), RoleViewer)
+		}, nil},
+		{"owner promotes an editor", func(service *UrlService, w workspaceFixture) error {
+			return service.SetWorkspaceMember(w.owner.String(), w.id.String(), w.editor.String(), RoleOwner)
+		}, nil},
+		{"editor adds a member", func(service *UrlService, w workspaceFixture) error {
+			return service.SetWorkspaceMember(w.editor.String(), w.id.String(), w.outsider.String(), RoleViewer)
+		}, ErrWorkspaceForbidden},
+		{"viewer promotes themselves", func(service *UrlService, w workspaceFixture) error {
+			return service.SetWorkspaceMember(w.viewer.String(), w.id.String(), w.viewer.String(), RoleOwner)
+		}, ErrWorkspaceForbidden},
+		{"unknown role", func(service *UrlService, w workspaceFixture) error {
+			return service.SetWorkspaceMember(w.owner.String(), w.id.String(), w.editor.String(), "admin")
+		}, ErrInvalidRole},
+		{"unknown user", func(service *UrlService, w workspaceFixture) error {
+			return service.SetWorkspaceMember(w.owner.String(), w.id.String(), uuid.NewString(), RoleViewer)
+		}, ErrUserNotFound},
+		{"last owner steps down", func(service *UrlService, w workspaceFixture) error {
+			return service.SetWorkspaceMember(w.owner.String(), w.id.String(), w.owner.String(), RoleEditor)
+		}, ErrLastOwner},
+		{"owner removes an editor", func(service *UrlService, w workspaceFixture) error {
+			return service.RemoveWorkspaceMember(w.owner.String(), w.id.String(), w.editor.String())
+		}, nil},
+		{"viewer leaves", func(service *UrlService, w workspaceFixture) error {
+			return service.RemoveWorkspaceMember(w.viewer.String(), w.id.String(), w.viewer.String())
+		}, nil},
+		{"viewer removes an editor", func(service *UrlService, w workspaceFixture) error {
+			return service.RemoveWorkspaceMember(w.viewer.String(), w.id.String(), w.editor.String())
+		}, ErrWorkspaceForbidden},
+		{"last owner leaves", func(service *UrlService, w workspaceFixture) error {
+			return service.RemoveWorkspaceMember(w.owner.String(), w.id.String(), w.owner.String())
+		}, ErrLastOwner},
+		{"outsider changes an unknown workspace", func(service *UrlService, w workspaceFixture) error {
+			return service.RemoveWorkspaceMember(w.outsider.String(), uuid.NewString(), w.outsider.String())
+		}, ErrWorkspaceNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, _, _ := newTestService(t)
+			w := newWorkspaceFixture(t, service)
+			if err := tt.change(service, w); !errors.Is(err, tt.wantErr) {
+				t.Errorf("error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -6,12 +6,22 @@ import (
 	"shorten-url/backend/pkg/config"
 	"shorten-url/backend/pkg/db/sqlc"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	log "github.com/sirupsen/logrus"
 )
 
+// Pool is the part of *pgxpool.Pool the services use, so tests can run them
+// against an in-memory database.
+type Pool interface {
+	sqlc.DBTX
+	Begin(ctx context.Context) (pgx.Tx, error)
+	Ping(ctx context.Context) error
+	Close()
+}
+
 type Postgres struct {
-	DB      *pgxpool.Pool
+	DB      Pool
 	Queries *sqlc.Queries
 }
 
@@ -42,6 +52,6 @@ func InitPostgres() *Postgres {
 	if err != nil {
 		log.Fatal(err)
 	}
-	fmt.Println("Postgres Connected")
+	log.Info("Postgres Connected")
 	return PostgresClient
 }
@@ -41,13 +41,35 @@ func InitRabbitMQ() *RabbitMQ {
 }
 
 func (r *RabbitMQ) DeclareQueue(queueName string) (amqp.Queue, error) {
+	return r.declareQueue(queueName, nil)
+}
+
+// DeclareDeadLetteredQueue declares a queue whose rejected messages are
+// routed through queueName+".dlx" to queueName+".dead", where they wait for
+// an operator instead of being dropped.
+func (r *RabbitMQ) DeclareDeadLetteredQueue(queueName string) (amqp.Queue, error) {
+	exchange := queueName + ".dlx"
+	if err := r.Channel.ExchangeDeclare(exchange, "fanout", true, false, false, false, nil); err != nil {
+		return amqp.Queue{}, err
+	}
+	dead, err := r.declareQueue(queueName+".dead", nil)
+	if err != nil {
+		return amqp.Queue{}, err
+	}
+	if err := r.Channel.QueueBind(dead.Name, "", exchange, false, nil); err != nil {
+		return amqp.Queue{}, err
+	}
+	return r.declareQueue(queueName, amqp.Table{"x-dead-letter-exchange": exchange})
+}
+
+func (r *RabbitMQ) declareQueue(queueName string, args amqp.Table) (amqp.Queue, error) {
 	queue, err := r.Channel.QueueDeclare(
 		queueName, 
 		true,      
 		false,     
 		false,     
 		false,     
-		nil,      
+		args,      
 	)
 	if err != nil {
 		return amqp.Queue{}, err
@@ -2,7 +2,6 @@ package stores
 
 import (
 	"context"
-	"fmt"
 	"shorten-url/backend/pkg/config"
 	"time"
 	"github.com/redis/go-redis/v9"
@@ -46,7 +45,7 @@ func InitRedis(maxMemory string, evictionStrategy string) *redis.ClusterClient {
 		}
 	}()
 
-	fmt.Println("Redis Cluster Connected")
+	log.Info("Redis Cluster Connected")
 	return RedisCluster
 }
 
@@ -0,0 +1,46 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	MinAliasLength = 3
+	MaxAliasLength = 64
+)
+
+var aliasPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Aliases that would shadow a route or be mistaken for one. Every first path
+// segment the server routes must be listed here.
+var reservedAliases = map[string]struct{}{
+	"api":        {},
+	"api-keys":   {},
+	"auth":       {},
+	"create":     {},
+	"delete":     {},
+	"export":     {},
+	"health":     {},
+	"history":    {},
+	"import":     {},
+	"search":     {},
+	"short":      {},
+	"stats":      {},
+	"users":      {},
+	"workspaces": {},
+}
+
+func ValidateAlias(alias string) error {
+	if len(alias) < MinAliasLength || len(alias) > MaxAliasLength {
+		return fmt.Errorf("alias must be between %d and %d characters", MinAliasLength, MaxAliasLength)
+	}
+	if !aliasPattern.MatchString(alias) {
+		return fmt.Errorf("alias may only contain letters, digits, '-' and '_'")
+	}
+	if _, ok := reservedAliases[strings.ToLower(alias)]; ok {
+		return fmt.Errorf("alias %q is reserved", alias)
+	}
+	return nil
+}
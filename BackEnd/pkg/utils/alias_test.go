@@ -0,0 +1,61 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateAlias(t *testing.T) {
+	tests := []struct {
+		name    string
+		alias   string
+		wantErr bool
+	}{
+		{"letters and digits", "promo2024", false},
+		{"dash and underscore", "spring_sale-2", false},
+		{"shortest", strings.Repeat("a", MinAliasLength), false},
+		{"longest", strings.Repeat("a", MaxAliasLength), false},
+		{"too short", strings.Repeat("a", MinAliasLength-1), true},
+		{"too long", strings.Repeat("a", MaxAliasLength+1), true},
+		{"empty", "", true},
+		{"space", "my link", true},
+		{"slash", "a/b/c", true},
+		{"dot", "file.txt", true},
+		{"query", "abc?x=1", true},
+		{"percent encoded", "abc%20", true},
+		{"non ascii", "café", true},
+		{"reserved", "api", true},
+		{"reserved any case", "History", true},
+		{"reserved prefix is fine", "apis", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateAlias(tt.alias)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ValidateAlias(%q) error = %v, wantErr %v", tt.alias, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateAliasRejectsRouteSegments(t *testing.T) {
+	// The first path segment of every route in cmd/server.
+	segments := []string{
+		"api", "api-keys", "auth", "create", "export", "history",
+		"import", "search", "short", "stats", "users", "workspaces",
+	}
+	for _, segment := range segments {
+		if err := ValidateAlias(segment); err == nil {
+			t.Errorf("ValidateAlias(%q) accepted a route segment", segment)
+		}
+	}
+}
+
+func TestValidateAliasRejectsEveryReservedWord(t *testing.T) {
+	for alias := range reservedAliases {
+		if err := ValidateAlias(alias); err == nil {
+			t.Errorf("ValidateAlias(%q) accepted a reserved alias", alias)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ClientIP returns the address of the client, preferring the headers set by
+// the nginx load balancer over the address of the proxy itself.
+func ClientIP(r *http.Request) string {
+	if ip := strings.TrimSpace(r.Header.Get("X-Real-IP")); ip != "" {
+		return ip
+	}
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		first, _, _ := strings.Cut(forwarded, ",")
+		return strings.TrimSpace(first)
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// IsHTTPS reports whether the client reached us over TLS, either directly or
+// through the load balancer.
+func IsHTTPS(r *http.Request) bool {
+	return r.TLS != nil || strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https")
+}
+
+// AnonymizeIP keeps the network part of an address, /24 for IPv4 and /48
+// for IPv6, which is enough for rough geography but no longer identifies a
+// person. Anything unparsable becomes "".
+func AnonymizeIP(address string) string {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return ""
+	}
+	if v4 := ip.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(24, 32)).String()
+	}
+	return ip.Mask(net.CIDRMask(48, 128)).String()
+}
+
+// VisitorFingerprint identifies a visitor for unique counts without keeping
+// their address: a keyed hash of the full IP and User-Agent. Without the
+// secret it cannot be linked back to an address, and it is only ever fed
+// into HyperLogLog sketches, which keep a few bits of it.
+func VisitorFingerprint(secret []byte, ip string, userAgent string) string {
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte("visitor\x00" + ip + "\x00" + userAgent))
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil)[:16])
+}
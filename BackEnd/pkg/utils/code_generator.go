@@ -0,0 +1,167 @@
+package utils
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+)
+
+const (
+	Base62Alphabet    = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	DefaultCodeLength = 8
+)
+
+// CodeGenerator produces candidate short codes. attempt starts at 0 and is
+// bumped by the caller every time a candidate turns out to be taken, so
+// deterministic generators can move on to a different code.
+type CodeGenerator interface {
+	Generate(originalURL string, attempt int) (string, error)
+}
+
+func NewCodeGenerator(kind string, alphabet string, length int, nodeID int64) (CodeGenerator, error) {
+	if alphabet == "" {
+		alphabet = Base62Alphabet
+	}
+	if length <= 0 {
+		length = DefaultCodeLength
+	}
+	if err := validateAlphabet(alphabet); err != nil {
+		return nil, err
+	}
+
+	switch kind {
+	case "", "random":
+		return &RandomGenerator{Alphabet: alphabet, Length: length}, nil
+	case "snowflake":
+		return NewSnowflakeGenerator(alphabet, nodeID), nil
+	case "hash":
+		return &HashGenerator{Alphabet: alphabet, Length: length}, nil
+	}
+	return nil, fmt.Errorf("unknown code generator %q", kind)
+}
+
+func validateAlphabet(alphabet string) error {
+	if len(alphabet) < 2 {
+		return fmt.Errorf("alphabet must contain at least 2 characters")
+	}
+	seen := make(map[rune]struct{}, len(alphabet))
+	for _, c := range alphabet {
+		if c > 127 {
+			return fmt.Errorf("alphabet must be ASCII")
+		}
+		if _, ok := seen[c]; ok {
+			return fmt.Errorf("alphabet contains duplicate character %q", c)
+		}
+		seen[c] = struct{}{}
+	}
+	return nil
+}
+
+// encodeBigInt writes n in the given alphabet, left-padded to length and
+// keeping only the lowest length digits.
+func encodeBigInt(n *big.Int, alphabet string, length int) string {
+	base := big.NewInt(int64(len(alphabet)))
+	num := new(big.Int).Set(n)
+	mod := new(big.Int)
+
+	code := make([]byte, length)
+	for i := length - 1; i >= 0; i-- {
+		num.DivMod(num, base, mod)
+		code[i] = alphabet[mod.Int64()]
+	}
+	return string(code)
+}
+
+// RandomGenerator draws every character uniformly from crypto/rand.
+type RandomGenerator struct {
+	Alphabet string
+	Length   int
+}
+
+func (g *RandomGenerator) Generate(_ string, _ int) (string, error) {
+	max := big.NewInt(int64(len(g.Alphabet)))
+	code := make([]byte, g.Length)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", fmt.Errorf("failed to read random bytes: %v", err)
+		}
+		code[i] = g.Alphabet[n.Int64()]
+	}
+	return string(code), nil
+}
+
+const (
+	snowflakeEpoch    = int64(1704067200000) // 2024-01-01T00:00:00Z in ms
+	snowflakeNodeBits = 10
+	snowflakeSeqBits  = 12
+	snowflakeMaxSeq   = int64(1)<<snowflakeSeqBits - 1
+
+	// Odd multiplier and xor key make the mapping a bijection on uint64, so
+	// sequential IDs stay unique but don't look sequential.
+	snowflakeMultiplier = uint64(0x9E3779B97F4A7C15)
+	snowflakeXorKey     = uint64(0x5DEECE66DA3B1F27)
+)
+
+// SnowflakeGenerator hands out time-ordered 64-bit IDs (ms timestamp, node ID,
+// per-ms sequence) and obfuscates them before encoding. Codes are always as
+// long as needed to hold 64 bits in the alphabet.
+type SnowflakeGenerator struct {
+	Alphabet string
+	NodeID   int64
+
+	mu       sync.Mutex
+	lastMs   int64
+	sequence int64
+	width    int
+}
+
+func NewSnowflakeGenerator(alphabet string, nodeID int64) *SnowflakeGenerator {
+	width := 0
+	limit := new(big.Int).Lsh(big.NewInt(1), 64)
+	for n, base := big.NewInt(1), big.NewInt(int64(len(alphabet))); n.Cmp(limit) < 0; n.Mul(n, base) {
+		width++
+	}
+
+	return &SnowflakeGenerator{
+		Alphabet: alphabet,
+		NodeID:   nodeID & (1<<snowflakeNodeBits - 1),
+		width:    width,
+	}
+}
+
+func (g *SnowflakeGenerator) Generate(_ string, _ int) (string, error) {
+	id := g.nextID()
+	obfuscated := (id ^ snowflakeXorKey) * snowflakeMultiplier
+	return encodeBigInt(new(big.Int).SetUint64(obfuscated), g.Alphabet, g.width), nil
+}
+
+func (g *SnowflakeGenerator) nextID() uint64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now().UnixMilli()
+	if now < g.lastMs {
+		// Clock went backwards; keep issuing from the last timestamp.
+		now = g.lastMs
+	}
+
+	if now == g.lastMs {
+		g.sequence = (g.sequence + 1) & snowflakeMaxSeq
+		if g.sequence == 0 {
+			for now <= g.lastMs {
+				time.Sleep(time.Millisecond)
+				now = time.Now().UnixMilli()
+			}
+		}
+	} else {
+		g.sequence = 0
+	}
+	g.lastMs = now
+
+	return uint64(now-snowflakeEpoch)<<(snowflakeNodeBits+snowflakeSeqBits) |
+		uint64(g.NodeID)<<snowflakeSeqBits |
+		uint64(g.sequence)
+}
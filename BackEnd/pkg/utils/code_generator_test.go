@@ -0,0 +1,108 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGeneratorsUseAlphabetAndLength(t *testing.T) {
+	tests := []struct {
+		kind      string
+		alphabet  string
+		length    int
+		wantWidth int
+	}{
+		{kind: "random", wantWidth: DefaultCodeLength},
+		{kind: "random", alphabet: "abc", length: 12, wantWidth: 12},
+		{kind: "hash", wantWidth: DefaultCodeLength},
+		{kind: "hash", alphabet: "0123456789", length: 5, wantWidth: 5},
+		// 64 bits need 11 base62 digits and 64 binary ones.
+		{kind: "snowflake", wantWidth: 11},
+		{kind: "snowflake", alphabet: "01", wantWidth: 64},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.kind+"/"+tt.alphabet, func(t *testing.T) {
+			generator, err := NewCodeGenerator(tt.kind, tt.alphabet, tt.length, 1)
+			if err != nil {
+				t.Fatalf("NewCodeGenerator: %v", err)
+			}
+			alphabet := tt.alphabet
+			if alphabet == "" {
+				alphabet = Base62Alphabet
+			}
+
+			for attempt := 0; attempt < 50; attempt++ {
+				code, err := generator.Generate("https://example.com/page", attempt)
+				if err != nil {
+					t.Fatalf("Generate: %v", err)
+				}
+				if len(code) != tt.wantWidth {
+					t.Fatalf("len(%q) = %d, want %d", code, len(code), tt.wantWidth)
+				}
+				for _, c := range code {
+					if !strings.ContainsRune(alphabet, c) {
+						t.Fatalf("code %q has %q outside the alphabet %q", code, c, alphabet)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestNewCodeGeneratorRejectsBadConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		kind     string
+		alphabet string
+	}{
+		{"unknown kind", "uuid", ""},
+		{"single character", "random", "a"},
+		{"duplicates", "random", "abca"},
+		{"non ascii", "random", "abcé"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewCodeGenerator(tt.kind, tt.alphabet, 0, 0); err == nil {
+				t.Fatalf("NewCodeGenerator(%q, %q) accepted a bad config", tt.kind, tt.alphabet)
+			}
+		})
+	}
+}
+
+func TestHashGeneratorRetries(t *testing.T) {
+	generator := &HashGenerator{Alphabet: Base62Alphabet, Length: DefaultCodeLength}
+	const url = "https://example.com/page"
+
+	first, _ := generator.Generate(url, 0)
+	again, _ := generator.Generate(url, 0)
+	if first != again {
+		t.Fatalf("first attempt is not deterministic: %q != %q", first, again)
+	}
+
+	// Salted retries must not repeat, or a popular URL would run out of codes.
+	seen := map[string]bool{first: true}
+	for attempt := 1; attempt <= 20; attempt++ {
+		code, err := generator.Generate(url, attempt)
+		if err != nil {
+			t.Fatalf("Generate: %v", err)
+		}
+		if seen[code] {
+			t.Fatalf("attempt %d repeated code %q", attempt, code)
+		}
+		seen[code] = true
+	}
+}
+
+func TestSnowflakeGeneratorIsUnique(t *testing.T) {
+	generator := NewSnowflakeGenerator(Base62Alphabet, 7)
+	seen := make(map[string]bool)
+	for i := 0; i < 10000; i++ {
+		code, _ := generator.Generate("", 0)
+		if seen[code] {
+			t.Fatalf("code %q issued twice", code)
+		}
+		seen[code] = true
+	}
+}
@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"fmt"
+	"time"
+)
+
+// ParseExpiry reads the expiresAt (RFC 3339) and ttl (Go duration such as
+// "72h", or "never") request parameters. A zero time with never=false means
+// neither was given.
+func ParseExpiry(expiresAt string, ttl string, now time.Time) (at time.Time, never bool, err error) {
+	if expiresAt != "" && ttl != "" {
+		return time.Time{}, false, fmt.Errorf("expiresAt and ttl are mutually exclusive")
+	}
+
+	if expiresAt != "" {
+		if expiresAt == "never" {
+			return time.Time{}, true, nil
+		}
+		at, err = time.Parse(time.RFC3339, expiresAt)
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("expiresAt must be an RFC 3339 timestamp")
+		}
+		return at, false, nil
+	}
+
+	if ttl != "" {
+		if ttl == "never" {
+			return time.Time{}, true, nil
+		}
+		d, err := time.ParseDuration(ttl)
+		if err != nil || d <= 0 {
+			return time.Time{}, false, fmt.Errorf("ttl must be a positive duration like 30m or 72h, or \"never\"")
+		}
+		return now.Add(d), false, nil
+	}
+
+	return time.Time{}, false, nil
+}
+
+// NullableTime renders a zero time as JSON null.
+func NullableTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseExpiry(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		expiresAt string
+		ttl       string
+		wantAt    time.Time
+		wantNever bool
+		wantErr   bool
+	}{
+		{name: "neither"},
+		{name: "timestamp", expiresAt: "2024-07-01T00:00:00Z", wantAt: time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "timestamp with offset", expiresAt: "2024-07-01T02:00:00+02:00", wantAt: time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)},
+		// Past timestamps parse; the service rejects them with ErrInvalidExpiry.
+		{name: "past timestamp", expiresAt: "2020-01-01T00:00:00Z", wantAt: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "timestamp never", expiresAt: "never", wantNever: true},
+		{name: "ttl", ttl: "72h", wantAt: now.Add(72 * time.Hour)},
+		{name: "ttl never", ttl: "never", wantNever: true},
+		{name: "zero ttl", ttl: "0s", wantErr: true},
+		{name: "negative ttl", ttl: "-1h", wantErr: true},
+		{name: "ttl without unit", ttl: "30", wantErr: true},
+		{name: "malformed ttl", ttl: "soon", wantErr: true},
+		{name: "date only", expiresAt: "2024-07-01", wantErr: true},
+		{name: "malformed timestamp", expiresAt: "tomorrow", wantErr: true},
+		{name: "unix seconds", expiresAt: "1719792000", wantErr: true},
+		{name: "both", expiresAt: "2024-07-01T00:00:00Z", ttl: "1h", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			at, never, err := ParseExpiry(tt.expiresAt, tt.ttl, now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseExpiry(%q, %q) error = %v, wantErr %v", tt.expiresAt, tt.ttl, err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if !at.Equal(tt.wantAt) {
+				t.Errorf("ParseExpiry(%q, %q) at = %v, want %v", tt.expiresAt, tt.ttl, at, tt.wantAt)
+			}
+			if never != tt.wantNever {
+				t.Errorf("ParseExpiry(%q, %q) never = %v, want %v", tt.expiresAt, tt.ttl, never, tt.wantNever)
+			}
+		})
+	}
+}
@@ -1,26 +1,36 @@
 package utils
 
 import (
+	"crypto/rand"
 	"crypto/sha256"
-	"encoding/base64"
 	"fmt"
-	"time"
+	"math/big"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
-func Hash(originalURL string) string {
-	timestamp := time.Now().UnixNano()
+// HashGenerator derives the first candidate from SHA-256 of the URL, so the
+// same URL maps to the same code while it is free. Retries are salted with
+// random bytes: deterministic retries would be taken too once the same URL
+// has been shortened a few times.
+type HashGenerator struct {
+	Alphabet string
+	Length   int
+}
 
-	dataToHash := fmt.Sprintf("%s%d", originalURL, timestamp)
+func (g *HashGenerator) Generate(originalURL string, attempt int) (string, error) {
+	dataToHash := originalURL
+	if attempt > 0 {
+		salt := make([]byte, 16)
+		if _, err := rand.Read(salt); err != nil {
+			return "", fmt.Errorf("failed to read random bytes: %v", err)
+		}
+		dataToHash = fmt.Sprintf("%s#%x", originalURL, salt)
+	}
 
 	hash := sha256.Sum256([]byte(dataToHash))
 
-	encoded := base64.URLEncoding.EncodeToString(hash[:])
-
-	shortened := encoded[:8]
-
-	return shortened
+	return encodeBigInt(new(big.Int).SetBytes(hash[:]), g.Alphabet, g.Length), nil
 }
 
 func ConvertFromUuidPg(id uuid.UUID) pgtype.UUID {
@@ -32,4 +42,4 @@ func ConvertFromUuidPg(id uuid.UUID) pgtype.UUID {
 
 func ConvertFromPgUuid(id pgtype.UUID) uuid.UUID {
     return id.Bytes
-}
\ No newline at end of file
+}
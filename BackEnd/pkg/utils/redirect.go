@@ -0,0 +1,21 @@
+package utils
+
+import (
+	"net/http"
+	"strings"
+)
+
+func IsRedirectStatus(status int) bool {
+	switch status {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
+
+// WantsJSON reports whether the client asked for JSON rather than a page,
+// e.g. fetch/ky calls sending "Accept: application/json".
+func WantsJSON(r *http.Request) bool {
+	accept := r.Header.Get("Accept")
+	return strings.Contains(accept, "application/json") && !strings.Contains(accept, "text/html")
+}
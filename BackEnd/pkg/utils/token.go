@@ -0,0 +1,50 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SignToken returns "<subject>.<expiry>.<mac>" signed with HMAC-SHA256, for
+// short-lived capabilities that must be accepted by every server instance.
+func SignToken(secret []byte, subject string, expiresAt time.Time) string {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(subject)) + "." + strconv.FormatInt(expiresAt.Unix(), 10)
+	return payload + "." + tokenMAC(secret, payload)
+}
+
+// VerifyToken checks the signature and expiry of a SignToken token and
+// returns its subject.
+func VerifyToken(secret []byte, token string) (string, bool) {
+	i := strings.LastIndexByte(token, '.')
+	if i < 0 {
+		return "", false
+	}
+	payload, mac := token[:i], token[i+1:]
+	if !hmac.Equal([]byte(mac), []byte(tokenMAC(secret, payload))) {
+		return "", false
+	}
+
+	encodedSubject, exp, ok := strings.Cut(payload, ".")
+	if !ok {
+		return "", false
+	}
+	expiresAt, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil || time.Now().Unix() >= expiresAt {
+		return "", false
+	}
+	subject, err := base64.RawURLEncoding.DecodeString(encodedSubject)
+	if err != nil {
+		return "", false
+	}
+	return string(subject), true
+}
+
+func tokenMAC(secret []byte, payload string) string {
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifyToken(t *testing.T) {
+	secret := []byte("test secret")
+	token := SignToken(secret, "unlock:abc", time.Now().Add(time.Minute))
+
+	subject, ok := VerifyToken(secret, token)
+	if !ok || subject != "unlock:abc" {
+		t.Fatalf("VerifyToken = (%q, %v), want the signed subject", subject, ok)
+	}
+}
+
+func TestVerifyTokenRejectsTampering(t *testing.T) {
+	secret := []byte("test secret")
+	token := SignToken(secret, "unlock:abc", time.Now().Add(time.Minute))
+	parts := strings.Split(token, ".")
+	otherSubject := base64.RawURLEncoding.EncodeToString([]byte("unlock:xyz"))
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"other subject", otherSubject + "." + parts[1] + "." + parts[2]},
+		{"later expiry", parts[0] + "." + "99999999999" + "." + parts[2]},
+		{"flipped mac", parts[0] + "." + parts[1] + "." + flipLastChar(parts[2])},
+		{"missing mac", parts[0] + "." + parts[1]},
+		{"empty mac", parts[0] + "." + parts[1] + "."},
+		{"signed with another secret", SignToken([]byte("other secret"), "unlock:abc", time.Now().Add(time.Minute))},
+		{"expired", SignToken(secret, "unlock:abc", time.Now().Add(-time.Second))},
+		{"no dots", "garbage"},
+		{"empty", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if subject, ok := VerifyToken(secret, tt.token); ok {
+				t.Fatalf("VerifyToken(%q) accepted a bad token with subject %q", tt.token, subject)
+			}
+		})
+	}
+}
+
+func flipLastChar(s string) string {
+	last := s[len(s)-1]
+	if last == 'A' {
+		return s[:len(s)-1] + "B"
+	}
+	return s[:len(s)-1] + "A"
+}
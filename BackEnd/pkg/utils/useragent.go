@@ -0,0 +1,81 @@
+package utils
+
+import (
+	"net/url"
+	"strings"
+)
+
+// UserAgent is the coarse classification of a User-Agent header used in
+// click statistics.
+type UserAgent struct {
+	Browser string
+	OS      string
+	Device  string
+}
+
+// ParseUserAgent classifies a User-Agent header by its well-known tokens.
+// Order matters: most browsers also claim to be Safari or Chrome, so the
+// more specific tokens are checked first.
+func ParseUserAgent(header string) UserAgent {
+	if header == "" {
+		return UserAgent{Browser: "Unknown", OS: "Unknown", Device: "unknown"}
+	}
+
+	return UserAgent{
+		Browser: matchToken(header, [][2]string{
+			{"Edg", "Edge"},
+			{"OPR/", "Opera"},
+			{"Opera", "Opera"},
+			{"SamsungBrowser/", "Samsung Internet"},
+			{"Firefox/", "Firefox"},
+			{"FxiOS/", "Firefox"},
+			{"CriOS/", "Chrome"},
+			{"Chrome/", "Chrome"},
+			{"Safari/", "Safari"},
+		}),
+		OS: matchToken(header, [][2]string{
+			{"Windows", "Windows"},
+			{"iPhone", "iOS"},
+			{"iPad", "iOS"},
+			{"iPod", "iOS"},
+			{"Mac OS X", "macOS"},
+			{"CrOS", "ChromeOS"},
+			{"Android", "Android"},
+			{"Linux", "Linux"},
+		}),
+		Device: deviceType(header),
+	}
+}
+
+func matchToken(header string, tokens [][2]string) string {
+	for _, token := range tokens {
+		if strings.Contains(header, token[0]) {
+			return token[1]
+		}
+	}
+	return "Other"
+}
+
+func deviceType(header string) string {
+	switch {
+	case strings.Contains(header, "iPad"),
+		strings.Contains(header, "Tablet"),
+		strings.Contains(header, "Android") && !strings.Contains(header, "Mobile"):
+		return "tablet"
+	case strings.Contains(header, "Mobi"),
+		strings.Contains(header, "iPhone"),
+		strings.Contains(header, "iPod"):
+		return "mobile"
+	}
+	return "desktop"
+}
+
+// ReferrerDomain reduces a Referer header to its host without "www.".
+// Clicks without a usable referrer count as "direct".
+func ReferrerDomain(referrer string) string {
+	parsed, err := url.Parse(referrer)
+	if err != nil || parsed.Hostname() == "" {
+		return "direct"
+	}
+	return strings.TrimPrefix(strings.ToLower(parsed.Hostname()), "www.")
+}
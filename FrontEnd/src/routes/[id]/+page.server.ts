@@ -1,11 +1,62 @@
 import { API_GATEWAY } from '$lib';
-import { redirect } from '@sveltejs/kit';
-import ky from 'ky';
+import { error, fail, redirect } from '@sveltejs/kit';
+import ky, { HTTPError } from 'ky';
+
+// Resolves a short link, passing along an unlock token for protected links.
+// Protected links answer 401 until they are unlocked.
+async function resolve(id: string, unlockToken?: string) {
+  try {
+    const data: any = await ky.get(`${API_GATEWAY}/api/short/${id}`, {
+      headers: unlockToken ? { 'X-Unlock-Token': unlockToken } : {},
+    }).json();
+    return { originalUrl: data.originalUrl as string, locked: false };
+  } catch (e) {
+    if (e instanceof HTTPError) {
+      if (e.response.status === 401) {
+        return { originalUrl: '', locked: true };
+      }
+      throw error(e.response.status, e.response.status === 410 ? 'This link has expired' : 'Link not found');
+    }
+    throw e;
+  }
+}
 
 export async function load({ params }) {
   const id = params.id;
 
-  const data : any = await ky.get(`${API_GATEWAY}/short/${id}`).json();
+  const { originalUrl, locked } = await resolve(id);
+  if (locked) {
+    return { id, locked };
+  }
+
+  throw redirect(307, originalUrl);
+}
+
+export const actions = {
+  default: async ({ params, request, getClientAddress }) => {
+    const id = params.id;
+    const form = await request.formData();
+    const password = String(form.get('password') ?? '');
+
+    let token: string;
+    try {
+      // Unlock attempts are limited per client, not per frontend server.
+      const data: any = await ky.post(`${API_GATEWAY}/short/${id}/unlock`, {
+        json: { password },
+        headers: { 'X-Forwarded-For': getClientAddress() },
+      }).json();
+      token = data.token;
+    } catch (e) {
+      if (e instanceof HTTPError && e.response.status === 401) {
+        return fail(401, { invalid: true });
+      }
+      if (e instanceof HTTPError && e.response.status === 429) {
+        return fail(429, { tooMany: true });
+      }
+      throw e;
+    }
 
-  throw redirect(307, data.originalUrl);
-}
\ No newline at end of file
+    const { originalUrl } = await resolve(id, token);
+    throw redirect(303, originalUrl);
+  },
+};
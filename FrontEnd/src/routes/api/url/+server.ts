@@ -2,22 +2,23 @@ import { API_GATEWAY } from '$lib';
 import { json } from '@sveltejs/kit';
 import ky from 'ky';
 
-export async function POST({ url }) {
+export async function POST({ url, request }) {
     try {
         const originalUrl = url.searchParams.get('url');
-        const userId = url.searchParams.get('userId');
+        const authorization = request.headers.get('authorization');
+        const alias = url.searchParams.get('alias');
         console.log(originalUrl)
-        console.log(userId)
-        if (!originalUrl || !userId) {
+        if (!originalUrl || !authorization) {
             return json({
-                error: 'URL and userId are required'
+                error: 'URL and API key are required'
             }, { status: 400 });
         }
-        console.log(originalUrl, userId)
+        const searchParams: Record<string, string> = { url: originalUrl };
+        if (alias) {
+            searchParams.alias = alias;
+        }
         const data = await ky
-            .post(
-                `${API_GATEWAY}/create?url=${originalUrl}&userId=${userId}`,
-            )
+            .post(`${API_GATEWAY}/create`, { searchParams, headers: { authorization } })
             .json();
         console.log(data);
 
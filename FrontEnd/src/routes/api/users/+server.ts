@@ -1,6 +1,6 @@
 import { API_GATEWAY } from '$lib';
 import { json } from '@sveltejs/kit';
-import ky from 'ky';
+import ky, { HTTPError } from 'ky';
 
 export async function POST({ request }) {
     try {
@@ -12,21 +12,26 @@ export async function POST({ request }) {
             }, { status: 400 });
         }
         
-        ky.post(`${API_GATEWAY}/users`, {
+        const data: { apiKey: string } = await ky.post(`${API_GATEWAY}/users`, {
             json: {
                 userId: userId,
             },
-        }).catch((error) => {
-            console.error("Failed to register new user:", error);
-        });
-        
+        }).json();
+
         return json({
             success: true,
             message: 'User registered successfully',
-            userId
+            userId,
+            apiKey: data.apiKey
         }, { status: 201 });
 
     } catch (error) {
+        // A userId that already exists is refused with 409.
+        if (error instanceof HTTPError && error.response.status === 409) {
+            return json({
+                error: 'User ID is already taken'
+            }, { status: 409 });
+        }
         console.error('Error registering user:', error);
         
         return json({